@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alkar/odyn"
@@ -15,36 +19,203 @@ import (
 var (
 	appVersion = "master"
 
-	psCombinedTwo, _   = odyn.NewProviderSet(odyn.ProviderSetParallel, odyn.IpifyProvider, odyn.OpenDNSProvider)
-	psCombinedThree, _ = odyn.NewProviderSet(odyn.ProviderSetSerial, psCombinedTwo, odyn.IPInfoProvider)
+	// the providers are instrumented individually, so that the metrics
+	// cover every provider inside the ProviderSets as well
+	ipifyProvider    = instrumentProvider("ipify", odyn.IpifyProvider)
+	ipinfoProvider   = instrumentProvider("ipinfo", odyn.IPInfoProvider)
+	opendnsProvider  = instrumentProvider("opendns", odyn.OpenDNSProvider)
+	googleProvider   = instrumentProvider("google", odyn.GoogleDNSProvider)
+	cfProvider       = instrumentProvider("cloudflare", odyn.CloudflareDNSProvider)
+	stunProvider     = instrumentProvider("stun", odyn.GoogleSTUNProvider)
+	ipify6Provider   = instrumentProvider("ipify6", odyn.Ipify6Provider)
+	opendns6Provider = instrumentProvider("opendns6", odyn.OpenDNS6Provider)
+	google6Provider  = instrumentProvider("google6", odyn.GoogleDNS6Provider)
+	cf6Provider      = instrumentProvider("cloudflare6", odyn.CloudflareDNS6Provider)
+
+	psCombinedTwo, _   = odyn.NewProviderSet(odyn.ProviderSetParallel, ipifyProvider, opendnsProvider)
+	psCombinedThree, _ = odyn.NewProviderSet(odyn.ProviderSetSerial, psCombinedTwo, ipinfoProvider)
+	psCombinedSix, _   = odyn.NewProviderSet(odyn.ProviderSetParallel, ipify6Provider, opendns6Provider)
+	psFastest, _       = odyn.NewProviderSet(odyn.ProviderSetRace, ipifyProvider, ipinfoProvider, opendnsProvider)
+	psFastestSix, _    = odyn.NewProviderSet(odyn.ProviderSetRace, ipify6Provider, opendns6Provider)
 
 	publicipProviders = map[string]interface{}{
-		"ipify":    odyn.IpifyProvider,
-		"ipinfo":   odyn.IPInfoProvider,
-		"opendns":  odyn.OpenDNSProvider,
-		"combined": psCombinedThree,
+		"ipify":      ipifyProvider,
+		"ipinfo":     ipinfoProvider,
+		"opendns":    opendnsProvider,
+		"stun":       stunProvider,
+		"google":     googleProvider,
+		"cloudflare": cfProvider,
+		"upnp":       ipProviderFactory(newUPnPProvider),
+		"natpmp":     ipProviderFactory(newNATPMPProvider),
+		"pcp":        ipProviderFactory(newPCPProvider),
+		"combined":   psCombinedThree,
+		"fastest":    psFastest,
+	}
+
+	publicipv6Providers = map[string]interface{}{
+		"ipify":      ipify6Provider,
+		"opendns":    opendns6Provider,
+		"google":     google6Provider,
+		"cloudflare": cf6Provider,
+		"combined":   psCombinedSix,
+		"fastest":    psFastestSix,
 	}
 
+	// dnsProviders holds constructors rather than instances so that only the
+	// selected providers need to be configured and every record gets its own
+	// instance with its own TTL.
 	dnsProviders = map[string]interface{}{
-		"route53": nil,
+		"route53":      dnsZoneFactory(newRoute53Zone),
+		"cloudflare":   dnsZoneFactory(newCloudflareZone),
+		"googlecloud":  dnsZoneFactory(newGoogleCloudDNSZone),
+		"digitalocean": dnsZoneFactory(newDigitalOceanZone),
+		"azure":        dnsZoneFactory(newAzureDNSZone),
+		"powerdns":     dnsZoneFactory(newPowerDNSZone),
+		"dyndns2":      dnsZoneFactory(newDynDNS2Zone),
+		"rfc2136":      dnsZoneFactory(newRFC2136Zone),
 	}
 )
 
-func init() {
-	var err error
-	dnsProviders["route53"], err = odyn.NewRoute53Zone()
+// ipProviderFactory creates an IP provider that talks to the gateway, or
+// discovers the gateway if it is empty. The router providers are created per
+// record, so that each record can use a different gateway.
+type ipProviderFactory func(gateway string) (odyn.IPProvider, error)
+
+func newUPnPProvider(gateway string) (odyn.IPProvider, error) {
+	options := &odyn.UPnPProviderOptions{}
+	if gateway != "" {
+		// gateways answer SSDP searches sent to them directly as well
+		options.SSDPAddress = gateway
+		if _, _, err := net.SplitHostPort(gateway); err != nil {
+			options.SSDPAddress = net.JoinHostPort(gateway, "1900")
+		}
+	}
+
+	p, err := odyn.NewUPnPProviderWithOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return instrumentProvider("upnp", p), nil
+}
+
+func newNATPMPProvider(gateway string) (odyn.IPProvider, error) {
+	p, err := odyn.NewNATPMPProvider(gateway)
 	if err != nil {
-		log.Printf("[ERROR] error initialising route53: %+v", err)
+		return nil, err
+	}
+
+	return instrumentProvider("natpmp", p), nil
+}
+
+func newPCPProvider(gateway string) (odyn.IPProvider, error) {
+	p, err := odyn.NewPCPProvider(gateway)
+	if err != nil {
+		return nil, err
+	}
+
+	return instrumentProvider("pcp", p), nil
+}
+
+// dnsZoneFactory creates a DNS zone provider that creates records with the
+// given TTL, or the provider's default TTL if it is zero.
+type dnsZoneFactory func(ttl int64) (odyn.DNSZone, error)
+
+func newRoute53Zone(ttl int64) (odyn.DNSZone, error) {
+	return odyn.NewRoute53ZoneWithOptions(&odyn.Route53ZoneOptions{
+		TTL:           ttl,
+		WatchCallback: observeRoute53Wait,
+	})
+}
+
+func newCloudflareZone(ttl int64) (odyn.DNSZone, error) {
+	return odyn.NewCloudflareZoneWithOptions(&odyn.CloudflareZoneOptions{
+		APIToken: os.Getenv("CLOUDFLARE_API_TOKEN"),
+		Proxied:  os.Getenv("CLOUDFLARE_PROXIED") == "true",
+		TTL:      ttl,
+	})
+}
+
+func newGoogleCloudDNSZone(ttl int64) (odyn.DNSZone, error) {
+	credentials, err := ioutil.ReadFile(os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"))
+	if err != nil {
+		return nil, err
+	}
+
+	return odyn.NewGoogleCloudDNSZoneWithOptions(&odyn.GoogleCloudDNSZoneOptions{
+		Credentials: credentials,
+		Project:     os.Getenv("GOOGLE_CLOUD_PROJECT"),
+		TTL:         ttl,
+	})
+}
+
+func newDigitalOceanZone(ttl int64) (odyn.DNSZone, error) {
+	return odyn.NewDigitalOceanZoneWithOptions(&odyn.DigitalOceanZoneOptions{
+		APIToken: os.Getenv("DIGITALOCEAN_TOKEN"),
+		TTL:      ttl,
+	})
+}
+
+func newAzureDNSZone(ttl int64) (odyn.DNSZone, error) {
+	// the credentials, subscription and resource group are read from the
+	// AZURE_* environment variables
+	return odyn.NewAzureDNSZoneWithOptions(&odyn.AzureDNSZoneOptions{TTL: ttl})
+}
+
+func newPowerDNSZone(ttl int64) (odyn.DNSZone, error) {
+	return odyn.NewPowerDNSZoneWithOptions(&odyn.PowerDNSZoneOptions{
+		APIURL:  os.Getenv("POWERDNS_API_URL"),
+		APIKey:  os.Getenv("POWERDNS_API_KEY"),
+		Server:  os.Getenv("POWERDNS_SERVER"),
+		Notify:  os.Getenv("POWERDNS_NOTIFY") == "true",
+		Rectify: os.Getenv("POWERDNS_RECTIFY") == "true",
+		TTL:     ttl,
+	})
+}
+
+// newDynDNS2Zone ignores the TTL, which dyndns2 services set on their own.
+func newDynDNS2Zone(ttl int64) (odyn.DNSZone, error) {
+	return odyn.NewDynDNS2Zone(os.Getenv("DYNDNS2_URL"), os.Getenv("DYNDNS2_USERNAME"), os.Getenv("DYNDNS2_PASSWORD"))
+}
+
+func newRFC2136Zone(ttl int64) (odyn.DNSZone, error) {
+	return odyn.NewRFC2136ZoneWithOptions(&odyn.RFC2136ZoneOptions{
+		TTL:           ttl,
+		Server:        os.Getenv("RFC2136_SERVER"),
+		TSIGKeyName:   os.Getenv("RFC2136_TSIG_KEY"),
+		TSIGSecret:    os.Getenv("RFC2136_TSIG_SECRET"),
+		TSIGAlgorithm: os.Getenv("RFC2136_TSIG_ALGORITHM"),
+	})
+}
+
+func getPublicIPProvider(name string, gateway string) odyn.IPProvider {
+	provider := validateProvider(name, publicipProviders)
+	factory, ok := provider.(ipProviderFactory)
+	if !ok {
+		return provider.(odyn.IPProvider)
+	}
+
+	p, err := factory(gateway)
+	if err != nil {
+		log.Printf("[ERROR] error initialising %s: %+v", name, err)
 		os.Exit(1)
 	}
+
+	return p
 }
 
-func getPublicIPProvider(name string) odyn.IPProvider {
-	return validateProvider(name, publicipProviders).(odyn.IPProvider)
+func getPublicIPv6Provider(name string) odyn.IPProvider {
+	return validateProvider(name, publicipv6Providers).(odyn.IPProvider)
 }
 
-func getDNSZoneProvider(name string) odyn.DNSZone {
-	return validateProvider(name, dnsProviders).(odyn.DNSZone)
+func getDNSZoneProvider(name string, ttl int64) odyn.DNSZone {
+	zone, err := validateProvider(name, dnsProviders).(dnsZoneFactory)(ttl)
+	if err != nil {
+		log.Printf("[ERROR] error initialising %s: %+v", name, err)
+		os.Exit(1)
+	}
+
+	return zone
 }
 
 func validateProvider(name string, providers map[string]interface{}) interface{} {
@@ -54,16 +225,21 @@ func validateProvider(name string, providers map[string]interface{}) interface{}
 		}
 	}
 
+	log.Printf("[ERROR] invalid value '%s': provider must be one of: %s", name, strings.Join(providerNames(providers), ", "))
+	os.Exit(1)
+
+	return nil
+}
+
+func providerNames(providers map[string]interface{}) []string {
 	available := make([]string, len(providers))
 	i := 0
 	for k := range providers {
 		available[i] = k
 		i++
 	}
-	log.Printf("[ERROR] invalid value '%s': provider must be one of: %s", name, strings.Join(available, ", "))
-	os.Exit(1)
 
-	return nil
+	return available
 }
 
 func initLog(debug bool) {
@@ -82,108 +258,143 @@ func main() {
 	var (
 		app              = cli.App("odyn", "Odyn is a modern, extensible dynamic DNS updater")
 		debugLog         = app.BoolOpt("d debug", false, "enables debug log output")
-		publicIPProvider = app.StringOpt("p public-ip-provider", "combined", "public IP provider to use")
-		dnsZoneProvider  = app.StringOpt("d dns-zone-provider", "route53", "DNS provider to use")
+		configFile       = app.StringOpt("c config", "", "JSON configuration file declaring the records to manage, replaces ZONE and RECORD; the other options set the defaults for the settings that the records leave empty")
+		dryRun           = app.BoolOpt("n dry-run", false, "print the changes that would be made without updating the DNS zone")
+		metricsAddress   = app.StringOpt("metrics-address", "", "address to serve Prometheus metrics on, e.g. :9090, disabled if empty")
+		preHook          = app.StringOpt("pre-hook", "", "path of a command to run before updating a record, receives the record, zone, old and new IP as arguments; it is not run through a shell and the value is not split into arguments")
+		postHook         = app.StringOpt("post-hook", "", "path of a command to run after updating a record, receives the record, zone, old and new IP as arguments; it is not run through a shell and the value is not split into arguments")
+		gateway          = app.StringOpt("gateway", "", "address of the router used by the upnp, natpmp and pcp IP providers, discovered if empty")
+		hookTimeout      = app.StringOpt("hook-timeout", defaultHookTimeout.String(), "time to wait for a hook to finish before killing it and its child processes")
+		abortOnPreHook   = app.BoolOpt("abort-on-pre-hook-failure", false, "do not update the record if the pre-update hook fails")
+		webhooks         = app.StringsOpt("webhook", nil, "URL to POST a JSON notification to when a record changes or keeps failing to sync, may be repeated")
+		slackWebhooks    = app.StringsOpt("slack-webhook", nil, "Slack incoming webhook URL to notify when a record changes or keeps failing to sync, may be repeated")
+		failureThreshold = app.IntOpt("failure-threshold", defaultFailureThreshold, "number of consecutive failed syncs before sending a failure notification")
+		once             = app.BoolOpt("once", false, "sync once and exit with 0 if nothing changed, 10 if a record was updated, 11, 12 and 13 if IP discovery, record resolution or the zone update failed or 14 if the pre-update hook aborted the update")
+		publicIPProvider = app.StringOpt("p public-ip-provider", defaultRecordIPProvider, "public IP provider to use, empty disables A record updates")
+		publicIPv6       = app.StringOpt("6 public-ipv6-provider", "", "public IPv6 provider to use, empty disables AAAA record updates")
+		dnsZoneProvider  = app.StringOpt("z dns-zone-provider", defaultRecordZoneProvider, "DNS provider to use (cloudflare requires CLOUDFLARE_API_TOKEN, googlecloud requires GOOGLE_APPLICATION_CREDENTIALS, digitalocean requires DIGITALOCEAN_TOKEN, azure requires AZURE_TENANT_ID, AZURE_CLIENT_ID, AZURE_CLIENT_SECRET, AZURE_SUBSCRIPTION_ID and AZURE_RESOURCE_GROUP, powerdns requires POWERDNS_API_URL and POWERDNS_API_KEY, dyndns2 requires DYNDNS2_URL, DYNDNS2_USERNAME and DYNDNS2_PASSWORD, rfc2136 requires RFC2136_SERVER)")
 		zoneName         = app.StringArg("ZONE", "", "DNS zone")
 		recordName       = app.StringArg("RECORD", "", "DNS record to update")
 	)
 
+	app.Spec = "[OPTIONS] [ZONE RECORD]"
+
 	app.Action = func() {
 		initLog(*debugLog)
 
-		publicIP := getPublicIPProvider(*publicIPProvider)
-		dnsZone := getDNSZoneProvider(*dnsZoneProvider)
-		u := newUpdater(*recordName, *zoneName, publicIP, dnsZone)
+		rc := recordConfig{
+			Record:       *recordName,
+			Zone:         *zoneName,
+			ZoneProvider: *dnsZoneProvider,
+			IPProvider:   *publicIPProvider,
+			IPv6Provider: *publicIPv6,
+			Gateway:      *gateway,
+
+			AbortOnPreHookFailure: *abortOnPreHook,
+
+			Webhooks:         *webhooks,
+			SlackWebhooks:    *slackWebhooks,
+			FailureThreshold: *failureThreshold,
+		}
+		if *preHook != "" {
+			rc.PreHook = []string{*preHook}
+		}
+		if *postHook != "" {
+			rc.PostHook = []string{*postHook}
+		}
+		timeout, err := time.ParseDuration(*hookTimeout)
+		if err != nil {
+			log.Printf("[ERROR] invalid hook timeout '%s': %+v", *hookTimeout, err)
+			os.Exit(1)
+		}
+		rc.HookTimeout.Duration = timeout
+
+		var records []recordConfig
+		if *configFile != "" {
+			if *zoneName != "" || *recordName != "" {
+				log.Printf("[ERROR] ZONE and RECORD cannot be used with --config, declare the records in the configuration file instead")
+				os.Exit(2)
+			}
+
+			cfg, err := loadConfig(*configFile, rc)
+			if err != nil {
+				log.Printf("[ERROR] could not load the configuration file: %+v", err)
+				os.Exit(1)
+			}
+			records = cfg.Records
+		} else {
+			if err := rc.validate(); err != nil {
+				log.Printf("[ERROR] %+v", err)
+				os.Exit(1)
+			}
+			records = append(records, rc)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		updaters := make([]*updater, len(records))
+		for i, rc := range records {
+			updaters[i] = newUpdater(ctx, rc, *dryRun)
+		}
 
 		sigChannel := make(chan os.Signal, 1)
 		signal.Notify(sigChannel, os.Interrupt)
 		go func() {
 			<-sigChannel
 			log.Println("[INFO] interrupt singal: shutting down ...")
-			u.stop()
+			cancel()
 		}()
 
-		u.start()
-	}
-
-	app.Version("v version", appVersion)
+		if *metricsAddress != "" && !*once {
+			startMetricsServer(*metricsAddress)
+		}
 
-	app.Run(os.Args)
-}
+		if *once {
+			os.Exit(int(syncOnce(updaters)))
+		}
 
-type updater struct {
-	*odyn.DNSClient
-	odyn.IPProvider
-	odyn.DNSZone
-	zoneName   string
-	recordName string
-	stopChan   chan struct{}
-}
-
-func newUpdater(recordName, zoneName string, ipProvider odyn.IPProvider, dnsZone odyn.DNSZone) *updater {
-	return &updater{
-		odyn.NewDNSClient(),
-		ipProvider,
-		dnsZone,
-		zoneName,
-		recordName,
-		make(chan struct{}),
-	}
-}
-
-func (u *updater) start() {
-	tick := time.NewTicker(time.Minute)
-	defer tick.Stop()
-	u.sync()
-	for {
-		select {
-		case <-tick.C:
-			u.sync()
-		case <-u.stopChan:
-			return
+		wg := &sync.WaitGroup{}
+		wg.Add(len(updaters))
+		for _, u := range updaters {
+			go func(u *updater) {
+				defer wg.Done()
+				u.start()
+			}(u)
 		}
+		wg.Wait()
 	}
-}
 
-func (u *updater) stop() {
-	close(u.stopChan)
+	app.Version("v version", appVersion)
+
+	app.Run(os.Args)
 }
 
-func (u *updater) sync() {
-	zoneNameservers, err := u.Nameservers(u.zoneName)
-	if err != nil {
-		log.Printf("[ERROR] could not get dns zone's nameservers: %+v", err)
-		return
-	}
-	for i := 0; i < len(zoneNameservers); i++ {
-		zoneNameservers[i] += ":53"
-	}
+// syncOnce syncs all the records concurrently and returns the most severe of
+// the results.
+func syncOnce(updaters []*updater) syncResult {
+	results := make([]syncResult, len(updaters))
 
-	ipRecord, err := u.ResolveA(u.recordName, zoneNameservers)
-	if err != nil {
-		log.Printf("[INFO] could not resolve current DNS record, ignoring error: %+v", err)
-		return
-	}
-	if len(ipRecord) > 1 {
-		log.Printf("[INFO] nameserver replied with multiple IP addresses, will use the first: %+v", ipRecord)
+	wg := &sync.WaitGroup{}
+	wg.Add(len(updaters))
+	for i, u := range updaters {
+		go func(i int, u *updater) {
+			defer wg.Done()
+			results[i] = u.sync()
+		}(i, u)
 	}
+	wg.Wait()
 
-	ipCurrent, err := u.Get()
-	if err != nil {
-		log.Printf("[ERROR] could not get public IP address: %+v", err)
-		return
-	}
+	return mostSevere(results)
+}
 
-	if ipCurrent.Equal(ipRecord[0]) {
-		log.Printf("[DEBUG] current public IP address is already registered with the nameservers, will not update")
-		return
+// mostSevere returns the most severe of the results, or syncUnchanged if
+// there are none.
+func mostSevere(results []syncResult) syncResult {
+	result := syncUnchanged
+	for _, r := range results {
+		if r > result {
+			result = r
+		}
 	}
 
-	log.Printf("[INFO] IP address has changed, updating ...")
-	err = u.UpdateA(u.recordName, u.zoneName, ipCurrent)
-	if err != nil {
-		log.Printf("[ERROR] failed to update the DNS record, will try again in roughly a minute: %+v", err)
-		return
-	}
-	log.Printf("[INFO] updated the DNS record to point to: %+v", ipCurrent)
+	return result
 }
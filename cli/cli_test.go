@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/alkar/odyn"
+	"github.com/miekg/dns"
+)
+
+// testZone is a DNS zone that only knows its nameservers and fails the
+// updates with updateErr.
+type testZone struct {
+	nameservers []string
+	err         error
+	updateErr   error
+}
+
+func (z *testZone) UpdateA(recordName string, zoneName string, ip net.IP) error {
+	return z.updateErr
+}
+
+func (z *testZone) UpdateAAAA(recordName string, zoneName string, ip net.IP) error {
+	return z.updateErr
+}
+
+func (z *testZone) Nameservers(zoneName string) ([]string, error) {
+	return z.nameservers, z.err
+}
+
+// newTestUpdater returns an updater keeping the A record of
+// home.example.com. in the zone in sync with the IP address of provider.
+func newTestUpdater(zone *testZone, provider odyn.IPProvider) *updater {
+	return &updater{
+		DNSClient:  odyn.NewDNSClient(),
+		DNSZone:    zone,
+		recordName: "home.example.com.",
+		zoneName:   "example.com.",
+		families:   []recordFamily{{"A", provider, dns.TypeA, odyn.UpdateAContext}},
+		publicIPs:  map[string]string{},
+		ctx:        context.Background(),
+	}
+}
+
+func TestMostSevere(t *testing.T) {
+	tests := []struct {
+		results []syncResult
+		result  syncResult
+	}{
+		{nil, syncUnchanged},
+		{[]syncResult{syncUnchanged, syncUnchanged}, syncUnchanged},
+		{[]syncResult{syncUnchanged, syncUpdated}, syncUpdated},
+		{[]syncResult{syncUpdated, syncIPDiscoveryFailed, syncUnchanged}, syncIPDiscoveryFailed},
+		{[]syncResult{syncZoneUpdateFailed, syncResolveFailed}, syncZoneUpdateFailed},
+		{[]syncResult{syncResolveFailed, syncPreHookFailed, syncUpdated}, syncPreHookFailed},
+	}
+
+	for i, tt := range tests {
+		if result := mostSevere(tt.results); result != tt.result {
+			t.Errorf("mostSevere returned %d instead of %d for case %02d", result, tt.result, i)
+		}
+	}
+}
+
+func TestUpdater_sync(t *testing.T) {
+	server, addr := startTestDNSServer(t, "home.example.com. 60 IN A 1.2.3.4")
+	defer server.Shutdown()
+
+	// nothing listens on the port of the unreachable nameserver
+	pc, _ := net.ListenPacket("udp", "127.0.0.1:0")
+	unreachable := pc.LocalAddr().String()
+	pc.Close()
+
+	errTest := errors.New("test error")
+	oldIP, newIP := &testProvider{ip: net.ParseIP("1.2.3.4")}, &testProvider{ip: net.ParseIP("5.6.7.8")}
+
+	tests := []struct {
+		name     string
+		zone     *testZone
+		provider odyn.IPProvider
+		result   syncResult
+	}{
+		{"unchanged", &testZone{nameservers: []string{addr}}, oldIP, syncUnchanged},
+		{"updated", &testZone{nameservers: []string{addr}}, newIP, syncUpdated},
+		{"discovery failure", &testZone{nameservers: []string{addr}}, &testProvider{err: errTest}, syncIPDiscoveryFailed},
+		{"resolution failure", &testZone{nameservers: []string{unreachable}}, newIP, syncResolveFailed},
+		{"zone update failure", &testZone{nameservers: []string{addr}, updateErr: errTest}, newIP, syncZoneUpdateFailed},
+		{"nameservers failure", &testZone{err: errTest}, newIP, syncZoneUpdateFailed},
+	}
+
+	for _, tt := range tests {
+		u := newTestUpdater(tt.zone, tt.provider)
+		if result := u.sync(); result != tt.result {
+			t.Errorf("updater.sync returned %d instead of %d on %s", result, tt.result, tt.name)
+		}
+	}
+
+	// the exit codes are documented and must not change
+	for result, code := range map[syncResult]int{syncUpdated: 10, syncIPDiscoveryFailed: 11, syncResolveFailed: 12, syncZoneUpdateFailed: 13} {
+		if int(result) != code {
+			t.Errorf("syncResult %d does not match the documented exit code %d", result, code)
+		}
+	}
+}
+
+func TestSyncOnce(t *testing.T) {
+	server, addr := startTestDNSServer(t, "home.example.com. 60 IN A 1.2.3.4")
+	defer server.Shutdown()
+
+	unchanged := func() *updater {
+		return newTestUpdater(&testZone{nameservers: []string{addr}}, &testProvider{ip: net.ParseIP("1.2.3.4")})
+	}
+	updated := func() *updater {
+		return newTestUpdater(&testZone{nameservers: []string{addr}}, &testProvider{ip: net.ParseIP("5.6.7.8")})
+	}
+	failed := func() *updater {
+		return newTestUpdater(&testZone{nameservers: []string{addr}}, &testProvider{err: errors.New("test error")})
+	}
+
+	tests := []struct {
+		updaters []*updater
+		result   syncResult
+	}{
+		{[]*updater{unchanged(), unchanged()}, syncUnchanged},
+		{[]*updater{unchanged(), updated(), unchanged()}, syncUpdated},
+		{[]*updater{updated(), failed(), unchanged()}, syncIPDiscoveryFailed},
+	}
+
+	for i, tt := range tests {
+		if result := syncOnce(tt.updaters); result != tt.result {
+			t.Errorf("syncOnce returned %d instead of %d for case %02d", result, tt.result, i)
+		}
+	}
+}
+
+func TestGetPublicIPProvider(t *testing.T) {
+	if p := getPublicIPProvider("ipify", "192.168.1.1"); p != ipifyProvider {
+		t.Errorf("getPublicIPProvider returned unexpected provider: %+v", p)
+	}
+
+	for _, name := range []string{"upnp", "natpmp", "pcp"} {
+		p, ok := getPublicIPProvider(name, "192.168.1.1").(*instrumentedProvider)
+		if !ok || p.name != name {
+			t.Errorf("getPublicIPProvider returned unexpected provider for %s: %+v", name, p)
+		}
+	}
+}
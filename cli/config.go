@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	defaultRecordInterval     = time.Minute
+	defaultRecordZoneProvider = "route53"
+	defaultRecordIPProvider   = "combined"
+)
+
+// config is the contents of the configuration file. It declares any number
+// of records, each kept up to date independently.
+//
+// An example configuration file:
+//
+//  {
+//    "records": [
+//      {
+//        "record": "home.example.com.",
+//        "zone": "example.com.",
+//        "zone_provider": "route53",
+//        "ip_provider": "combined",
+//        "ipv6_provider": "ipify",
+//        "gateway": "192.168.1.1",
+//        "ttl": 60,
+//        "interval": "1m",
+//        "pre_hook": ["/usr/local/bin/check-vpn"],
+//        "post_hook": ["/usr/local/bin/reload-firewall", "--quiet"],
+//        "hook_timeout": "10s",
+//        "abort_on_pre_hook_failure": true,
+//        "webhooks": ["https://hooks.example.com/odyn"],
+//        "slack_webhooks": ["https://hooks.slack.com/services/T000/B000/XXXX"],
+//        "failure_threshold": 5
+//      },
+//      {
+//        "record": "office.example.org.",
+//        "zone": "example.org.",
+//        "zone_provider": "cloudflare",
+//        "interval": "5m"
+//      }
+//    ]
+//  }
+type config struct {
+	Records []recordConfig `json:"records"`
+}
+
+// recordConfig describes a single record managed by odyn. Setting the IP
+// provider to "none" disables updating the A record, setting the IPv6 provider
+// to "none" disables updating the AAAA record.
+type recordConfig struct {
+	Record       string   `json:"record"`
+	Zone         string   `json:"zone"`
+	ZoneProvider string   `json:"zone_provider"`
+	IPProvider   string   `json:"ip_provider"`
+	IPv6Provider string   `json:"ipv6_provider"`
+	Gateway      string   `json:"gateway"`
+	TTL          int64    `json:"ttl"`
+	Interval     duration `json:"interval"`
+
+	// Commands to run before and after updating the record, see hook.
+	PreHook               []string `json:"pre_hook"`
+	PostHook              []string `json:"post_hook"`
+	HookTimeout           duration `json:"hook_timeout"`
+	AbortOnPreHookFailure bool     `json:"abort_on_pre_hook_failure"`
+
+	// Webhooks to notify when the record changes or fails to sync
+	// FailureThreshold times in a row.
+	Webhooks         []string `json:"webhooks"`
+	SlackWebhooks    []string `json:"slack_webhooks"`
+	FailureThreshold int      `json:"failure_threshold"`
+}
+
+// duration allows time.Duration values to be written as strings, e.g. "5m".
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+
+	return nil
+}
+
+// loadConfig reads the configuration file, using defaults for the settings
+// that a record leaves empty.
+func loadConfig(path string, defaults recordConfig) (*config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseConfig(f, defaults)
+}
+
+func parseConfig(r io.Reader, defaults recordConfig) (*config, error) {
+	cfg := &config{}
+	if err := json.NewDecoder(r).Decode(cfg); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Records) == 0 {
+		return nil, errors.New("no records declared")
+	}
+
+	for i := range cfg.Records {
+		cfg.Records[i].setDefaults(defaults)
+		if err := cfg.Records[i].validate(); err != nil {
+			return nil, fmt.Errorf("record %d: %v", i, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// setDefaults fills in the settings that the record leaves empty from
+// defaults, which holds the values of the command line flags.
+func (rc *recordConfig) setDefaults(defaults recordConfig) {
+	if rc.ZoneProvider == "" {
+		rc.ZoneProvider = defaults.ZoneProvider
+	}
+
+	// A records are managed unless explicitly disabled, AAAA records only
+	// when an IPv6 provider is set.
+	switch rc.IPProvider {
+	case "":
+		rc.IPProvider = defaults.IPProvider
+	case "none":
+		rc.IPProvider = ""
+	}
+
+	switch rc.IPv6Provider {
+	case "":
+		rc.IPv6Provider = defaults.IPv6Provider
+	case "none":
+		rc.IPv6Provider = ""
+	}
+
+	if rc.Gateway == "" {
+		rc.Gateway = defaults.Gateway
+	}
+
+	if len(rc.PreHook) == 0 {
+		rc.PreHook = defaults.PreHook
+	}
+
+	if len(rc.PostHook) == 0 {
+		rc.PostHook = defaults.PostHook
+	}
+
+	if rc.HookTimeout.Duration == 0 {
+		rc.HookTimeout = defaults.HookTimeout
+	}
+
+	rc.AbortOnPreHookFailure = rc.AbortOnPreHookFailure || defaults.AbortOnPreHookFailure
+
+	if len(rc.Webhooks) == 0 {
+		rc.Webhooks = defaults.Webhooks
+	}
+
+	if len(rc.SlackWebhooks) == 0 {
+		rc.SlackWebhooks = defaults.SlackWebhooks
+	}
+
+	if rc.FailureThreshold == 0 {
+		rc.FailureThreshold = defaults.FailureThreshold
+	}
+
+	if rc.Interval.Duration == 0 {
+		rc.Interval.Duration = defaultRecordInterval
+	}
+}
+
+func (rc *recordConfig) validate() error {
+	if rc.Zone == "" || rc.Record == "" {
+		return errors.New("both the zone and the record are required")
+	}
+
+	if rc.IPProvider == "" && rc.IPv6Provider == "" {
+		return errors.New("at least one of the public IP providers must be set")
+	}
+
+	if rc.Interval.Duration < 0 || rc.TTL < 0 || rc.HookTimeout.Duration < 0 || rc.FailureThreshold < 0 {
+		return errors.New("the interval, TTL, hook timeout and failure threshold must not be negative")
+	}
+
+	for _, u := range append(rc.Webhooks, rc.SlackWebhooks...) {
+		if p, err := url.Parse(u); err != nil || (p.Scheme != "http" && p.Scheme != "https") || p.Host == "" {
+			return fmt.Errorf("invalid webhook URL '%s'", u)
+		}
+	}
+
+	if rc.AbortOnPreHookFailure && len(rc.PreHook) == 0 {
+		return errors.New("aborting on pre-update hook failure requires a pre-update hook")
+	}
+
+	if _, ok := dnsProviders[rc.ZoneProvider]; !ok {
+		return fmt.Errorf("invalid zone provider '%s': must be one of: %s", rc.ZoneProvider, strings.Join(providerNames(dnsProviders), ", "))
+	}
+
+	if _, ok := publicipProviders[rc.IPProvider]; rc.IPProvider != "" && !ok {
+		return fmt.Errorf("invalid ip provider '%s': must be one of: %s", rc.IPProvider, strings.Join(providerNames(publicipProviders), ", "))
+	}
+
+	if _, ok := publicipv6Providers[rc.IPv6Provider]; rc.IPv6Provider != "" && !ok {
+		return fmt.Errorf("invalid ipv6 provider '%s': must be one of: %s", rc.IPv6Provider, strings.Join(providerNames(publicipv6Providers), ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDefaults holds the default values of the command line flags.
+var testDefaults = recordConfig{ZoneProvider: defaultRecordZoneProvider, IPProvider: defaultRecordIPProvider}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig(strings.NewReader(`{
+		"records": [
+			{
+				"record": "home.example.com.",
+				"zone": "example.com.",
+				"ip_provider": "none",
+				"ipv6_provider": "ipify",
+				"ttl": 300,
+				"interval": "5m",
+				"pre_hook": ["/bin/true"],
+				"post_hook": ["/bin/echo", "updated"],
+				"hook_timeout": "10s",
+				"abort_on_pre_hook_failure": true,
+				"webhooks": ["https://hooks.example.com/odyn"],
+				"slack_webhooks": ["https://hooks.slack.com/services/T000/B000/XXXX"],
+				"failure_threshold": 5
+			},
+			{
+				"record": "office.example.org.",
+				"zone": "example.org.",
+				"zone_provider": "cloudflare",
+				"ip_provider": "natpmp",
+				"gateway": "192.168.1.1"
+			}
+		]
+	}`), testDefaults)
+	if err != nil {
+		t.Fatalf("parseConfig returned unexpected error: %+v", err)
+	}
+
+	if len(cfg.Records) != 2 {
+		t.Fatalf("parseConfig returned %d records", len(cfg.Records))
+	}
+
+	home := cfg.Records[0]
+	if home.ZoneProvider != defaultRecordZoneProvider || home.IPProvider != "" || home.IPv6Provider != "ipify" || home.TTL != 300 || home.Interval.Duration != 5*time.Minute {
+		t.Errorf("parseConfig returned unexpected record: %+v", home)
+	}
+
+	if len(home.PreHook) != 1 || len(home.PostHook) != 2 || home.HookTimeout.Duration != 10*time.Second || !home.AbortOnPreHookFailure {
+		t.Errorf("parseConfig returned unexpected hooks: %+v", home)
+	}
+
+	if len(home.Webhooks) != 1 || len(home.SlackWebhooks) != 1 || home.FailureThreshold != 5 {
+		t.Errorf("parseConfig returned unexpected notifications: %+v", home)
+	}
+
+	office := cfg.Records[1]
+	if office.ZoneProvider != "cloudflare" || office.IPProvider != "natpmp" || office.Gateway != "192.168.1.1" || office.Interval.Duration != defaultRecordInterval {
+		t.Errorf("parseConfig returned unexpected record: %+v", office)
+	}
+}
+
+func TestParseConfig_defaultIPProvider(t *testing.T) {
+	cfg, err := parseConfig(strings.NewReader(`{"records": [{"record": "home.example.com.", "zone": "example.com.", "ipv6_provider": "ipify"}]}`), testDefaults)
+	if err != nil {
+		t.Fatalf("parseConfig returned unexpected error: %+v", err)
+	}
+
+	if cfg.Records[0].IPProvider != defaultRecordIPProvider {
+		t.Errorf("parseConfig did not set the default IP provider: %+v", cfg.Records[0])
+	}
+}
+
+func TestParseConfig_flagDefaults(t *testing.T) {
+	defaults := recordConfig{
+		ZoneProvider:     "cloudflare",
+		IPProvider:       "ipinfo",
+		IPv6Provider:     "ipify",
+		Gateway:          "192.168.1.1",
+		PreHook:          []string{"/bin/true"},
+		HookTimeout:      duration{10 * time.Second},
+		Webhooks:         []string{"https://hooks.example.com/odyn"},
+		FailureThreshold: 5,
+	}
+
+	cfg, err := parseConfig(strings.NewReader(`{
+		"records": [
+			{"record": "home.example.com.", "zone": "example.com."},
+			{
+				"record": "office.example.org.",
+				"zone": "example.org.",
+				"zone_provider": "route53",
+				"ipv6_provider": "none",
+				"webhooks": ["https://hooks.example.org/odyn"],
+				"failure_threshold": 2
+			}
+		]
+	}`), defaults)
+	if err != nil {
+		t.Fatalf("parseConfig returned unexpected error: %+v", err)
+	}
+
+	home := cfg.Records[0]
+	if home.ZoneProvider != "cloudflare" || home.IPProvider != "ipinfo" || home.IPv6Provider != "ipify" || home.Gateway != "192.168.1.1" {
+		t.Errorf("parseConfig did not use the defaults: %+v", home)
+	}
+
+	if len(home.PreHook) != 1 || home.HookTimeout.Duration != 10*time.Second || len(home.Webhooks) != 1 || home.FailureThreshold != 5 {
+		t.Errorf("parseConfig did not use the defaults: %+v", home)
+	}
+
+	office := cfg.Records[1]
+	if office.ZoneProvider != "route53" || office.IPv6Provider != "" || office.Webhooks[0] != "https://hooks.example.org/odyn" || office.FailureThreshold != 2 {
+		t.Errorf("parseConfig overrode the record settings: %+v", office)
+	}
+}
+
+func TestParseConfig_invalid(t *testing.T) {
+	testCases := []string{
+		`{"records": []}`,
+		`{"records": [{"zone": "example.com."}]}`,
+		`{"records": [{"record": "home.example.com.", "zone": "example.com.", "zone_provider": "unknown"}]}`,
+		`{"records": [{"record": "home.example.com.", "zone": "example.com.", "ip_provider": "unknown"}]}`,
+		`{"records": [{"record": "home.example.com.", "zone": "example.com.", "ipv6_provider": "ipinfo"}]}`,
+		`{"records": [{"record": "home.example.com.", "zone": "example.com.", "ip_provider": "none"}]}`,
+		`{"records": [{"record": "home.example.com.", "zone": "example.com.", "interval": "soon"}]}`,
+		`{"records": [{"record": "home.example.com.", "zone": "example.com.", "ttl": -1}]}`,
+		`{"records": [{"record": "home.example.com.", "zone": "example.com.", "abort_on_pre_hook_failure": true}]}`,
+		`{"records": [{"record": "home.example.com.", "zone": "example.com.", "webhooks": ["hooks.example.com"]}]}`,
+		`{"records": `,
+	}
+
+	for i, tc := range testCases {
+		if _, err := parseConfig(strings.NewReader(tc), testDefaults); err == nil {
+			t.Errorf("parseConfig did not return an error for case %02d", i)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"time"
+)
+
+var defaultHookTimeout = 30 * time.Second
+
+// hook is a command that is executed before or after a record is updated.
+//
+// The command receives the record, zone, old IP and new IP as its last four
+// arguments and, along with the hook name and the record type, in the
+// ODYN_HOOK, ODYN_RECORD, ODYN_ZONE, ODYN_RECORD_TYPE, ODYN_OLD_IP and
+// ODYN_NEW_IP environment variables. The command is run directly, not through
+// a shell, and is killed along with any processes it started if it does not
+// finish before the timeout.
+type hook struct {
+	name    string
+	command []string
+	timeout time.Duration
+}
+
+// hookEvent describes the record change that triggered a hook.
+type hookEvent struct {
+	record     string
+	zone       string
+	recordType string
+	oldIP      net.IP
+	newIP      net.IP
+}
+
+func newHook(name string, command []string, timeout time.Duration) *hook {
+	if len(command) == 0 {
+		return nil
+	}
+
+	if timeout == 0 {
+		timeout = defaultHookTimeout
+	}
+
+	return &hook{
+		name:    name,
+		command: command,
+		timeout: timeout,
+	}
+}
+
+// run executes the hook, logging its output, and returns an error if the
+// command fails or does not finish in time.
+func (h *hook) run(ctx context.Context, e hookEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	args := make([]string, 0, len(h.command)+3)
+	args = append(args, h.command[1:]...)
+	args = append(args, e.record, e.zone, ipString(e.oldIP), e.newIP.String())
+	cmd := exec.Command(h.command[0], args...)
+	cmd.Env = append(os.Environ(),
+		"ODYN_HOOK="+h.name,
+		"ODYN_RECORD="+e.record,
+		"ODYN_ZONE="+e.zone,
+		"ODYN_RECORD_TYPE="+e.recordType,
+		"ODYN_OLD_IP="+ipString(e.oldIP),
+		"ODYN_NEW_IP="+e.newIP.String(),
+	)
+	out := &bytes.Buffer{}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	setHookProcessGroup(cmd)
+
+	log.Printf("[DEBUG] %s: running %s-update hook: %s", e.record, h.name, h.command[0])
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// killing only the command would leave its children running and
+		// holding on to the output, so Wait would not return until they exit
+		if kerr := killHook(cmd); kerr != nil {
+			log.Printf("[ERROR] %s: could not kill %s-update hook: %+v", e.record, h.name, kerr)
+		}
+		<-done
+		err = ctx.Err()
+	}
+
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		log.Printf("[INFO] %s: %s-update hook: %s", e.record, h.name, scanner.Text())
+	}
+
+	return err
+}
@@ -0,0 +1,16 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import (
+	"os/exec"
+)
+
+// setHookProcessGroup does nothing, process groups are not supported.
+func setHookProcessGroup(cmd *exec.Cmd) {}
+
+// killHook kills the hook's process, processes it spawned keep running.
+func killHook(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
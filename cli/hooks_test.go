@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testHookEvent = hookEvent{
+	record:     "home.example.com.",
+	zone:       "example.com.",
+	recordType: "A",
+	oldIP:      net.ParseIP("1.1.1.1"),
+	newIP:      net.ParseIP("2.2.2.2"),
+}
+
+func TestNewHook_empty(t *testing.T) {
+	if h := newHook("pre", nil, 0); h != nil {
+		t.Errorf("newHook returned a hook without a command")
+	}
+
+	if h := newHook("pre", []string{"true"}, 0); h.timeout != defaultHookTimeout {
+		t.Errorf("newHook did not set the default timeout: %s", h.timeout)
+	}
+}
+
+func TestHook_run(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	h := newHook("post", []string{"sh", "-c", `echo "$ODYN_HOOK $ODYN_RECORD_TYPE $ODYN_OLD_IP $ODYN_NEW_IP $*"`, "hook"}, time.Second)
+	if err := h.run(context.Background(), testHookEvent); err != nil {
+		t.Fatalf("hook.run returned unexpected error: %+v", err)
+	}
+
+	expected := "post A 1.1.1.1 2.2.2.2 home.example.com. example.com. 1.1.1.1 2.2.2.2"
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("hook.run did not log the expected output, got: %s", buf.String())
+	}
+}
+
+func TestHook_run_failure(t *testing.T) {
+	h := newHook("pre", []string{"sh", "-c", "exit 3"}, time.Second)
+	if err := h.run(context.Background(), testHookEvent); err == nil {
+		t.Errorf("hook.run did not return an error")
+	}
+}
+
+func TestHook_run_timeout(t *testing.T) {
+	// sleep is a child of the shell rather than replacing it, so it has to be
+	// killed along with the shell for the hook to return in time
+	h := newHook("pre", []string{"sh", "-c", "sleep 5; true"}, 50*time.Millisecond)
+
+	start := time.Now()
+	if err := h.run(context.Background(), testHookEvent); err != context.DeadlineExceeded {
+		t.Errorf("hook.run returned unexpected error: %+v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("hook.run did not kill the hook's children, returned after %s", elapsed)
+	}
+}
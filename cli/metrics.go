@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alkar/odyn"
+)
+
+// The metrics are exposed in the Prometheus text exposition format. They are
+// always collected but only served when a metrics address is configured.
+var (
+	metricProviderDuration = newMetricVec("odyn_ip_provider_request_duration_seconds", "Time spent discovering the public IP address per provider.", metricSummary)
+	metricProviderErrors   = newMetricVec("odyn_ip_provider_errors_total", "Number of failed public IP address discoveries per provider.", metricCounter)
+	metricResolveDuration  = newMetricVec("odyn_dns_resolve_duration_seconds", "Time spent resolving the current records per nameserver.", metricSummary)
+	metricResolveErrors    = newMetricVec("odyn_dns_resolve_errors_total", "Number of failed record resolutions per nameserver.", metricCounter)
+	metricUpdates          = newMetricVec("odyn_record_updates_total", "Number of record updates performed.", metricCounter)
+	metricLastSync         = newMetricVec("odyn_last_successful_sync_timestamp_seconds", "Unix timestamp of the last successful sync per record.", metricGauge)
+	metricPublicIP         = newMetricVec("odyn_public_ip", "Public IP address last discovered per record, set to 1.", metricGauge)
+	metricRoute53Wait      = newMetricVec("odyn_route53_change_wait_seconds", "Time spent waiting for Route53 changes to propagate.", metricSummary)
+	metricRoute53Errors    = newMetricVec("odyn_route53_change_wait_errors_total", "Number of Route53 changes that could not be confirmed as propagated.", metricCounter)
+
+	allMetrics = []*metricVec{
+		metricProviderDuration,
+		metricProviderErrors,
+		metricResolveDuration,
+		metricResolveErrors,
+		metricUpdates,
+		metricLastSync,
+		metricPublicIP,
+		metricRoute53Wait,
+		metricRoute53Errors,
+	}
+)
+
+type metricKind string
+
+const (
+	metricCounter metricKind = "counter"
+	metricGauge   metricKind = "gauge"
+	metricSummary metricKind = "summary"
+)
+
+// metricVec is a metric with a set of values partitioned by labels.
+type metricVec struct {
+	sync.Mutex
+	name   string
+	help   string
+	kind   metricKind
+	values map[string]*metricValue
+}
+
+type metricValue struct {
+	value float64
+	count uint64
+}
+
+func newMetricVec(name, help string, kind metricKind) *metricVec {
+	return &metricVec{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		values: map[string]*metricValue{},
+	}
+}
+
+// labelValueReplacer escapes label values as the exposition format expects,
+// which only knows about backslashes, double quotes and line feeds.
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels renders pairs of label names and values, e.g. labels("a", "b")
+// returns {a="b"}.
+func labels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	l := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		l = append(l, pairs[i]+`="`+labelValueReplacer.Replace(pairs[i+1])+`"`)
+	}
+
+	return "{" + strings.Join(l, ",") + "}"
+}
+
+func (m *metricVec) get(labels string) *metricValue {
+	v, ok := m.values[labels]
+	if !ok {
+		v = &metricValue{}
+		m.values[labels] = v
+	}
+
+	return v
+}
+
+func (m *metricVec) inc(labels string) {
+	m.Lock()
+	defer m.Unlock()
+	m.get(labels).value++
+}
+
+func (m *metricVec) set(labels string, value float64) {
+	m.Lock()
+	defer m.Unlock()
+	m.get(labels).value = value
+}
+
+func (m *metricVec) delete(labels string) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.values, labels)
+}
+
+func (m *metricVec) observe(labels string, value float64) {
+	m.Lock()
+	defer m.Unlock()
+	v := m.get(labels)
+	v.value += value
+	v.count++
+}
+
+func (m *metricVec) write(w io.Writer) {
+	m.Lock()
+	defer m.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+
+	keys := make([]string, 0, len(m.values))
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := m.values[k]
+		if m.kind == metricSummary {
+			fmt.Fprintf(w, "%s_sum%s %s\n", m.name, k, formatMetricValue(v.value))
+			fmt.Fprintf(w, "%s_count%s %d\n", m.name, k, v.count)
+			continue
+		}
+
+		fmt.Fprintf(w, "%s%s %s\n", m.name, k, formatMetricValue(v.value))
+	}
+}
+
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	buf := &bytes.Buffer{}
+	for _, m := range allMetrics {
+		m.write(buf)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	buf.WriteTo(w)
+}
+
+// startMetricsServer serves the metrics on addr in the background.
+func startMetricsServer(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", serveMetrics)
+
+	go func() {
+		log.Printf("[INFO] serving metrics on %s/metrics", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("[ERROR] metrics server stopped: %+v", err)
+		}
+	}()
+}
+
+// instrumentedProvider records the latency and errors of an IPProvider.
+type instrumentedProvider struct {
+	odyn.IPProvider
+	name string
+}
+
+func instrumentProvider(name string, p odyn.IPProvider) odyn.IPProvider {
+	return &instrumentedProvider{IPProvider: p, name: name}
+}
+
+func (p *instrumentedProvider) Get() (net.IP, error) {
+	return p.GetContext(context.Background())
+}
+
+func (p *instrumentedProvider) GetContext(ctx context.Context) (net.IP, error) {
+	start := time.Now()
+	ip, err := odyn.GetContext(ctx, p.IPProvider)
+	metricProviderDuration.observe(labels("provider", p.name), time.Since(start).Seconds())
+	if err != nil {
+		metricProviderErrors.inc(labels("provider", p.name))
+	}
+
+	return ip, err
+}
+
+func observeRoute53Wait(wait time.Duration, err error) {
+	metricRoute53Wait.observe(labels(), wait.Seconds())
+	if err != nil {
+		metricRoute53Errors.inc(labels())
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+type testProvider struct {
+	ip  net.IP
+	err error
+}
+
+func (p *testProvider) Get() (net.IP, error) {
+	return p.GetContext(context.Background())
+}
+
+func (p *testProvider) GetContext(ctx context.Context) (net.IP, error) {
+	return p.ip, p.err
+}
+
+func TestLabels(t *testing.T) {
+	if l := labels(); l != "" {
+		t.Errorf("labels returned unexpected value: %s", l)
+	}
+
+	if l := labels("record", "home.example.com.", "type", `A"`); l != `{record="home.example.com.",type="A\""}` {
+		t.Errorf("labels returned unexpected value: %s", l)
+	}
+
+	// only backslashes, double quotes and line feeds are escaped
+	if l := labels("error", "a\\b\ncafé\t"); l != "{error=\"a\\\\b\\ncafé\t\"}" {
+		t.Errorf("labels returned unexpected value: %s", l)
+	}
+}
+
+func TestObserveRoute53Wait(t *testing.T) {
+	count := func() float64 {
+		metricRoute53Errors.Lock()
+		defer metricRoute53Errors.Unlock()
+		return metricRoute53Errors.get(labels()).value
+	}
+	before := count()
+
+	observeRoute53Wait(time.Second, nil)
+	if count() != before {
+		t.Errorf("observeRoute53Wait counted a successful wait as an error")
+	}
+
+	observeRoute53Wait(time.Second, errors.New("timed out"))
+	if count() != before+1 {
+		t.Errorf("observeRoute53Wait did not count the failed wait")
+	}
+}
+
+func TestMetricVec_write(t *testing.T) {
+	counter := newMetricVec("test_total", "A test counter.", metricCounter)
+	counter.inc(labels("a", "2"))
+	counter.inc(labels("a", "1"))
+	counter.inc(labels("a", "1"))
+
+	summary := newMetricVec("test_seconds", "A test summary.", metricSummary)
+	summary.observe(labels(), 0.5)
+	summary.observe(labels(), 1)
+
+	buf := &bytes.Buffer{}
+	counter.write(buf)
+	summary.write(buf)
+
+	expected := `# HELP test_total A test counter.
+# TYPE test_total counter
+test_total{a="1"} 2
+test_total{a="2"} 1
+# HELP test_seconds A test summary.
+# TYPE test_seconds summary
+test_seconds_sum 1.5
+test_seconds_count 2
+`
+	if buf.String() != expected {
+		t.Errorf("metricVec.write returned unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestInstrumentedProvider(t *testing.T) {
+	ok := instrumentProvider("test-ok", &testProvider{ip: net.ParseIP("1.1.1.1")})
+	broken := instrumentProvider("test-broken", &testProvider{err: errors.New("test error")})
+
+	ok.Get()
+	broken.Get()
+	broken.Get()
+
+	if v := metricProviderDuration.values[labels("provider", "test-ok")]; v == nil || v.count != 1 {
+		t.Errorf("instrumentedProvider did not record the request duration")
+	}
+
+	if v := metricProviderErrors.values[labels("provider", "test-ok")]; v != nil {
+		t.Errorf("instrumentedProvider recorded unexpected errors")
+	}
+
+	if v := metricProviderErrors.values[labels("provider", "test-broken")]; v == nil || v.value != 2 {
+		t.Errorf("instrumentedProvider did not record the errors")
+	}
+}
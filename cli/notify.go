@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+var (
+	defaultFailureThreshold = 3
+	notifyTimeout           = 10 * time.Second
+)
+
+// notification describes either a record change or a record that has failed
+// to sync multiple times in a row, in which case Error is set.
+type notification struct {
+	Record     string    `json:"record"`
+	Zone       string    `json:"zone"`
+	RecordType string    `json:"type,omitempty"`
+	OldIP      string    `json:"old_ip,omitempty"`
+	NewIP      string    `json:"new_ip,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+	Error      string    `json:"error,omitempty"`
+	Failures   int       `json:"failures,omitempty"`
+}
+
+// text renders the notification as a human readable message.
+func (n *notification) text() string {
+	if n.Error != "" {
+		return fmt.Sprintf("odyn failed to sync %s (zone %s) %d times in a row: %s", n.Record, n.Zone, n.Failures, n.Error)
+	}
+
+	if n.OldIP == "" {
+		return fmt.Sprintf("odyn created the %s record of %s (zone %s) pointing to %s", n.RecordType, n.Record, n.Zone, n.NewIP)
+	}
+
+	return fmt.Sprintf("odyn updated the %s record of %s (zone %s) from %s to %s", n.RecordType, n.Record, n.Zone, n.OldIP, n.NewIP)
+}
+
+type notifier interface {
+	notify(ctx context.Context, n *notification) error
+}
+
+// webhookNotifier POSTs the notification as JSON to a URL.
+type webhookNotifier struct {
+	url string
+}
+
+func (w *webhookNotifier) notify(ctx context.Context, n *notification) error {
+	return postJSON(ctx, w.url, n)
+}
+
+// slackNotifier posts the notification as a message to a Slack-compatible
+// incoming webhook.
+type slackNotifier struct {
+	url string
+}
+
+func (s *slackNotifier) notify(ctx context.Context, n *notification) error {
+	return postJSON(ctx, s.url, map[string]string{"text": n.text()})
+}
+
+func postJSON(ctx context.Context, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func newNotifiers(rc recordConfig) []notifier {
+	var notifiers []notifier
+	for _, url := range rc.Webhooks {
+		notifiers = append(notifiers, &webhookNotifier{url})
+	}
+	for _, url := range rc.SlackWebhooks {
+		notifiers = append(notifiers, &slackNotifier{url})
+	}
+
+	return notifiers
+}
+
+// notify sends the notification to all the updater's notifiers, logging any
+// errors.
+func (u *updater) notify(n *notification) {
+	n.Record = u.recordName
+	n.Zone = u.zoneName
+	n.Timestamp = time.Now().UTC()
+
+	ctx, cancel := context.WithTimeout(u.ctx, notifyTimeout)
+	defer cancel()
+
+	for _, nt := range u.notifiers {
+		if err := nt.notify(ctx, n); err != nil {
+			log.Printf("[ERROR] %s: could not send notification: %+v", u.recordName, err)
+		}
+	}
+}
+
+// trackFailures counts consecutive failed syncs and sends a notification
+// once they reach the failure threshold.
+func (u *updater) trackFailures(result syncResult) {
+	if result <= syncUpdated {
+		u.failures = 0
+		return
+	}
+
+	u.failures++
+	if u.failures != u.failureThreshold {
+		return
+	}
+
+	msg := "unknown error"
+	if u.lastError != nil {
+		msg = u.lastError.Error()
+	}
+	u.notify(&notification{Error: msg, Failures: u.failures})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testNotifier struct {
+	notifications []*notification
+}
+
+func (n *testNotifier) notify(ctx context.Context, nt *notification) error {
+	n.notifications = append(n.notifications, nt)
+	return nil
+}
+
+func TestWebhookNotifier_notify(t *testing.T) {
+	var received notification
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer ts.Close()
+
+	n := &notification{Record: "home.example.com.", Zone: "example.com.", RecordType: "A", OldIP: "1.1.1.1", NewIP: "2.2.2.2"}
+	if err := (&webhookNotifier{ts.URL}).notify(context.Background(), n); err != nil {
+		t.Fatalf("webhookNotifier.notify returned unexpected error: %+v", err)
+	}
+
+	if received.Record != n.Record || received.OldIP != n.OldIP || received.NewIP != n.NewIP {
+		t.Errorf("webhookNotifier.notify sent unexpected payload: %+v", received)
+	}
+}
+
+func TestSlackNotifier_notify(t *testing.T) {
+	var received map[string]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer ts.Close()
+
+	n := &notification{Record: "home.example.com.", Zone: "example.com.", Error: "timeout", Failures: 3}
+	if err := (&slackNotifier{ts.URL}).notify(context.Background(), n); err != nil {
+		t.Fatalf("slackNotifier.notify returned unexpected error: %+v", err)
+	}
+
+	if !strings.Contains(received["text"], "home.example.com.") || !strings.Contains(received["text"], "3 times in a row: timeout") {
+		t.Errorf("slackNotifier.notify sent unexpected message: %+v", received)
+	}
+}
+
+func TestWebhookNotifier_notify_status(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	if err := (&webhookNotifier{ts.URL}).notify(context.Background(), &notification{}); err == nil {
+		t.Errorf("webhookNotifier.notify did not return an error")
+	}
+}
+
+func TestUpdater_trackFailures(t *testing.T) {
+	n := &testNotifier{}
+	u := &updater{
+		recordName:       "home.example.com.",
+		zoneName:         "example.com.",
+		ctx:              context.Background(),
+		notifiers:        []notifier{n},
+		failureThreshold: 2,
+		lastError:        errors.New("timeout"),
+	}
+
+	for _, r := range []syncResult{syncIPDiscoveryFailed, syncUnchanged, syncResolveFailed, syncZoneUpdateFailed, syncZoneUpdateFailed} {
+		u.trackFailures(r)
+	}
+
+	if len(n.notifications) != 1 {
+		t.Fatalf("updater.trackFailures sent %d notifications", len(n.notifications))
+	}
+
+	if nt := n.notifications[0]; nt.Error != "timeout" || nt.Failures != 2 || nt.Record != "home.example.com." {
+		t.Errorf("updater.trackFailures sent unexpected notification: %+v", nt)
+	}
+}
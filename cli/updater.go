@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alkar/odyn"
+	"github.com/miekg/dns"
+)
+
+// syncResult is the outcome of a sync. The values double as the exit codes
+// of odyn when running once and are ordered by severity, so that the outcome
+// of multiple syncs is the highest of their results. Other than syncUnchanged
+// they start at 10 to stay clear of the exit codes used for invalid usage.
+type syncResult int
+
+const (
+	syncUnchanged         syncResult = 0
+	syncUpdated           syncResult = 10
+	syncIPDiscoveryFailed syncResult = 11
+	syncResolveFailed     syncResult = 12
+	syncZoneUpdateFailed  syncResult = 13
+	syncPreHookFailed     syncResult = 14
+)
+
+type updater struct {
+	*odyn.DNSClient
+	odyn.DNSZone
+	zoneName     string
+	zoneProvider string
+	recordName   string
+	ttl          int64
+	interval     time.Duration
+	families     []recordFamily
+	publicIPs    map[string]string
+	ctx          context.Context
+	cancel       context.CancelFunc
+
+	// dryRun makes the updater print the changes it would make instead of
+	// updating the DNS zone.
+	dryRun bool
+
+	preHook               *hook
+	postHook              *hook
+	abortOnPreHookFailure bool
+
+	notifiers        []notifier
+	failureThreshold int
+	failures         int
+	lastError        error
+}
+
+// recordFamily holds everything needed to keep a record of a single address
+// family (A or AAAA) in sync, independently of the other.
+type recordFamily struct {
+	recordType string
+	ipProvider odyn.IPProvider
+	qtype      uint16
+	update     func(ctx context.Context, z odyn.DNSZone, recordName string, zoneName string, ip net.IP) error
+}
+
+// newUpdater creates an updater for the record described by rc. The updater
+// stops when either the parent context is cancelled or stop is called.
+func newUpdater(parent context.Context, rc recordConfig, dryRun bool) *updater {
+	ctx, cancel := context.WithCancel(parent)
+	u := &updater{
+		DNSClient:    odyn.NewDNSClient(),
+		DNSZone:      getDNSZoneProvider(rc.ZoneProvider, rc.TTL),
+		zoneName:     rc.Zone,
+		zoneProvider: rc.ZoneProvider,
+		recordName:   rc.Record,
+		ttl:          rc.TTL,
+		interval:     rc.Interval.Duration,
+		publicIPs:    map[string]string{},
+		ctx:          ctx,
+		cancel:       cancel,
+		dryRun:       dryRun,
+
+		preHook:               newHook("pre", rc.PreHook, rc.HookTimeout.Duration),
+		postHook:              newHook("post", rc.PostHook, rc.HookTimeout.Duration),
+		abortOnPreHookFailure: rc.AbortOnPreHookFailure,
+
+		notifiers:        newNotifiers(rc),
+		failureThreshold: rc.FailureThreshold,
+	}
+
+	if u.interval == 0 {
+		u.interval = defaultRecordInterval
+	}
+
+	if u.failureThreshold == 0 {
+		u.failureThreshold = defaultFailureThreshold
+	}
+
+	if rc.IPProvider != "" {
+		u.families = append(u.families, recordFamily{"A", getPublicIPProvider(rc.IPProvider, rc.Gateway), dns.TypeA, odyn.UpdateAContext})
+	}
+
+	if rc.IPv6Provider != "" {
+		u.families = append(u.families, recordFamily{"AAAA", getPublicIPv6Provider(rc.IPv6Provider), dns.TypeAAAA, odyn.UpdateAAAAContext})
+	}
+
+	return u
+}
+
+func (u *updater) start() {
+	tick := time.NewTicker(u.interval)
+	defer tick.Stop()
+	u.sync()
+	for {
+		select {
+		case <-tick.C:
+			u.sync()
+		case <-u.ctx.Done():
+			return
+		}
+	}
+}
+
+// stop cancels the updater's context, aborting any sync that is in progress.
+func (u *updater) stop() {
+	u.cancel()
+}
+
+func (u *updater) sync() syncResult {
+	result := u.syncFamilies()
+	if !u.dryRun {
+		u.trackFailures(result)
+	}
+
+	return result
+}
+
+func (u *updater) syncFamilies() syncResult {
+	zoneNameservers, err := odyn.NameserversContext(u.ctx, u.DNSZone, u.zoneName)
+	if err != nil {
+		// the zone provider is failing, much like when updating the record
+		log.Printf("[ERROR] %s: could not get dns zone's nameservers: %+v", u.recordName, err)
+		u.lastError = err
+		return syncZoneUpdateFailed
+	}
+	for i, ns := range zoneNameservers {
+		if _, _, err := net.SplitHostPort(ns); err != nil {
+			zoneNameservers[i] = net.JoinHostPort(ns, "53")
+		}
+	}
+
+	result := syncUnchanged
+	for _, f := range u.families {
+		if u.ctx.Err() != nil {
+			break
+		}
+
+		if r := u.syncFamily(f, zoneNameservers); r > result {
+			result = r
+		}
+	}
+
+	if result <= syncUpdated {
+		metricLastSync.set(labels("record", u.recordName), float64(time.Now().Unix()))
+	}
+
+	return result
+}
+
+// resolve asks all of the nameservers for the current record at once,
+// recording the latency of each, and returns the results along with the
+// addresses of the first nameserver that answered. No addresses and no error
+// are returned when the record does not exist yet. CNAMEs are followed to
+// find out whether the record is one, in which case an error is returned as
+// updating it would replace the CNAME.
+func (u *updater) resolve(f recordFamily, nameservers []string) ([]net.IP, odyn.DNSResults, error) {
+	results := u.ResolveAllContext(u.ctx, u.recordName, f.qtype, nameservers)
+	if err := u.ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var err error
+	missing := false
+	for _, r := range results {
+		metricResolveDuration.observe(labels("nameserver", r.Nameserver), r.RTT.Seconds())
+		switch {
+		case r.Empty():
+			missing = true
+		case r.Err != nil:
+			metricResolveErrors.inc(labels("nameserver", r.Nameserver))
+			err = r.Err
+		}
+	}
+
+	first := results.First()
+	if first == nil {
+		if missing {
+			return nil, results, nil
+		}
+		return nil, results, err
+	}
+
+	if len(first.Chain) > 1 {
+		// updating the record would replace the CNAME rather than change the
+		// address it resolves to
+		return nil, results, fmt.Errorf("the record is a CNAME, resolved through %s, manage %s instead", strings.Join(first.Chain, " -> "), first.Chain[len(first.Chain)-1])
+	}
+
+	return first.IPs, results, nil
+}
+
+// propagating reports whether some of the nameservers already answer with ip
+// while others do not, i.e. a change to ip has not reached all of them yet.
+func propagating(results odyn.DNSResults, ip net.IP) bool {
+	if results.Consistent() {
+		return false
+	}
+
+	for _, r := range results {
+		for _, i := range r.IPs {
+			if i.Equal(ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// setPublicIP exposes the public IP address discovered for a record type.
+func (u *updater) setPublicIP(recordType string, ip net.IP) {
+	if last, ok := u.publicIPs[recordType]; ok {
+		metricPublicIP.delete(labels("record", u.recordName, "type", recordType, "ip", last))
+	}
+
+	u.publicIPs[recordType] = ip.String()
+	metricPublicIP.set(labels("record", u.recordName, "type", recordType, "ip", ip.String()), 1)
+}
+
+func (u *updater) syncFamily(f recordFamily, zoneNameservers []string) syncResult {
+	ipRecord, results, err := u.resolve(f, zoneNameservers)
+	if err != nil {
+		log.Printf("[INFO] %s: could not resolve current DNS %s record, ignoring error: %+v", u.recordName, f.recordType, err)
+		u.lastError = err
+		return syncResolveFailed
+	}
+	if len(ipRecord) > 1 {
+		log.Printf("[INFO] %s: nameserver replied with multiple IP addresses, will use the first: %+v", u.recordName, ipRecord)
+	}
+
+	// ipOld is nil when the record does not exist yet
+	var ipOld net.IP
+	if len(ipRecord) > 0 {
+		ipOld = ipRecord[0]
+	}
+
+	ipCurrent, err := odyn.GetContext(u.ctx, f.ipProvider)
+	if err != nil {
+		log.Printf("[ERROR] %s: could not get public IP address for %s record: %+v", u.recordName, f.recordType, err)
+		u.lastError = err
+		return syncIPDiscoveryFailed
+	}
+	u.setPublicIP(f.recordType, ipCurrent)
+
+	if !results.Consistent() {
+		log.Printf("[INFO] %s: nameservers disagree on the %s record: %s", u.recordName, f.recordType, results)
+	}
+
+	isPropagating := propagating(results, ipCurrent)
+	if u.dryRun {
+		u.printPlan(f.recordType, ipOld, ipCurrent, isPropagating)
+	}
+
+	if isPropagating {
+		log.Printf("[INFO] %s: %s record change is still propagating to the nameservers, will not update it again", u.recordName, f.recordType)
+		return syncUnchanged
+	}
+
+	if ipCurrent.Equal(ipOld) {
+		log.Printf("[DEBUG] %s: current public IP address is already registered with the nameservers, will not update %s record", u.recordName, f.recordType)
+		return syncUnchanged
+	}
+
+	if u.dryRun {
+		return syncUpdated
+	}
+
+	event := hookEvent{
+		record:     u.recordName,
+		zone:       u.zoneName,
+		recordType: f.recordType,
+		oldIP:      ipOld,
+		newIP:      ipCurrent,
+	}
+
+	if u.preHook != nil {
+		if err := u.preHook.run(u.ctx, event); err != nil {
+			if u.abortOnPreHookFailure {
+				log.Printf("[ERROR] %s: pre-update hook failed, will not update %s record: %+v", u.recordName, f.recordType, err)
+				u.lastError = err
+				return syncPreHookFailed
+			}
+			log.Printf("[ERROR] %s: pre-update hook failed, ignoring error: %+v", u.recordName, err)
+		}
+	}
+
+	if ipOld == nil {
+		log.Printf("[INFO] %s: %s record does not exist, creating it ...", u.recordName, f.recordType)
+	} else {
+		log.Printf("[INFO] %s: IP address has changed, updating %s record ...", u.recordName, f.recordType)
+	}
+	err = f.update(u.ctx, u.DNSZone, u.recordName, u.zoneName, ipCurrent)
+	if err != nil {
+		log.Printf("[ERROR] %s: failed to update the DNS %s record, will try again in %s: %+v", u.recordName, f.recordType, u.interval, err)
+		u.lastError = err
+		return syncZoneUpdateFailed
+	}
+	log.Printf("[INFO] %s: updated the DNS %s record to point to: %+v", u.recordName, f.recordType, ipCurrent)
+	metricUpdates.inc(labels("record", u.recordName, "type", f.recordType))
+	u.notify(&notification{RecordType: f.recordType, OldIP: ipString(ipOld), NewIP: ipCurrent.String()})
+
+	if u.postHook != nil {
+		if err := u.postHook.run(u.ctx, event); err != nil {
+			log.Printf("[ERROR] %s: post-update hook failed: %+v", u.recordName, err)
+		}
+	}
+
+	return syncUpdated
+}
+
+// printPlan prints the change that a sync would make to the record, which
+// does not exist yet if ipRecord is nil. No change is made while a change to
+// ipCurrent is propagating.
+func (u *updater) printPlan(recordType string, ipRecord, ipCurrent net.IP, propagating bool) {
+	ttl := "default"
+	if u.ttl != 0 {
+		ttl = strconv.FormatInt(u.ttl, 10)
+	}
+
+	current := "none"
+	if ipRecord != nil {
+		current = ipRecord.String()
+	}
+
+	change := "no change"
+	switch {
+	case propagating:
+		change = "no change: propagating"
+	case !ipCurrent.Equal(ipRecord):
+		change = current + " -> " + ipCurrent.String()
+	}
+
+	fmt.Printf("record=%s zone=%s provider=%s type=%s ttl=%s current=%s discovered=%s change: %s\n",
+		u.recordName, u.zoneName, u.zoneProvider, recordType, ttl, current, ipCurrent, change)
+}
+
+// ipString returns the text form of ip, or an empty string if it is nil.
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+
+	return ip.String()
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alkar/odyn"
+	"github.com/miekg/dns"
+)
+
+// startTestDNSServer runs a nameserver answering with the given records.
+func startTestDNSServer(t *testing.T, records ...string) (*dns.Server, string) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+
+	server := &dns.Server{
+		PacketConn: pc,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(req)
+			for _, r := range records {
+				rr, _ := dns.NewRR(r)
+				m.Answer = append(m.Answer, rr)
+			}
+			w.WriteMsg(m)
+		}),
+	}
+
+	waitLock := sync.Mutex{}
+	waitLock.Lock()
+	server.NotifyStartedFunc = waitLock.Unlock
+	go server.ActivateAndServe()
+	waitLock.Lock()
+
+	return server, pc.LocalAddr().String()
+}
+
+func TestPropagating(t *testing.T) {
+	oldIP, newIP := net.ParseIP("1.2.3.4"), net.ParseIP("5.6.7.8")
+
+	tests := []struct {
+		results     odyn.DNSResults
+		propagating bool
+	}{
+		{odyn.DNSResults{{IPs: []net.IP{oldIP}}, {IPs: []net.IP{oldIP}}}, false},
+		{odyn.DNSResults{{IPs: []net.IP{newIP}}, {IPs: []net.IP{newIP}}}, false},
+		{odyn.DNSResults{{IPs: []net.IP{oldIP}}, {IPs: []net.IP{newIP}}}, true},
+		{odyn.DNSResults{{IPs: []net.IP{newIP}}, {IPs: []net.IP{oldIP}}}, true},
+		{odyn.DNSResults{{IPs: []net.IP{oldIP}}, {IPs: []net.IP{net.ParseIP("9.9.9.9")}}}, false},
+	}
+
+	for _, test := range tests {
+		if p := propagating(test.results, newIP); p != test.propagating {
+			t.Errorf("propagating returned %v for: %s", p, test.results)
+		}
+	}
+}
+
+func TestUpdater_resolve(t *testing.T) {
+	server, addr := startTestDNSServer(t, "home.example.com. 60 IN A 1.2.3.4")
+	defer server.Shutdown()
+
+	u := &updater{DNSClient: odyn.NewDNSClient(), recordName: "home.example.com.", ctx: context.Background()}
+	ips, _, err := u.resolve(recordFamily{recordType: "A", qtype: dns.TypeA}, []string{addr})
+	if err != nil || len(ips) != 1 || !ips[0].Equal(net.ParseIP("1.2.3.4")) {
+		t.Errorf("updater.resolve returned unexpected result: %+v, %+v", ips, err)
+	}
+}
+
+func TestUpdater_resolve_cname(t *testing.T) {
+	server, addr := startTestDNSServer(t,
+		"home.example.com. 60 IN CNAME router.example.net.",
+		"router.example.net. 60 IN A 1.2.3.4",
+	)
+	defer server.Shutdown()
+
+	u := &updater{DNSClient: odyn.NewDNSClient(), recordName: "home.example.com.", ctx: context.Background()}
+	_, _, err := u.resolve(recordFamily{recordType: "A", qtype: dns.TypeA}, []string{addr})
+	if err == nil || !strings.Contains(err.Error(), "manage router.example.net. instead") {
+		t.Errorf("updater.resolve returned unexpected error: %+v", err)
+	}
+}
+
+func TestUpdater_resolve_missing(t *testing.T) {
+	server, addr := startTestDNSServer(t, "home.example.com. 60 IN A 1.2.3.4")
+	defer server.Shutdown()
+
+	// the name exists, but has no AAAA record
+	u := &updater{DNSClient: odyn.NewDNSClient(), recordName: "home.example.com.", ctx: context.Background()}
+	ips, _, err := u.resolve(recordFamily{recordType: "AAAA", qtype: dns.TypeAAAA}, []string{addr})
+	if err != nil || ips != nil {
+		t.Errorf("updater.resolve returned unexpected result: %+v, %+v", ips, err)
+	}
+}
+
+func TestUpdater_syncFamily_create(t *testing.T) {
+	server, addr := startTestDNSServer(t, "home.example.com. 60 IN A 1.2.3.4")
+	defer server.Shutdown()
+
+	var updated net.IP
+	f := recordFamily{
+		recordType: "AAAA",
+		ipProvider: &testProvider{ip: net.ParseIP("2001:db8::1")},
+		qtype:      dns.TypeAAAA,
+		update: func(ctx context.Context, z odyn.DNSZone, recordName string, zoneName string, ip net.IP) error {
+			updated = ip
+			return nil
+		},
+	}
+
+	u := &updater{DNSClient: odyn.NewDNSClient(), recordName: "home.example.com.", publicIPs: map[string]string{}, ctx: context.Background()}
+	if result := u.syncFamily(f, []string{addr}); result != syncUpdated {
+		t.Errorf("updater.syncFamily returned unexpected result: %d", result)
+	}
+
+	if !updated.Equal(net.ParseIP("2001:db8::1")) {
+		t.Errorf("updater.syncFamily did not create the record: %+v", updated)
+	}
+}
+
+// captureStdout returns what fn prints to the standard output.
+func captureStdout(fn func()) string {
+	r, w, _ := os.Pipe()
+	stdout := os.Stdout
+	os.Stdout = w
+	fn()
+	os.Stdout = stdout
+	w.Close()
+
+	out, _ := ioutil.ReadAll(r)
+	return string(out)
+}
+
+func TestUpdater_syncFamily_dryRun(t *testing.T) {
+	oldServer, oldAddr := startTestDNSServer(t, "home.example.com. 60 IN A 1.2.3.4")
+	defer oldServer.Shutdown()
+	newServer, newAddr := startTestDNSServer(t, "home.example.com. 60 IN A 5.6.7.8")
+	defer newServer.Shutdown()
+
+	tests := []struct {
+		recordType  string
+		ip          string
+		nameservers []string
+		plan        string
+	}{
+		{"A", "5.6.7.8", []string{oldAddr}, "current=1.2.3.4 discovered=5.6.7.8 change: 1.2.3.4 -> 5.6.7.8"},
+		{"A", "5.6.7.8", []string{newAddr, oldAddr}, "current=5.6.7.8 discovered=5.6.7.8 change: no change: propagating"},
+		{"AAAA", "2001:db8::1", []string{oldAddr}, "current=none discovered=2001:db8::1 change: none -> 2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		f := recordFamily{
+			recordType: tt.recordType,
+			ipProvider: &testProvider{ip: net.ParseIP(tt.ip)},
+			qtype:      dns.StringToType[tt.recordType],
+			update: func(ctx context.Context, z odyn.DNSZone, recordName string, zoneName string, ip net.IP) error {
+				t.Errorf("updater.syncFamily updated the record during a dry run")
+				return nil
+			},
+		}
+
+		u := &updater{DNSClient: odyn.NewDNSClient(), recordName: "home.example.com.", publicIPs: map[string]string{}, ctx: context.Background(), dryRun: true}
+		out := captureStdout(func() { u.syncFamily(f, tt.nameservers) })
+		if !strings.Contains(out, "type="+tt.recordType+" ttl=default "+tt.plan+"\n") {
+			t.Errorf("updater.syncFamily printed unexpected plan: %q", out)
+		}
+	}
+}
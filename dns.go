@@ -15,8 +15,13 @@
 package odyn
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/miekg/dns"
 )
@@ -25,44 +30,274 @@ var (
 	// ErrDNSEmptyAnswer is returned when the DNS client receives an empty
 	// response from the nameservers.
 	ErrDNSEmptyAnswer = errors.New("DNS nameserver returned an empty answer")
+
+	// ErrDNSCouldNotParseIP is returned when the answer of the DNS
+	// nameserver includes records that do not contain a valid IP address.
+	ErrDNSCouldNotParseIP = errors.New("could not parse IP address from the DNS answer")
+
+	// ErrDNSNameError is returned when the DNS nameserver replies that the
+	// name does not exist (NXDOMAIN).
+	ErrDNSNameError = errors.New("DNS nameserver returned NXDOMAIN")
+
+	// ErrDNSServerFailure is returned when the DNS nameserver could not
+	// process the query (SERVFAIL).
+	ErrDNSServerFailure = errors.New("DNS nameserver returned SERVFAIL")
+
+	// ErrDNSRefused is returned when the DNS nameserver refuses to answer
+	// the query (REFUSED).
+	ErrDNSRefused = errors.New("DNS nameserver returned REFUSED")
+
+	// ErrDNSCNAMELoop is returned when a CNAME chain loops or is longer than
+	// the resolver is willing to follow.
+	ErrDNSCNAMELoop = errors.New("DNS CNAME chain loops or is too long")
+
+	// maxDNSCNAMEChain is the maximum number of names in a CNAME chain,
+	// including the name that was queried.
+	maxDNSCNAMEChain = 8
+
+	defaultDNSClientHTTPClient   = &http.Client{}
+	defaultDNSClientUDPSize      = uint16(1232)
+	defaultDNSClientQueryTimeout = 2 * time.Second
+	defaultDNSClientRetries      = 1
 )
 
+// DNSRcodeError is returned when the DNS nameserver replies with an rcode
+// other than NOERROR, NXDOMAIN, SERVFAIL and REFUSED.
+type DNSRcodeError struct {
+	Rcode int
+}
+
+func (e *DNSRcodeError) Error() string {
+	return fmt.Sprintf("DNS nameserver returned %s", dns.RcodeToString[e.Rcode])
+}
+
 // DNSClient provides easy to use DNS resolving methods.
+//
+// Nameservers are addressed either as host:port, queried over UDP, or as URLs
+// selecting the transport: udp://host[:port], tcp://host[:port],
+// tls://host[:port] for DNS over TLS and https://host/path for DNS over HTTPS.
+//
+// Queries advertise EDNS0 with the UDP size of the client and are sent again
+// over TCP when the UDP response is truncated.
 type DNSClient struct {
 	*dns.Client
+
+	// HTTP Client used for DNS over HTTPS queries.
+	HTTPClient *http.Client
+
+	// QueryTimeout is the time to wait for a nameserver to respond to a
+	// single query. Zero means no timeout other than the context's.
+	QueryTimeout time.Duration
+
+	// Retries is the number of times a query is sent again to the same
+	// nameserver when it times out or fails with a network error.
+	Retries int
 }
 
 // NewDNSClient instantiates a new DNS client.
 func NewDNSClient() *DNSClient {
-	return &DNSClient{&dns.Client{}}
+	return &DNSClient{
+		Client:       &dns.Client{UDPSize: defaultDNSClientUDPSize},
+		HTTPClient:   defaultDNSClientHTTPClient,
+		QueryTimeout: defaultDNSClientQueryTimeout,
+		Retries:      defaultDNSClientRetries,
+	}
+}
+
+// newQuery returns a query message with EDNS0 set.
+func (c *DNSClient) newQuery(name string, qtype uint16) *dns.Msg {
+	udpSize := c.UDPSize
+	if udpSize < dns.MinMsgSize {
+		udpSize = dns.MinMsgSize
+	}
+
+	m := &dns.Msg{}
+	m.SetQuestion(name, qtype)
+	m.SetEdns0(udpSize, false)
+
+	return m
 }
 
 // ResolveA will ask the provided nameservers for an A record of the provided
 // DNS name and return the list of IP addresses in the answer, if any.
 func (c *DNSClient) ResolveA(name string, nameservers []string) ([]net.IP, error) {
-	m := dns.Msg{}
-	m.SetQuestion(name, dns.TypeA)
+	return c.ResolveAContext(context.Background(), name, nameservers)
+}
+
+// ResolveAContext is like ResolveA but stops querying the nameservers when
+// the context is cancelled.
+func (c *DNSClient) ResolveAContext(ctx context.Context, name string, nameservers []string) ([]net.IP, error) {
+	return c.resolve(ctx, name, dns.TypeA, nameservers)
+}
+
+// ResolveAAAA will ask the provided nameservers for an AAAA record of the
+// provided DNS name and return the list of IPv6 addresses in the answer, if
+// any.
+func (c *DNSClient) ResolveAAAA(name string, nameservers []string) ([]net.IP, error) {
+	return c.ResolveAAAAContext(context.Background(), name, nameservers)
+}
+
+// ResolveAAAAContext is like ResolveAAAA but stops querying the nameservers
+// when the context is cancelled.
+func (c *DNSClient) ResolveAAAAContext(ctx context.Context, name string, nameservers []string) ([]net.IP, error) {
+	return c.resolve(ctx, name, dns.TypeAAAA, nameservers)
+}
+
+// ResolveChain will ask the provided nameservers for records of the given
+// type, e.g. dns.TypeA, following any CNAME records. It returns the IP
+// addresses in the answer and the chain of names that was followed, starting
+// with name and ending with the name that owns the records.
+func (c *DNSClient) ResolveChain(name string, qtype uint16, nameservers []string) ([]net.IP, []string, error) {
+	return c.ResolveChainContext(context.Background(), name, qtype, nameservers)
+}
+
+// ResolveChainContext is like ResolveChain but stops querying the
+// nameservers when the context is cancelled.
+func (c *DNSClient) ResolveChainContext(ctx context.Context, name string, qtype uint16, nameservers []string) ([]net.IP, []string, error) {
+	return c.query(ctx, name, qtype, dns.ClassINET, nameservers, parseDNSAnswer)
+}
+
+// ResolveNS will ask the provided nameservers for the NS records of the
+// provided DNS name and return the list of nameserver hostnames in the
+// answer, if any.
+func (c *DNSClient) ResolveNS(name string, nameservers []string) ([]string, error) {
+	return c.ResolveNSContext(context.Background(), name, nameservers)
+}
+
+// ResolveNSContext is like ResolveNS but stops querying the nameservers when
+// the context is cancelled.
+func (c *DNSClient) ResolveNSContext(ctx context.Context, name string, nameservers []string) ([]string, error) {
+	m := c.newQuery(name, dns.TypeNS)
 
 	var retError error
-	var retIP []net.IP
+	var retNS []string
 
 	for _, nameserver := range nameservers {
-		r, _, err := c.Exchange(&m, nameserver)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		r, err := c.exchange(ctx, m, nameserver)
 		if err != nil {
 			retError = err
 			continue
 		}
 
-		if len(r.Answer) == 0 {
+		for _, ans := range r.Answer {
+			if ns, ok := ans.(*dns.NS); ok {
+				retNS = append(retNS, strings.TrimSuffix(ns.Ns, "."))
+			}
+		}
+
+		if len(retNS) == 0 {
 			retError = ErrDNSEmptyAnswer
 			continue
 		}
 
+		retError = nil
+		break
+	}
+
+	return retNS, retError
+}
+
+func (c *DNSClient) resolve(ctx context.Context, name string, qtype uint16, nameservers []string) ([]net.IP, error) {
+	ips, _, err := c.query(ctx, name, qtype, dns.ClassINET, nameservers, parseDNSAnswer)
+	return ips, err
+}
+
+// DNSAnswerParser is tasked with extracting an IP address from a record in
+// the answer of a DNS query. It is only given records of the queried type,
+// but should return a nil IP address and error for records that are not
+// relevant.
+type DNSAnswerParser func(rr dns.RR) (net.IP, error)
+
+// parseDNSAnswer reads the IP address of A and AAAA records and parses the
+// text of TXT records as an IP address.
+func parseDNSAnswer(rr dns.RR) (net.IP, error) {
+	switch rr := rr.(type) {
+	case *dns.A:
+		return rr.A, nil
+	case *dns.AAAA:
+		return rr.AAAA, nil
+	case *dns.TXT:
+		for _, txt := range rr.Txt {
+			if ip := net.ParseIP(strings.TrimSpace(txt)); ip != nil {
+				return ip, nil
+			}
+		}
+		return nil, ErrDNSCouldNotParseIP
+	}
+
+	return nil, nil
+}
+
+// query asks the nameservers, one at a time, until one of them replies with
+// an answer that includes at least one IP address and returns the distinct
+// IP addresses found in the answer using parse, along with the CNAME chain
+// that was followed to reach them.
+func (c *DNSClient) query(ctx context.Context, name string, qtype uint16, qclass uint16, nameservers []string, parse DNSAnswerParser) ([]net.IP, []string, error) {
+	var retError error
+
+	for _, nameserver := range nameservers {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		ips, chain, err := c.queryNameserver(ctx, name, qtype, qclass, nameserver, parse)
+		if err != nil {
+			retError = err
+			continue
+		}
+
+		return ips, chain, nil
+	}
+
+	return nil, nil, retError
+}
+
+// queryNameserver asks a single nameserver for the records of name. If name
+// is an alias, the CNAME chain is followed within the answer and, when the
+// answer stops at an alias, by asking the nameserver for its target.
+func (c *DNSClient) queryNameserver(ctx context.Context, name string, qtype uint16, qclass uint16, nameserver string, parse DNSAnswerParser) ([]net.IP, []string, error) {
+	target := dns.Fqdn(name)
+	chain := []string{target}
+
+	for {
+		m := c.newQuery(target, qtype)
+		m.Question[0].Qclass = qclass
+
+		r, err := c.exchange(ctx, m, nameserver)
+		if err != nil {
+			return nil, chain, err
+		}
+
+		var owner string
+		owner, chain, err = followCNAMEs(r.Answer, target, chain)
+		if err != nil {
+			return nil, chain, err
+		}
+
+		var ips []net.IP
+		var parseError error
 		for _, ans := range r.Answer {
-			ip := ans.(*dns.A).A
+			// records of other names or types, e.g. additional data that
+			// some servers add to the answer, are ignored
+			if !strings.EqualFold(dns.Fqdn(ans.Header().Name), owner) || ans.Header().Rrtype != qtype {
+				continue
+			}
+
+			ip, err := parse(ans)
+			if err != nil {
+				parseError = err
+				continue
+			}
+			if ip == nil {
+				continue
+			}
 
 			exists := false
-			for _, i := range retIP {
+			for _, i := range ips {
 				if ip.Equal(i) {
 					exists = true
 					break
@@ -70,13 +305,50 @@ func (c *DNSClient) ResolveA(name string, nameservers []string) ([]net.IP, error
 			}
 
 			if !exists {
-				retIP = append(retIP, ip)
+				ips = append(ips, ip)
 			}
 		}
 
-		retError = nil
-		break
+		switch {
+		case len(ips) > 0:
+			return ips, chain, nil
+		case parseError != nil:
+			return nil, chain, parseError
+		case owner == target:
+			return nil, chain, ErrDNSEmptyAnswer
+		}
+
+		target = owner
 	}
+}
+
+// followCNAMEs follows the CNAME records in the answer starting from name and
+// returns the last name of the chain, which owns the actual records.
+func followCNAMEs(answer []dns.RR, name string, chain []string) (string, []string, error) {
+	for {
+		var next string
+		for _, rr := range answer {
+			if cname, ok := rr.(*dns.CNAME); ok && strings.EqualFold(dns.Fqdn(cname.Hdr.Name), name) {
+				next = dns.Fqdn(cname.Target)
+				break
+			}
+		}
+
+		if next == "" {
+			return name, chain, nil
+		}
 
-	return retIP, retError
+		for _, n := range chain {
+			if strings.EqualFold(n, next) {
+				return "", chain, ErrDNSCNAMELoop
+			}
+		}
+
+		chain = append(chain, next)
+		if len(chain) > maxDNSCNAMEChain {
+			return "", chain, ErrDNSCNAMELoop
+		}
+
+		name = next
+	}
 }
@@ -0,0 +1,197 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSNameserverResult is the outcome of querying a single nameserver.
+type DNSNameserverResult struct {
+	// Nameserver that was queried.
+	Nameserver string
+
+	// IPs are the distinct IP addresses in the answer.
+	IPs []net.IP
+
+	// Chain of names that was followed to reach the records, see
+	// ResolveChain.
+	Chain []string
+
+	// Rcode of the response, or -1 if the nameserver did not respond.
+	Rcode int
+
+	// RTT is the time it took to get the answer, including any retries and
+	// CNAME queries.
+	RTT time.Duration
+
+	// Err is the error that occurred, if any.
+	Err error
+}
+
+func (r *DNSNameserverResult) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("%s: %v", r.Nameserver, r.Err)
+	}
+
+	return fmt.Sprintf("%s: %v", r.Nameserver, r.IPs)
+}
+
+// DNSResults are the results of querying a set of nameservers, in the order
+// the nameservers were given.
+type DNSResults []*DNSNameserverResult
+
+// Empty reports whether the nameserver answered that it has no records of
+// the type for the name, either because the name only has records of other
+// types (ErrDNSEmptyAnswer) or because it does not exist (ErrDNSNameError).
+func (r *DNSNameserverResult) Empty() bool {
+	return r.Err == ErrDNSEmptyAnswer || r.Err == ErrDNSNameError
+}
+
+// Consistent reports whether all the nameservers that answered returned the
+// same set of IP addresses. An empty answer counts as an empty set, so that a
+// new record that has not reached all of the nameservers yet is detected.
+func (r DNSResults) Consistent() bool {
+	var first *DNSNameserverResult
+	for _, res := range r {
+		if res.Err != nil && !res.Empty() {
+			continue
+		}
+
+		if first == nil {
+			first = res
+			continue
+		}
+
+		if !sameIPs(first.IPs, res.IPs) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// First returns the first successful result, or nil if all of the
+// nameservers failed.
+func (r DNSResults) First() *DNSNameserverResult {
+	for _, res := range r {
+		if res.Err == nil {
+			return res
+		}
+	}
+
+	return nil
+}
+
+func (r DNSResults) String() string {
+	s := make([]string, len(r))
+	for i, res := range r {
+		s[i] = res.String()
+	}
+
+	return strings.Join(s, ", ")
+}
+
+// ResolveAll asks all of the provided nameservers concurrently for records of
+// the given type, e.g. dns.TypeA, and returns the result of each one. Unlike
+// ResolveA, which stops at the first nameserver that answers, this makes it
+// possible to tell whether the nameservers agree, e.g. while a change is
+// propagating to all the authoritative nameservers of a zone.
+func (c *DNSClient) ResolveAll(name string, qtype uint16, nameservers []string) DNSResults {
+	return c.ResolveAllContext(context.Background(), name, qtype, nameservers)
+}
+
+// ResolveAllContext is like ResolveAll but aborts the queries when the
+// context is cancelled.
+func (c *DNSClient) ResolveAllContext(ctx context.Context, name string, qtype uint16, nameservers []string) DNSResults {
+	return c.queryAll(ctx, name, qtype, dns.ClassINET, nameservers, parseDNSAnswer)
+}
+
+func (c *DNSClient) queryAll(ctx context.Context, name string, qtype uint16, qclass uint16, nameservers []string, parse DNSAnswerParser) DNSResults {
+	results := make(DNSResults, len(nameservers))
+
+	var wg sync.WaitGroup
+	for i, nameserver := range nameservers {
+		wg.Add(1)
+		go func(i int, nameserver string) {
+			defer wg.Done()
+
+			start := time.Now()
+			ips, chain, err := c.queryNameserver(ctx, name, qtype, qclass, nameserver, parse)
+			results[i] = &DNSNameserverResult{
+				Nameserver: nameserver,
+				IPs:        ips,
+				Chain:      chain,
+				Rcode:      dnsErrorRcode(err),
+				RTT:        time.Since(start),
+				Err:        err,
+			}
+		}(i, nameserver)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// dnsErrorRcode returns the rcode of the response that resulted in err.
+func dnsErrorRcode(err error) int {
+	switch err {
+	case nil, ErrDNSEmptyAnswer, ErrDNSCouldNotParseIP, ErrDNSCNAMELoop:
+		return dns.RcodeSuccess
+	case ErrDNSNameError:
+		return dns.RcodeNameError
+	case ErrDNSServerFailure:
+		return dns.RcodeServerFailure
+	case ErrDNSRefused:
+		return dns.RcodeRefused
+	}
+
+	if rcodeErr, ok := err.(*DNSRcodeError); ok {
+		return rcodeErr.Rcode
+	}
+
+	return -1
+}
+
+// sameIPs reports whether a and b contain the same IP addresses, in any
+// order.
+func sameIPs(a, b []net.IP) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, ipA := range a {
+		found := false
+		for _, ipB := range b {
+			if ipA.Equal(ipB) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,144 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestDNSClient_ResolveAll(t *testing.T) {
+	servers, serverAddresses, err := startMockDNSServerFleet(map[string][]string{"test.com.": []string{"1.2.3.4", "5.6.7.8"}})
+	defer stopMockDNSServerFleet(servers)
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+
+	results := NewDNSClient().ResolveAll("test.com", dns.TypeA, serverAddresses)
+	if len(results) != len(serverAddresses) {
+		t.Fatalf("Client.ResolveAll returned unexpected number of results: %d", len(results))
+	}
+
+	for i, r := range results {
+		if r.Nameserver != serverAddresses[i] {
+			t.Errorf("Client.ResolveAll returned results out of order: %s", r.Nameserver)
+		}
+
+		if r.Err != nil || r.Rcode != dns.RcodeSuccess || r.RTT <= 0 || len(r.IPs) != 2 {
+			t.Errorf("Client.ResolveAll returned unexpected result: %+v", r)
+		}
+	}
+
+	if !results.Consistent() {
+		t.Errorf("DNSResults.Consistent returned false for: %s", results)
+	}
+}
+
+func TestDNSClient_ResolveAll_broken(t *testing.T) {
+	servers, serverAddresses, err := startMockSemiBrokenDNSServerFleet(map[string][]string{"test.com.": []string{"1.2.3.4"}})
+	defer stopMockDNSServerFleet(servers)
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+
+	results := NewDNSClient().ResolveAll("test.com", dns.TypeA, serverAddresses)
+
+	if results[0].Err == nil || results[0].Rcode != -1 {
+		t.Errorf("Client.ResolveAll returned unexpected result for an unreachable nameserver: %+v", results[0])
+	}
+
+	if results[1].Err == nil || results[1].Rcode == -1 {
+		t.Errorf("Client.ResolveAll returned unexpected result for a nameserver without the record: %+v", results[1])
+	}
+
+	if first := results.First(); first != results[2] {
+		t.Errorf("DNSResults.First returned unexpected result: %+v", first)
+	}
+
+	if !results.Consistent() {
+		t.Errorf("DNSResults.Consistent returned false for: %s", results)
+	}
+}
+
+func TestDNSClient_ResolveAll_inconsistent(t *testing.T) {
+	s1, addr1, err := startMockDNSServer("127.0.0.1:0", map[string][]string{"test.com.": []string{"1.2.3.4"}})
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+	s2, addr2, err := startMockDNSServer("127.0.0.1:0", map[string][]string{"test.com.": []string{"5.6.7.8"}})
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+	defer stopMockDNSServerFleet([]*dns.Server{s1, s2})
+
+	results := NewDNSClient().ResolveAll("test.com", dns.TypeA, []string{addr1, addr2})
+	if results.Consistent() {
+		t.Errorf("DNSResults.Consistent returned true for: %s", results)
+	}
+
+	if s := results.String(); !strings.Contains(s, addr1+": [1.2.3.4]") || !strings.Contains(s, addr2+": [5.6.7.8]") {
+		t.Errorf("DNSResults.String returned unexpected description: %s", s)
+	}
+}
+
+func TestDNSClient_ResolveAll_newRecord(t *testing.T) {
+	s1, addr1, err := startMockDNSServer("127.0.0.1:0", map[string][]string{"test.com.": []string{"1.2.3.4"}})
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+	s2, addr2, err := startMockDNSServer("127.0.0.1:0", map[string][]string{"test.com.": []string{}})
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+	defer stopMockDNSServerFleet([]*dns.Server{s1, s2})
+
+	// the record has only reached the first nameserver
+	results := NewDNSClient().ResolveAll("test.com", dns.TypeA, []string{addr1, addr2})
+	if results[1].Err != ErrDNSEmptyAnswer {
+		t.Fatalf("Client.ResolveAll returned unexpected result for a nameserver without the record: %+v", results[1])
+	}
+
+	if results.Consistent() {
+		t.Errorf("DNSResults.Consistent returned true for: %s", results)
+	}
+}
+
+func TestDNSResults_Consistent(t *testing.T) {
+	ip1, ip2 := net.ParseIP("1.2.3.4"), net.ParseIP("5.6.7.8")
+
+	tests := []struct {
+		results    DNSResults
+		consistent bool
+	}{
+		{DNSResults{}, true},
+		{DNSResults{{IPs: []net.IP{ip1, ip2}}, {IPs: []net.IP{ip2, ip1}}}, true},
+		{DNSResults{{IPs: []net.IP{ip1}}, {Err: ErrDNSServerFailure}}, true},
+		{DNSResults{{Err: ErrDNSEmptyAnswer}, {Err: ErrDNSEmptyAnswer}}, true},
+		{DNSResults{{IPs: []net.IP{ip1}}, {Err: ErrDNSEmptyAnswer}}, false},
+		{DNSResults{{Err: ErrDNSNameError}, {IPs: []net.IP{ip1}}}, false},
+		{DNSResults{{Err: ErrDNSNameError}, {Err: ErrDNSEmptyAnswer}}, true},
+		{DNSResults{{IPs: []net.IP{ip1}}, {IPs: []net.IP{ip1, ip2}}}, false},
+		{DNSResults{{IPs: []net.IP{ip1}}, {IPs: []net.IP{ip2}}}, false},
+	}
+
+	for _, test := range tests {
+		if c := test.results.Consistent(); c != test.consistent {
+			t.Errorf("DNSResults.Consistent returned %v for: %s", c, test.results)
+		}
+	}
+}
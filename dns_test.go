@@ -15,6 +15,9 @@
 package odyn
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net"
 	"sync"
 	"testing"
@@ -30,15 +33,39 @@ func setupMockDNSRecord(mux *dns.ServeMux, name string, records []string) {
 		m.Authoritative = true
 
 		for _, r := range records {
-			m.Answer = append(m.Answer, &dns.A{
-				Hdr: dns.RR_Header{
-					Name:   req.Question[0].Name,
-					Rrtype: dns.TypeA,
-					Class:  dns.ClassINET,
-					Ttl:    0,
-				},
-				A: net.ParseIP(r).To4(),
-			})
+			ip := net.ParseIP(r)
+			switch {
+			case req.Question[0].Qtype == dns.TypeA && ip.To4() != nil:
+				m.Answer = append(m.Answer, &dns.A{
+					Hdr: dns.RR_Header{
+						Name:   req.Question[0].Name,
+						Rrtype: dns.TypeA,
+						Class:  dns.ClassINET,
+						Ttl:    0,
+					},
+					A: ip.To4(),
+				})
+			case req.Question[0].Qtype == dns.TypeAAAA && ip.To4() == nil:
+				m.Answer = append(m.Answer, &dns.AAAA{
+					Hdr: dns.RR_Header{
+						Name:   req.Question[0].Name,
+						Rrtype: dns.TypeAAAA,
+						Class:  dns.ClassINET,
+						Ttl:    0,
+					},
+					AAAA: ip,
+				})
+			case req.Question[0].Qtype == dns.TypeTXT:
+				m.Answer = append(m.Answer, &dns.TXT{
+					Hdr: dns.RR_Header{
+						Name:   req.Question[0].Name,
+						Rrtype: dns.TypeTXT,
+						Class:  req.Question[0].Qclass,
+						Ttl:    0,
+					},
+					Txt: []string{r},
+				})
+			}
 		}
 
 		w.WriteMsg(m)
@@ -153,6 +180,17 @@ func TestDNSClient_ResolveA_noServer(t *testing.T) {
 	}
 }
 
+func TestDNSClient_ResolveAContext_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dc := NewDNSClient()
+	_, err := dc.ResolveAContext(ctx, "example.com.", []string{"127.0.0.1:65111"})
+	if err != context.Canceled {
+		t.Fatalf("Client.ResolveAContext returned unexpected error: %+v", err)
+	}
+}
+
 func TestDNSClient_ResolveA_empty(t *testing.T) {
 	servers, serverAddresses, err := startMockDNSServerFleet(map[string][]string{"example.com.": []string{}})
 	defer stopMockDNSServerFleet(servers)
@@ -232,3 +270,334 @@ func TestDNSClient_ResolveA_broken(t *testing.T) {
 		t.Fatalf("Client.ResolveA returned unexpected response")
 	}
 }
+
+func TestDNSClient_ResolveAAAA(t *testing.T) {
+	servers, serverAddresses, err := startMockDNSServerFleet(map[string][]string{"example.com.": []string{"1.1.1.1", "2001:db8::1"}})
+	defer stopMockDNSServerFleet(servers)
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+
+	dc := NewDNSClient()
+	resp, err := dc.ResolveAAAA("example.com.", serverAddresses)
+	if err != nil {
+		t.Fatalf("Client.ResolveAAAA returned unexpected error: %+v", err)
+	}
+
+	if len(resp) != 1 {
+		t.Fatalf("Client.ResolveAAAA should have returned a single value")
+	}
+
+	if !resp[0].Equal(net.ParseIP("2001:db8::1")) {
+		t.Fatalf("Client.ResolveAAAA returned unexpected response")
+	}
+}
+
+func TestDNSClient_ResolveAAAA_empty(t *testing.T) {
+	servers, serverAddresses, err := startMockDNSServerFleet(map[string][]string{"example.com.": []string{"1.1.1.1"}})
+	defer stopMockDNSServerFleet(servers)
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+
+	dc := NewDNSClient()
+	_, err = dc.ResolveAAAA("example.com.", serverAddresses)
+	if err != ErrDNSEmptyAnswer {
+		t.Fatalf("Client.ResolveAAAA should have returned an empty answer error")
+	}
+}
+
+// startMockDNSServerUDPTCP runs the handler on both UDP and TCP on the same
+// port.
+func startMockDNSServerUDPTCP(handler dns.Handler) ([]*dns.Server, string, error) {
+	for i := 0; i < 10; i++ {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			return nil, "", err
+		}
+
+		l, err := net.Listen("tcp", pc.LocalAddr().String())
+		if err != nil {
+			pc.Close()
+			continue
+		}
+
+		servers := []*dns.Server{
+			&dns.Server{PacketConn: pc, Handler: handler},
+			&dns.Server{Listener: l, Handler: handler},
+		}
+
+		for _, s := range servers {
+			waitLock := sync.Mutex{}
+			waitLock.Lock()
+			s.NotifyStartedFunc = waitLock.Unlock
+			go s.ActivateAndServe()
+			waitLock.Lock()
+		}
+
+		return servers, pc.LocalAddr().String(), nil
+	}
+
+	return nil, "", errors.New("could not listen on the same UDP and TCP port")
+}
+
+func TestDNSClient_ResolveA_truncated(t *testing.T) {
+	servers, addr, err := startMockDNSServerUDPTCP(dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		if w.RemoteAddr().Network() == "udp" {
+			m.Truncated = true
+		} else {
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET},
+				A:   net.ParseIP("1.2.3.4"),
+			})
+		}
+		w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+	defer stopMockDNSServerFleet(servers)
+
+	// the fallback keeps the address family of the client's network
+	for _, network := range []string{"", "udp4"} {
+		c := NewDNSClient()
+		c.Net = network
+		ips, err := c.ResolveA("example.com.", []string{addr})
+		if err != nil {
+			t.Fatalf("Client.ResolveA returned unexpected error: %+v", err)
+		}
+
+		if len(ips) != 1 || !ips[0].Equal(net.ParseIP("1.2.3.4")) {
+			t.Fatalf("Client.ResolveA returned unexpected response: %+v", ips)
+		}
+	}
+}
+
+func TestDNSClient_ResolveA_rcodes(t *testing.T) {
+	testCases := []struct {
+		rcode int
+		err   error
+	}{
+		{dns.RcodeNameError, ErrDNSNameError},
+		{dns.RcodeServerFailure, ErrDNSServerFailure},
+		{dns.RcodeRefused, ErrDNSRefused},
+	}
+
+	for _, tc := range testCases {
+		rcode := tc.rcode
+		servers, addr, err := startMockDNSServerUDPTCP(dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetRcode(req, rcode)
+			w.WriteMsg(m)
+		}))
+		if err != nil {
+			t.Fatalf("dnstest: unable to run test server: %v", err)
+		}
+
+		_, err = NewDNSClient().ResolveA("example.com.", []string{addr})
+		if err != tc.err {
+			t.Errorf("Client.ResolveA returned unexpected error for rcode %d: %+v", tc.rcode, err)
+		}
+
+		stopMockDNSServerFleet(servers)
+	}
+}
+
+func TestDNSClient_ResolveA_otherRcode(t *testing.T) {
+	servers, addr, err := startMockDNSServerUDPTCP(dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeNotImplemented)
+		w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+	defer stopMockDNSServerFleet(servers)
+
+	_, err = NewDNSClient().ResolveA("example.com.", []string{addr})
+	if rErr, ok := err.(*DNSRcodeError); !ok || rErr.Rcode != dns.RcodeNotImplemented {
+		t.Fatalf("Client.ResolveA returned unexpected error: %+v", err)
+	}
+}
+
+func TestDNSClient_ResolveA_retries(t *testing.T) {
+	queries := 0
+	mutex := sync.Mutex{}
+	servers, addr, err := startMockDNSServerUDPTCP(dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		mutex.Lock()
+		queries++
+		drop := queries == 1
+		mutex.Unlock()
+
+		// the first query is dropped to make the client time out
+		if drop {
+			return
+		}
+
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET},
+			A:   net.ParseIP("1.2.3.4"),
+		})
+		w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+	defer stopMockDNSServerFleet(servers)
+
+	dc := NewDNSClient()
+	dc.QueryTimeout = 50 * time.Millisecond
+
+	ips, err := dc.ResolveA("example.com.", []string{addr})
+	if err != nil || len(ips) != 1 {
+		t.Fatalf("Client.ResolveA returned unexpected result: %+v, %+v", ips, err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if queries != 2 {
+		t.Fatalf("Client.ResolveA sent %d queries", queries)
+	}
+}
+
+func TestDNSClient_ResolveA_edns0(t *testing.T) {
+	servers, addr, err := startMockDNSServerUDPTCP(dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		if opt := req.IsEdns0(); opt == nil || opt.UDPSize() != defaultDNSClientUDPSize {
+			m.Rcode = dns.RcodeFormatError
+		} else {
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET},
+				A:   net.ParseIP("1.2.3.4"),
+			})
+		}
+		w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+	defer stopMockDNSServerFleet(servers)
+
+	if _, err := NewDNSClient().ResolveA("example.com.", []string{addr}); err != nil {
+		t.Fatalf("Client.ResolveA returned unexpected error: %+v", err)
+	}
+}
+
+// startMockDNSServerRRs answers queries with the records, written in zone
+// file format, listed for the queried name.
+func startMockDNSServerRRs(answers map[string][]string) ([]*dns.Server, string, error) {
+	return startMockDNSServerUDPTCP(dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		for _, s := range answers[req.Question[0].Name] {
+			rr, _ := dns.NewRR(s)
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	}))
+}
+
+func TestDNSClient_ResolveChain(t *testing.T) {
+	servers, addr, err := startMockDNSServerRRs(map[string][]string{
+		"home.example.com.": []string{
+			"home.example.com. 60 IN CNAME router.example.net.",
+			"router.example.net. 60 IN A 1.2.3.4",
+			"other.example.net. 60 IN A 5.6.7.8",
+			"router.example.net. 60 IN TXT \"v=spf1 -all\"",
+		},
+	})
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+	defer stopMockDNSServerFleet(servers)
+
+	ips, chain, err := NewDNSClient().ResolveChain("home.example.com", dns.TypeA, []string{addr})
+	if err != nil {
+		t.Fatalf("Client.ResolveChain returned unexpected error: %+v", err)
+	}
+
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("1.2.3.4")) {
+		t.Errorf("Client.ResolveChain returned unexpected response: %+v", ips)
+	}
+
+	if len(chain) != 2 || chain[0] != "home.example.com." || chain[1] != "router.example.net." {
+		t.Errorf("Client.ResolveChain returned unexpected chain: %+v", chain)
+	}
+}
+
+func TestDNSClient_ResolveA_otherTypes(t *testing.T) {
+	servers, addr, err := startMockDNSServerRRs(map[string][]string{
+		"home.example.com.": []string{
+			"home.example.com. 60 IN AAAA 2001:db8::1",
+			"home.example.com. 60 IN A 1.2.3.4",
+			"home.example.com. 60 IN TXT \"5.6.7.8\"",
+		},
+	})
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+	defer stopMockDNSServerFleet(servers)
+
+	ips, err := NewDNSClient().ResolveA("home.example.com", []string{addr})
+	if err != nil {
+		t.Fatalf("Client.ResolveA returned unexpected error: %+v", err)
+	}
+
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("1.2.3.4")) {
+		t.Errorf("Client.ResolveA returned unexpected response: %+v", ips)
+	}
+}
+
+func TestDNSClient_ResolveA_cnameRequery(t *testing.T) {
+	servers, addr, err := startMockDNSServerRRs(map[string][]string{
+		"home.example.com.":   []string{"home.example.com. 60 IN CNAME router.example.net."},
+		"router.example.net.": []string{"router.example.net. 60 IN CNAME wan.example.org.", "wan.example.org. 60 IN A 1.2.3.4"},
+	})
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+	defer stopMockDNSServerFleet(servers)
+
+	ips, chain, err := NewDNSClient().ResolveChain("home.example.com.", dns.TypeA, []string{addr})
+	if err != nil {
+		t.Fatalf("Client.ResolveChain returned unexpected error: %+v", err)
+	}
+
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("1.2.3.4")) {
+		t.Errorf("Client.ResolveChain returned unexpected response: %+v", ips)
+	}
+
+	if len(chain) != 3 || chain[2] != "wan.example.org." {
+		t.Errorf("Client.ResolveChain returned unexpected chain: %+v", chain)
+	}
+}
+
+func TestDNSClient_ResolveA_cnameLoop(t *testing.T) {
+	answers := map[string][]string{
+		"a.example.com.": []string{"a.example.com. 60 IN CNAME b.example.com."},
+		"b.example.com.": []string{"b.example.com. 60 IN CNAME a.example.com."},
+	}
+
+	// a chain longer than the limit
+	for i := 0; i < maxDNSCNAMEChain+1; i++ {
+		name := fmt.Sprintf("%d.example.com.", i)
+		answers[name] = []string{fmt.Sprintf("%s 60 IN CNAME %d.example.com.", name, i+1)}
+	}
+
+	servers, addr, err := startMockDNSServerRRs(answers)
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+	defer stopMockDNSServerFleet(servers)
+
+	for _, name := range []string{"a.example.com.", "0.example.com."} {
+		if _, err := NewDNSClient().ResolveA(name, []string{addr}); err != ErrDNSCNAMELoop {
+			t.Errorf("Client.ResolveA returned unexpected error for %s: %+v", name, err)
+		}
+	}
+}
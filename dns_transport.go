@@ -0,0 +1,213 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const dnsMessageContentType = "application/dns-message"
+
+var (
+	// ErrDNSUnsupportedTransport is returned when a nameserver URL has a
+	// scheme other than udp, tcp, tls or https.
+	ErrDNSUnsupportedTransport = errors.New("unsupported DNS transport")
+
+	// ErrDNSOverHTTPSInvalidResponse is returned when the DNS over HTTPS
+	// server responds with a non 200 HTTP code or a body that is not a DNS
+	// message.
+	ErrDNSOverHTTPSInvalidResponse = errors.New("DNS over HTTPS server returned an invalid response")
+
+	dnsTransportDefaultPorts = map[string]string{
+		"udp": "53",
+		"tcp": "53",
+		"tls": "853",
+	}
+)
+
+// exchange sends the query to the nameserver, retrying on timeouts and
+// network errors, and turns unsuccessful rcodes into errors.
+func (c *DNSClient) exchange(ctx context.Context, m *dns.Msg, nameserver string) (*dns.Msg, error) {
+	var r *dns.Msg
+	var err error
+
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		r, err = c.exchangeOnce(ctx, m, nameserver)
+		if _, ok := err.(net.Error); !ok {
+			break
+		}
+	}
+
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+
+	switch r.Rcode {
+	case dns.RcodeSuccess:
+		return r, nil
+	case dns.RcodeNameError:
+		return nil, ErrDNSNameError
+	case dns.RcodeServerFailure:
+		return nil, ErrDNSServerFailure
+	case dns.RcodeRefused:
+		return nil, ErrDNSRefused
+	}
+
+	return nil, &DNSRcodeError{Rcode: r.Rcode}
+}
+
+// exchangeOnce sends the query to the nameserver using the transport
+// selected by the nameserver's URL scheme, or by the client's Net if it has
+// none, falling back to TCP if the UDP response is truncated.
+func (c *DNSClient) exchangeOnce(ctx context.Context, m *dns.Msg, nameserver string) (*dns.Msg, error) {
+	if c.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.QueryTimeout)
+		defer cancel()
+	}
+
+	scheme, address, network := dnsNetScheme(c.Net), nameserver, c.Net
+	if i := strings.Index(nameserver, "://"); i >= 0 {
+		scheme, address, network = nameserver[:i], nameserver[i+3:], ""
+	}
+
+	if scheme == "https" {
+		return c.exchangeHTTPS(ctx, m, nameserver)
+	}
+
+	port, ok := dnsTransportDefaultPorts[scheme]
+	if !ok {
+		return nil, ErrDNSUnsupportedTransport
+	}
+
+	host := address
+	if h, _, err := net.SplitHostPort(address); err == nil {
+		host = h
+	} else {
+		address = net.JoinHostPort(strings.Trim(address, "[]"), port)
+	}
+
+	client := &dns.Client{
+		Net:          scheme,
+		UDPSize:      c.UDPSize,
+		Timeout:      c.Timeout,
+		DialTimeout:  c.DialTimeout,
+		ReadTimeout:  c.ReadTimeout,
+		WriteTimeout: c.WriteTimeout,
+		TsigSecret:   c.TsigSecret,
+		TLSConfig:    c.TLSConfig,
+	}
+
+	if network != "" {
+		// keep the client's network as is, e.g. udp4 or tcp6
+		client.Net = network
+	}
+
+	if scheme == "tls" {
+		client.Net = "tcp-tls"
+		if client.TLSConfig == nil {
+			client.TLSConfig = &tls.Config{ServerName: strings.Trim(host, "[]")}
+		}
+	}
+
+	r, _, err := client.ExchangeContext(ctx, m, address)
+	if err == nil && r.Truncated && scheme == "udp" {
+		client.Net = dnsTCPNetwork(client.Net)
+		r, _, err = client.ExchangeContext(ctx, m, address)
+	}
+
+	return r, err
+}
+
+// exchangeHTTPS sends the query as a DNS over HTTPS (RFC 8484) POST request.
+func (c *DNSClient) exchangeHTTPS(ctx context.Context, m *dns.Msg, url string) (*dns.Msg, error) {
+	// the ID is set to 0 to make responses cacheable, as suggested by the RFC
+	q := m.Copy()
+	q.Id = 0
+
+	body, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", dnsMessageContentType)
+	req.Header.Set("Content-Type", dnsMessageContentType)
+
+	resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrDNSOverHTTPSInvalidResponse
+	}
+
+	buf, err := ioutil.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &dns.Msg{}
+	if err := r.Unpack(buf); err != nil {
+		return nil, ErrDNSOverHTTPSInvalidResponse
+	}
+	r.Id = m.Id
+
+	return r, nil
+}
+
+// dnsNetScheme returns the transport matching a dns.Client network, which is
+// used for nameservers without a URL scheme.
+func dnsNetScheme(network string) string {
+	switch {
+	case network == "tcp-tls":
+		return "tls"
+	case strings.HasPrefix(network, "tcp"):
+		return "tcp"
+	}
+
+	return "udp"
+}
+
+// dnsTCPNetwork returns the TCP network of the same address family as a UDP
+// dns.Client network, e.g. tcp4 for udp4, to resend truncated queries over.
+func dnsTCPNetwork(network string) string {
+	return "tcp" + strings.TrimPrefix(network, "udp")
+}
@@ -0,0 +1,232 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+var testDNSTransportRecords = map[string][]string{"myip.example.com.": []string{"1.2.3.4"}}
+
+func testDNSTransportHandler() dns.Handler {
+	mux := dns.NewServeMux()
+	for n, r := range testDNSTransportRecords {
+		setupMockDNSRecord(mux, n, r)
+	}
+
+	return mux
+}
+
+// startMockDoTServer runs a DNS over TLS server using the certificate of the
+// given TLS test server.
+func startMockDoTServer(certs []tls.Certificate) (*dns.Server, string, error) {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certs})
+	if err != nil {
+		return nil, "", err
+	}
+
+	server := &dns.Server{
+		Listener: l,
+		Net:      "tcp-tls",
+		Handler:  testDNSTransportHandler(),
+	}
+
+	waitLock := sync.Mutex{}
+	waitLock.Lock()
+	server.NotifyStartedFunc = waitLock.Unlock
+
+	go server.ActivateAndServe()
+
+	waitLock.Lock()
+	return server, l.Addr().String(), nil
+}
+
+// startMockTCPDNSServer runs a DNS server that only listens on TCP.
+func startMockTCPDNSServer(handler dns.Handler) (*dns.Server, string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", err
+	}
+
+	server := &dns.Server{
+		Listener: l,
+		Net:      "tcp",
+		Handler:  handler,
+	}
+
+	waitLock := sync.Mutex{}
+	waitLock.Lock()
+	server.NotifyStartedFunc = waitLock.Unlock
+
+	go server.ActivateAndServe()
+
+	waitLock.Lock()
+	return server, l.Addr().String(), nil
+}
+
+// mockDoHHandler answers DNS over HTTPS POST requests.
+type mockDoHHandler struct {
+	handler dns.Handler
+}
+
+type mockDoHResponseWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *mockDoHResponseWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+func (h *mockDoHHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || r.Header.Get("Content-Type") != dnsMessageContentType {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	req := &dns.Msg{}
+	if err := req.Unpack(body); err != nil || req.Id != 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rw := &mockDoHResponseWriter{}
+	h.handler.ServeDNS(rw, req)
+	resp, _ := rw.msg.Pack()
+
+	w.Header().Set("Content-Type", dnsMessageContentType)
+	w.Write(resp)
+}
+
+func testInsecureDNSClient() *DNSClient {
+	c := NewDNSClient()
+	c.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	c.HTTPClient = &http.Client{Transport: &http.Transport{TLSClientConfig: c.TLSConfig}}
+
+	return c
+}
+
+func TestDNSClient_ResolveA_overTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	server, addr, err := startMockDoTServer(ts.TLS.Certificates)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	ips, err := testInsecureDNSClient().ResolveA("myip.example.com.", []string{"tls://" + addr})
+	if err != nil {
+		t.Fatalf("DNSClient.ResolveA returned unexpected error: %+v", err)
+	}
+
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("1.2.3.4")) {
+		t.Errorf("DNSClient.ResolveA returned unexpected response: %+v", ips)
+	}
+}
+
+func TestDNSClient_ResolveA_overHTTPS(t *testing.T) {
+	ts := httptest.NewTLSServer(&mockDoHHandler{testDNSTransportHandler()})
+	defer ts.Close()
+
+	ips, err := testInsecureDNSClient().ResolveA("myip.example.com.", []string{ts.URL + "/dns-query"})
+	if err != nil {
+		t.Fatalf("DNSClient.ResolveA returned unexpected error: %+v", err)
+	}
+
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("1.2.3.4")) {
+		t.Errorf("DNSClient.ResolveA returned unexpected response: %+v", ips)
+	}
+}
+
+func TestDNSClient_ResolveA_overHTTPSInvalidResponse(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	_, err := testInsecureDNSClient().ResolveA("myip.example.com.", []string{ts.URL + "/dns-query"})
+	if err != ErrDNSOverHTTPSInvalidResponse {
+		t.Errorf("DNSClient.ResolveA returned unexpected error: %+v", err)
+	}
+}
+
+func TestDNSClient_ResolveA_overUDPURL(t *testing.T) {
+	server, addr, err := startMockDNSServer("127.0.0.1:0", testDNSTransportRecords)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	ips, err := NewDNSClient().ResolveA("myip.example.com.", []string{"udp://" + addr})
+	if err != nil || len(ips) != 1 {
+		t.Errorf("DNSClient.ResolveA returned unexpected result: %+v, %+v", ips, err)
+	}
+}
+
+func TestDNSClient_ResolveA_clientNet(t *testing.T) {
+	server, addr, err := startMockTCPDNSServer(testDNSTransportHandler())
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	// the nameserver has no scheme, so the client's network is used
+	c := NewDNSClient()
+	c.Net = "tcp"
+	ips, err := c.ResolveA("myip.example.com.", []string{addr})
+	if err != nil || len(ips) != 1 {
+		t.Errorf("DNSClient.ResolveA returned unexpected result: %+v, %+v", ips, err)
+	}
+}
+
+func TestDNSTCPNetwork(t *testing.T) {
+	for network, expected := range map[string]string{"udp": "tcp", "udp4": "tcp4", "udp6": "tcp6"} {
+		if n := dnsTCPNetwork(network); n != expected {
+			t.Errorf("dnsTCPNetwork returned unexpected network for %s: %s", network, n)
+		}
+	}
+}
+
+func TestDNSClient_ResolveA_unsupportedTransport(t *testing.T) {
+	_, err := NewDNSClient().ResolveA("myip.example.com.", []string{"quic://127.0.0.1"})
+	if err != ErrDNSUnsupportedTransport {
+		t.Errorf("DNSClient.ResolveA returned unexpected error: %+v", err)
+	}
+}
+
+func TestDNSProvider_Get_overHTTPS(t *testing.T) {
+	ts := httptest.NewTLSServer(&mockDoHHandler{testDNSTransportHandler()})
+	defer ts.Close()
+
+	p, _ := NewDNSProviderWithOptions(&DNSProviderOptions{
+		Record:      "myip.example.com.",
+		Nameservers: []string{ts.URL + "/dns-query"},
+		Client:      testInsecureDNSClient(),
+	})
+
+	if ip, err := p.Get(); err != nil || !ip.Equal(net.ParseIP("1.2.3.4")) {
+		t.Errorf("DNSProvider.Get returned unexpected result: %s, %+v", ip, err)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+const rtfGateway = 0x2
+
+// hostByteOrder is the byte order of the host, which the kernel uses to print
+// the addresses in /proc/net/route.
+var hostByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+
+	return binary.BigEndian
+}()
+
+// defaultGateway returns the IPv4 address of the default gateway, read from
+// the kernel's routing table.
+func defaultGateway() (net.IP, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseRouteTable(f, hostByteOrder)
+}
+
+// parseRouteTable parses the format of /proc/net/route, where addresses are
+// written as hexadecimal numbers of their in-memory representation, read in
+// the given (host) byte order.
+func parseRouteTable(r io.Reader, order binary.ByteOrder) (net.IP, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Scan() // skip the header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[1] != "00000000" {
+			continue
+		}
+
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil || flags&rtfGateway == 0 {
+			continue
+		}
+
+		gw, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil || len(fields[2]) != 8 {
+			continue
+		}
+
+		ip := make(net.IP, net.IPv4len)
+		order.PutUint32(ip, uint32(gw))
+		return ip, nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, ErrGatewayNotFound
+}
@@ -0,0 +1,64 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseRouteTable(t *testing.T) {
+	table := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	0002A8C0	00000000	0001	0	0	0	00FFFFFF	0	0	0
+eth0	00000000	0102A8C0	0003	0	0	100	00000000	0	0	0
+`
+
+	ip, err := parseRouteTable(strings.NewReader(table), binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("parseRouteTable returned unexpected error: %+v", err)
+	}
+
+	if !ip.Equal(net.ParseIP("192.168.2.1")) {
+		t.Errorf("parseRouteTable returned unexpected gateway: %s", ip)
+	}
+}
+
+func TestParseRouteTable_bigEndian(t *testing.T) {
+	table := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	C0A80200	00000000	0001	0	0	0	FFFFFF00	0	0	0
+eth0	00000000	C0A80201	0003	0	0	100	00000000	0	0	0
+`
+
+	ip, err := parseRouteTable(strings.NewReader(table), binary.BigEndian)
+	if err != nil {
+		t.Fatalf("parseRouteTable returned unexpected error: %+v", err)
+	}
+
+	if !ip.Equal(net.ParseIP("192.168.2.1")) {
+		t.Errorf("parseRouteTable returned unexpected gateway: %s", ip)
+	}
+}
+
+func TestParseRouteTable_noDefaultRoute(t *testing.T) {
+	table := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	0002A8C0	00000000	0001	0	0	0	00FFFFFF	0	0	0
+`
+
+	if _, err := parseRouteTable(strings.NewReader(table), hostByteOrder); err != ErrGatewayNotFound {
+		t.Errorf("parseRouteTable returned unexpected error: %+v", err)
+	}
+}
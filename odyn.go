@@ -18,11 +18,14 @@
 // Public IP address Providers
 //
 // The services currently available to use through this package are ipify.org,
-// ipinfo.io and opendns.com
+// ipinfo.io, opendns.com and the nameservers of Google and Cloudflare
 //
 // The easiest approach is to simply:
 //  ip, err := IpifyProvider.Get()
 //
+// IPv6 addresses can be discovered in the same way using the IPv6 variants:
+//  ip, err := Ipify6Provider.Get()
+//
 // You can also use the HTTPProvider and DNSProvider to expand the
 // functionality to further online services:
 //
@@ -30,6 +33,16 @@
 //  p, err := NewHTTPProvider("http://myip.example.com")
 //  ip, err := p.Get()
 //
+// Services that return the public IP address in a TXT record, such as
+// Google's o-o.myaddr.l.google.com, can be used by setting the query type, and
+// class if needed, of the DNSProvider:
+//
+//  p, err := NewDNSProviderWithOptions(&DNSProviderOptions{
+//  	Record:      "o-o.myaddr.l.google.com.",
+//  	Type:        dns.TypeTXT,
+//  	Nameservers: []string{"216.239.32.10:53"},
+//  })
+//
 // The HTTPProvider and DNSProvider can be used to retrieve the public IP
 // address from many different services since they're highly customisable.
 // You can combine also them using ProviderSets:
@@ -39,6 +52,40 @@
 //
 // See the documentation on NewProviderSet for more information.
 //
+// Hosts that have a public IP address assigned to one of their network
+// interfaces can read it directly using an InterfaceProvider:
+//
+//  p, err := NewInterfaceProvider("eth0")
+//  ip, err := p.Get()
+//
+// The STUNProvider discovers the address that the NAT maps UDP traffic to
+// using STUN servers:
+//
+//  p, err := NewSTUNProvider([]string{"stun.example.com:3478"})
+//  ip, err := p.Get()
+//
+// The router can be asked for its external IP address directly, using UPnP
+// (UPnPProvider) or NAT-PMP and PCP (NATPMPProvider). The gateway is
+// discovered using SSDP for UPnP and from the routing table, on Linux only,
+// for NAT-PMP and PCP:
+//
+//  p, err := NewUPnPProvider()
+//  p, err := NewNATPMPProvider("192.168.1.1")
+//
+// Every method that performs network operations has a context-aware variant
+// which allows callers to cancel work that is in progress:
+//
+//  ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+//  defer cancel()
+//  ip, err := IpifyProvider.GetContext(ctx)
+//
+// The providers in this package implement the IPProviderContext and
+// DNSZoneContext interfaces. For any IPProvider or DNSZone, the GetContext,
+// UpdateAContext, UpdateAAAAContext and NameserversContext functions use the
+// context-aware variant when it is available:
+//
+//  ip, err := GetContext(ctx, myIPProvider)
+//
 // DNS Client
 //
 // To request for an A record from a set of nameservers:
@@ -46,23 +93,107 @@
 //  c := NewDNSClient()
 //  ip, err := c.ResolveA("test.example.com", []string{"8.8.8.8"})
 //
+// ResolveAAAA works the same way for AAAA records. CNAMEs are followed and
+// ResolveChain also returns the names that were traversed:
+//
+//  ips, chain, err := c.ResolveChain("test.example.com", dns.TypeA, []string{"8.8.8.8"})
+//
+// To query a set of nameservers at once and find out whether they agree, e.g.
+// while a change propagates to the authoritative nameservers of a zone:
+//
+//  results := c.ResolveAll("test.example.com", dns.TypeA, nameservers)
+//  if !results.Consistent() {
+//  	fmt.Println(results)
+//  }
+//
+// Nameservers can also be queried over TCP, DNS over TLS or DNS over HTTPS by
+// using URLs instead of addresses, which works for the DNSProvider as well:
+//
+//  ip, err := c.ResolveA("test.example.com", []string{"tls://1.1.1.1"})
+//  ip, err := c.ResolveA("test.example.com", []string{"https://dns.google/dns-query"})
+//
 // DNS Zone Providers
 //
-// DNS providers are tasked with updating A records:
+// DNS providers are tasked with updating A and AAAA records:
 //
 //  p, err := NewRoute53Zone()
 //  err := p.UpdateA("test.example.com", "example.com.", net.ParseIP("1.2.3.4"))
+//  err := p.UpdateAAAA("test.example.com", "example.com.", net.ParseIP("2001:db8::1"))
+//
+// Zones hosted on Cloudflare can be managed using an API token:
+//
+//  p, err := NewCloudflareZone("my-api-token")
+//
+// Google Cloud DNS managed zones can be managed using the JSON key of a
+// service account:
+//
+//  credentials, err := ioutil.ReadFile("service-account.json")
+//  p, err := NewGoogleCloudDNSZone(credentials)
+//
+// Domains hosted on DigitalOcean can be managed using a personal access token:
+//
+//  p, err := NewDigitalOceanZone("my-api-token")
+//
+// Azure DNS zones can be managed using the credentials of a service
+// principal:
+//
+//  p, err := NewAzureDNSZoneWithOptions(&AzureDNSZoneOptions{
+//  	TenantID:       "my-tenant-id",
+//  	ClientID:       "my-client-id",
+//  	ClientSecret:   "my-client-secret",
+//  	SubscriptionID: "my-subscription-id",
+//  	ResourceGroup:  "my-resource-group",
+//  })
+//
+// PowerDNS Authoritative Servers can be managed through their HTTP API:
+//
+//  p, err := NewPowerDNSZone("http://ns1.example.com:8081", "my-api-key")
+//
+// Dynamic DNS services that implement the dyndns2 protocol, such as No-IP,
+// Dyn and DNS-O-Matic, can be managed using the account's credentials:
+//
+//  p, err := NewDynDNS2Zone("https://dynupdate.no-ip.com", "username", "password")
+//
+// Nameservers that accept RFC 2136 dynamic updates, such as BIND, Knot and
+// PowerDNS, can be managed using TSIG signed updates:
+//
+//  p, err := NewRFC2136ZoneWithOptions(&RFC2136ZoneOptions{
+//  	Server:      "ns1.example.com:53",
+//  	TSIGKeyName: "odyn",
+//  	TSIGSecret:  "c2VjcmV0",
+//  })
 package odyn
 
 import (
+	"context"
 	"encoding/json"
 	"net"
+
+	"github.com/miekg/dns"
 )
 
 var (
 	// IpifyProvider uses ipify.org to discover the public IP address.
 	IpifyProvider, _ = NewHTTPProvider("https://api.ipify.org")
 
+	// Ipify6Provider uses ipify.org to discover the public IPv6 address.
+	Ipify6Provider, _ = NewHTTPProviderWithOptions(&HTTPProviderOptions{
+		URL:   "https://api6.ipify.org",
+		Parse: ipify6Parser,
+	})
+	ipify6Parser = func(body []byte) (net.IP, error) {
+		ip, err := defaultHTTPProviderParser(body)
+		if err != nil {
+			return nil, err
+		}
+
+		if ip.To4() != nil {
+			return nil, ErrHTTPProviderNotIPv6
+		}
+
+		return ip, nil
+	}
+
 	// IPInfoProvider uses ipinfo.io to discover the public IP address.
 	IPInfoProvider, _ = NewHTTPProviderWithOptions(&HTTPProviderOptions{
 		URL:   "https://ipinfo.io",
@@ -97,6 +228,82 @@ var (
 		"208.67.222.220:53", // resolver3.opendns.com
 		"208.67.220.222:53", // resolver4.opendns.com
 	})
+
+	// OpenDNS6Provider uses OpenDNS's IPv6 nameservers to discover the
+	// public IPv6 address.
+	OpenDNS6Provider, _ = NewDNSProvider6("myip.opendns.com.", []string{
+		"[2620:0:ccc::2]:53", // resolver1.ipv6-sandbox.opendns.com
+		"[2620:0:ccd::2]:53", // resolver2.ipv6-sandbox.opendns.com
+	})
+
+	// GoogleDNSProvider uses Google's nameservers to discover the public IP
+	// address, which they return as a TXT record.
+	GoogleDNSProvider, _ = NewDNSProviderWithOptions(&DNSProviderOptions{
+		Record: "o-o.myaddr.l.google.com.",
+		Type:   dns.TypeTXT,
+		Nameservers: []string{
+			"216.239.32.10:53", // ns1.google.com
+			"216.239.34.10:53", // ns2.google.com
+		},
+	})
+
+	// GoogleDNS6Provider uses Google's IPv6 nameservers to discover the
+	// public IPv6 address.
+	GoogleDNS6Provider, _ = NewDNSProviderWithOptions(&DNSProviderOptions{
+		Record: "o-o.myaddr.l.google.com.",
+		Type:   dns.TypeTXT,
+		Nameservers: []string{
+			"[2001:4860:4802:32::a]:53", // ns1.google.com
+			"[2001:4860:4802:34::a]:53", // ns2.google.com
+		},
+		Parse: dns6Parser,
+	})
+
+	// CloudflareDNSProvider uses Cloudflare's resolvers to discover the
+	// public IP address, which they return as a CHAOS class TXT record.
+	CloudflareDNSProvider, _ = NewDNSProviderWithOptions(&DNSProviderOptions{
+		Record: "whoami.cloudflare.",
+		Type:   dns.TypeTXT,
+		Class:  dns.ClassCHAOS,
+		Nameservers: []string{
+			"1.1.1.1:53",
+			"1.0.0.1:53",
+		},
+	})
+
+	// CloudflareDNS6Provider uses Cloudflare's IPv6 resolvers to discover
+	// the public IPv6 address.
+	CloudflareDNS6Provider, _ = NewDNSProviderWithOptions(&DNSProviderOptions{
+		Record: "whoami.cloudflare.",
+		Type:   dns.TypeTXT,
+		Class:  dns.ClassCHAOS,
+		Nameservers: []string{
+			"[2606:4700:4700::1111]:53",
+			"[2606:4700:4700::1001]:53",
+		},
+		Parse: dns6Parser,
+	})
+
+	dns6Parser = func(rr dns.RR) (net.IP, error) {
+		ip, err := parseDNSAnswer(rr)
+		if err != nil {
+			return nil, err
+		}
+
+		if ip.To4() != nil {
+			return nil, ErrDNSProviderNotIPv6
+		}
+
+		return ip, nil
+	}
+
+	// GoogleSTUNProvider uses Google's STUN servers to discover the public IP
+	// address.
+	GoogleSTUNProvider, _ = NewSTUNProvider([]string{
+		"stun.l.google.com:19302",
+		"stun1.l.google.com:19302",
+		"stun2.l.google.com:19302",
+	})
 )
 
 // IPProvider is an interface for IP providers to implement.
@@ -104,8 +311,83 @@ type IPProvider interface {
 	Get() (net.IP, error)
 }
 
+// IPProviderContext is implemented by IP providers that can abort the
+// discovery of the IP address when a context is cancelled.
+type IPProviderContext interface {
+	IPProvider
+	GetContext(ctx context.Context) (net.IP, error)
+}
+
 // DNSZone is an interface for DNS Zone providers to implement.
 type DNSZone interface {
 	UpdateA(recordName string, zoneName string, ip net.IP) error
+	UpdateAAAA(recordName string, zoneName string, ip net.IP) error
 	Nameservers(zoneName string) ([]string, error)
 }
+
+// DNSZoneContext is implemented by DNS Zone providers that can abort updates
+// and lookups when a context is cancelled.
+type DNSZoneContext interface {
+	DNSZone
+	UpdateAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error
+	UpdateAAAAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error
+	NameserversContext(ctx context.Context, zoneName string) ([]string, error)
+}
+
+// GetContext discovers the IP address using the provider. The context is
+// passed on if the provider implements IPProviderContext, otherwise it is
+// only checked before calling Get.
+func GetContext(ctx context.Context, p IPProvider) (net.IP, error) {
+	if pc, ok := p.(IPProviderContext); ok {
+		return pc.GetContext(ctx)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return p.Get()
+}
+
+// UpdateAContext sets the A record using the DNS zone provider. The context
+// is passed on if the zone implements DNSZoneContext, otherwise it is only
+// checked before calling UpdateA.
+func UpdateAContext(ctx context.Context, z DNSZone, recordName string, zoneName string, ip net.IP) error {
+	if zc, ok := z.(DNSZoneContext); ok {
+		return zc.UpdateAContext(ctx, recordName, zoneName, ip)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return z.UpdateA(recordName, zoneName, ip)
+}
+
+// UpdateAAAAContext is like UpdateAContext but sets the AAAA record.
+func UpdateAAAAContext(ctx context.Context, z DNSZone, recordName string, zoneName string, ip net.IP) error {
+	if zc, ok := z.(DNSZoneContext); ok {
+		return zc.UpdateAAAAContext(ctx, recordName, zoneName, ip)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return z.UpdateAAAA(recordName, zoneName, ip)
+}
+
+// NameserversContext returns the authoritative nameservers of the zone using
+// the DNS zone provider. The context is passed on if the zone implements
+// DNSZoneContext, otherwise it is only checked before calling Nameservers.
+func NameserversContext(ctx context.Context, z DNSZone, zoneName string) ([]string, error) {
+	if zc, ok := z.(DNSZoneContext); ok {
+		return zc.NameserversContext(ctx, zoneName)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return z.Nameservers(zoneName)
+}
@@ -1,11 +1,15 @@
 package odyn
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/miekg/dns"
 )
 
 var (
@@ -19,6 +23,16 @@ var (
 		{``, 500, ErrHTTPProviderInvalidResponseCode},
 		{``, 200, errors.New("unexpected end of JSON input")},
 	}
+
+	testCasesIpify6 = []struct {
+		resp string
+		err  error
+	}{
+		{"2001:db8::1", nil},
+		{"1.2.3.4", ErrHTTPProviderNotIPv6},
+		{"::ffff:1.2.3.4", ErrHTTPProviderNotIPv6},
+		{"not an ip", ErrHTTPProviderCouldNotParseIP},
+	}
 )
 
 func TestIPInfoProvider_Get(t *testing.T) {
@@ -67,3 +81,135 @@ func TestIPInfoProvider_Get(t *testing.T) {
 		}
 	}
 }
+
+func TestIpify6Provider_Get(t *testing.T) {
+	var resp string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, resp)
+	}))
+	defer ts.Close()
+
+	p, _ := NewHTTPProviderWithOptions(&HTTPProviderOptions{
+		URL:   ts.URL,
+		Parse: ipify6Parser,
+	})
+
+	for i, testCase := range testCasesIpify6 {
+		resp = testCase.resp
+
+		ip, err := p.Get()
+		if err != testCase.err {
+			t.Errorf("Ipify6.Get() returned unexpected error for case %02d: %+v", i, err)
+			continue
+		}
+
+		if err == nil && ip.String() != testCase.resp {
+			t.Errorf("Ipify6.Get() returned unexpected IP for case %02d: %s", i, ip)
+		}
+	}
+}
+
+func TestDNS6Parser(t *testing.T) {
+	servers, serverAddresses, err := startMockDNSServerFleet(map[string][]string{
+		"v6.example.com.":      []string{"2001:db8::1"},
+		"v4.example.com.":      []string{"1.2.3.4"},
+		"mapped.example.com.":  []string{"::ffff:1.2.3.4"},
+		"invalid.example.com.": []string{"not an ip"},
+	})
+	defer stopMockDNSServerFleet(servers)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+
+	testCases := []struct {
+		record string
+		err    error
+	}{
+		{"v6.example.com.", nil},
+		{"v4.example.com.", ErrDNSProviderNotIPv6},
+		{"mapped.example.com.", ErrDNSProviderNotIPv6},
+		{"invalid.example.com.", ErrDNSCouldNotParseIP},
+	}
+
+	for _, testCase := range testCases {
+		p, _ := NewDNSProviderWithOptions(&DNSProviderOptions{
+			Record:      testCase.record,
+			Type:        dns.TypeTXT,
+			Nameservers: serverAddresses,
+			Parse:       dns6Parser,
+		})
+
+		ip, err := p.Get()
+		if err != testCase.err {
+			t.Errorf("DNSProvider.Get returned unexpected error for %s: %+v", testCase.record, err)
+			continue
+		}
+
+		if err == nil && !ip.Equal(net.ParseIP("2001:db8::1")) {
+			t.Errorf("DNSProvider.Get returned unexpected response for %s: %s", testCase.record, ip)
+		}
+	}
+}
+
+// plainProvider and plainZone only implement the interfaces without the
+// context-aware methods.
+type plainProvider struct{ ip net.IP }
+
+func (p *plainProvider) Get() (net.IP, error) { return p.ip, nil }
+
+type plainZone struct{ updated string }
+
+func (z *plainZone) UpdateA(recordName string, zoneName string, ip net.IP) error {
+	z.updated = "A " + ip.String()
+	return nil
+}
+
+func (z *plainZone) UpdateAAAA(recordName string, zoneName string, ip net.IP) error {
+	z.updated = "AAAA " + ip.String()
+	return nil
+}
+
+func (z *plainZone) Nameservers(zoneName string) ([]string, error) {
+	return []string{"ns1.example.com."}, nil
+}
+
+func TestGetContext_fallback(t *testing.T) {
+	p := &plainProvider{ip: net.ParseIP("1.2.3.4")}
+
+	ip, err := GetContext(context.Background(), p)
+	if err != nil || !ip.Equal(p.ip) {
+		t.Errorf("GetContext returned unexpected result: %s, %+v", ip, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := GetContext(ctx, p); err != context.Canceled {
+		t.Errorf("GetContext returned unexpected error for a cancelled context: %+v", err)
+	}
+}
+
+func TestDNSZoneContext_fallback(t *testing.T) {
+	z := &plainZone{}
+	ctx := context.Background()
+
+	if err := UpdateAContext(ctx, z, "test.example.com.", "example.com.", net.ParseIP("1.2.3.4")); err != nil || z.updated != "A 1.2.3.4" {
+		t.Errorf("UpdateAContext returned unexpected result: %q, %+v", z.updated, err)
+	}
+
+	if err := UpdateAAAAContext(ctx, z, "test.example.com.", "example.com.", net.ParseIP("2001:db8::1")); err != nil || z.updated != "AAAA 2001:db8::1" {
+		t.Errorf("UpdateAAAAContext returned unexpected result: %q, %+v", z.updated, err)
+	}
+
+	ns, err := NameserversContext(ctx, z, "example.com.")
+	if err != nil || len(ns) != 1 {
+		t.Errorf("NameserversContext returned unexpected result: %v, %+v", ns, err)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	z.updated = ""
+	if err := UpdateAContext(cctx, z, "test.example.com.", "example.com.", net.ParseIP("1.2.3.4")); err != context.Canceled || z.updated != "" {
+		t.Errorf("UpdateAContext returned unexpected result for a cancelled context: %q, %+v", z.updated, err)
+	}
+}
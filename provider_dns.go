@@ -15,8 +15,12 @@
 package odyn
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net"
+
+	"github.com/miekg/dns"
 )
 
 var (
@@ -28,28 +32,120 @@ var (
 	// addresses where obtained from the set of nameservers. In this case, the
 	// provider will, however, return the first IP address instead of nil.
 	ErrDNSProviderMultipleResults = errors.New("dns provider returned multiple different results")
+
+	// ErrDNSProviderNotIPv6 is returned when an IPv6 provider answers with an
+	// IPv4 address.
+	ErrDNSProviderNotIPv6 = errors.New("dns provider returned an address that is not IPv6")
 )
 
+// DNSProviderInconsistentError is returned by a DNSProvider querying its
+// nameservers in parallel when they disagree on the answer. In this case, the
+// provider will, however, return the first IP address of the first
+// nameserver that answered instead of nil.
+type DNSProviderInconsistentError struct {
+	Results DNSResults
+}
+
+func (e *DNSProviderInconsistentError) Error() string {
+	return fmt.Sprintf("dns provider nameservers returned different results: %s", e.Results)
+}
+
 // DNSProvider sends queries to a DNS nameserver to discover the public IP
 // address.
 type DNSProvider struct {
-	dns         *DNSClient
-	record      string
-	nameservers []string
+	dns     *DNSClient
+	options *DNSProviderOptions
+}
+
+// DNSProviderOptions are used to alter the behaviour of the DNSProvider.
+type DNSProviderOptions struct {
+	// Record to ask for, e.g. myip.opendns.com.
+	Record string
+
+	// Nameservers to send the query to, tried in order. See DNSClient for
+	// the supported transports.
+	Nameservers []string
+
+	// Parallel queries all of the nameservers at once instead of one at a
+	// time and returns a DNSProviderInconsistentError when they disagree.
+	Parallel bool
+
+	// Type of the query, e.g. dns.TypeA, dns.TypeAAAA or dns.TypeTXT.
+	// Defaults to dns.TypeA.
+	Type uint16
+
+	// Class of the query, e.g. dns.ClassINET or dns.ClassCHAOS. Defaults to
+	// dns.ClassINET.
+	Class uint16
+
+	// Function to extract the IP address from the records in the answer.
+	// The default reads A and AAAA records and parses TXT records.
+	Parse DNSAnswerParser
+
+	// DNS Client used to send the queries, e.g. to customise the TLS
+	// configuration of DNS over TLS queries.
+	Client *DNSClient
 }
 
-// NewDNSProvider returns an instantiated DNSProvider.
+// NewDNSProvider returns an instantiated DNSProvider that discovers the public
+// IPv4 address by asking for an A record.
 func NewDNSProvider(record string, nameservers []string) (*DNSProvider, error) {
+	return NewDNSProviderWithOptions(&DNSProviderOptions{
+		Record:      record,
+		Nameservers: nameservers,
+		Type:        dns.TypeA,
+	})
+}
+
+// NewDNSProvider6 returns an instantiated DNSProvider that discovers the
+// public IPv6 address by asking for an AAAA record.
+func NewDNSProvider6(record string, nameservers []string) (*DNSProvider, error) {
+	return NewDNSProviderWithOptions(&DNSProviderOptions{
+		Record:      record,
+		Nameservers: nameservers,
+		Type:        dns.TypeAAAA,
+	})
+}
+
+// NewDNSProviderWithOptions allows you to specify the DNSProviderOptions,
+// e.g. to discover the public IP address from services that answer TXT
+// queries.
+func NewDNSProviderWithOptions(options *DNSProviderOptions) (*DNSProvider, error) {
+	if options.Type == 0 {
+		options.Type = dns.TypeA
+	}
+
+	if options.Class == 0 {
+		options.Class = dns.ClassINET
+	}
+
+	if options.Parse == nil {
+		options.Parse = parseDNSAnswer
+	}
+
+	if options.Client == nil {
+		options.Client = NewDNSClient()
+	}
+
 	return &DNSProvider{
-		dns:         NewDNSClient(),
-		record:      record,
-		nameservers: nameservers,
+		dns:     options.Client,
+		options: options,
 	}, nil
 }
 
 // Get performs a DNS query and returns the IP address in the answer.
 func (p DNSProvider) Get() (net.IP, error) {
-	ips, err := p.dns.ResolveA(p.record, p.nameservers)
+	return p.GetContext(context.Background())
+}
+
+// GetContext is like Get but aborts the DNS queries when the context is
+// cancelled.
+func (p DNSProvider) GetContext(ctx context.Context) (net.IP, error) {
+	if p.options.Parallel {
+		return p.getParallel(ctx)
+	}
+
+	ips, _, err := p.dns.query(ctx, p.options.Record, p.options.Type, p.options.Class, p.options.Nameservers, p.options.Parse)
 	if err != nil {
 		return nil, err
 	}
@@ -64,3 +160,25 @@ func (p DNSProvider) Get() (net.IP, error) {
 
 	return ips[0], nil
 }
+
+func (p DNSProvider) getParallel(ctx context.Context) (net.IP, error) {
+	results := p.dns.queryAll(ctx, p.options.Record, p.options.Type, p.options.Class, p.options.Nameservers, p.options.Parse)
+
+	first := results.First()
+	if first == nil {
+		if len(results) > 0 {
+			return nil, results[0].Err
+		}
+		return nil, ErrDNSProviderNoResults
+	}
+
+	if !results.Consistent() {
+		return first.IPs[0], &DNSProviderInconsistentError{Results: results}
+	}
+
+	if len(first.IPs) > 1 {
+		return first.IPs[0], ErrDNSProviderMultipleResults
+	}
+
+	return first.IPs[0], nil
+}
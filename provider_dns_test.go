@@ -16,7 +16,10 @@ package odyn
 
 import (
 	"net"
+	"strings"
 	"testing"
+
+	"github.com/miekg/dns"
 )
 
 func TestDNSProvider_Get(t *testing.T) {
@@ -93,3 +96,198 @@ func TestDNSProvider_Get_multipleDifferent(t *testing.T) {
 		t.Fatalf("DNSProvider.Get returned unexpected response")
 	}
 }
+
+func TestDNSProvider6_Get(t *testing.T) {
+	servers, serverAddresses, err := startMockDNSServerFleet(map[string][]string{"myip.opendns.com.": []string{"1.1.1.1", "2001:db8::1"}})
+	defer stopMockDNSServerFleet(servers)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+
+	p, _ := NewDNSProvider6("myip.opendns.com.", serverAddresses)
+
+	ip, err := p.Get()
+	if err != nil {
+		t.Fatalf("DNSProvider.Get returned unexpected error: %+v", err)
+	}
+
+	if !ip.Equal(net.ParseIP("2001:db8::1")) {
+		t.Fatalf("DNSProvider.Get returned unexpected response")
+	}
+}
+
+func TestDNSProvider_Get_TXT(t *testing.T) {
+	servers, serverAddresses, err := startMockDNSServerFleet(map[string][]string{"o-o.myaddr.l.google.com.": []string{"edns0-client-subnet 1.2.3.0/24", "1.2.3.4"}})
+	defer stopMockDNSServerFleet(servers)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+
+	p, _ := NewDNSProviderWithOptions(&DNSProviderOptions{
+		Record:      "o-o.myaddr.l.google.com.",
+		Type:        dns.TypeTXT,
+		Nameservers: serverAddresses,
+	})
+
+	ip, err := p.Get()
+	if err != nil {
+		t.Fatalf("DNSProvider.Get returned unexpected error: %+v", err)
+	}
+
+	if !ip.Equal(net.ParseIP("1.2.3.4")) {
+		t.Fatalf("DNSProvider.Get returned unexpected response: %s", ip)
+	}
+}
+
+func TestDNSProvider_Get_TXTInvalid(t *testing.T) {
+	servers, serverAddresses, err := startMockDNSServerFleet(map[string][]string{"o-o.myaddr.l.google.com.": []string{"not an ip"}})
+	defer stopMockDNSServerFleet(servers)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+
+	p, _ := NewDNSProviderWithOptions(&DNSProviderOptions{
+		Record:      "o-o.myaddr.l.google.com.",
+		Type:        dns.TypeTXT,
+		Nameservers: serverAddresses,
+	})
+
+	if _, err := p.Get(); err != ErrDNSCouldNotParseIP {
+		t.Fatalf("DNSProvider.Get returned unexpected error: %+v", err)
+	}
+}
+
+func TestDNSProvider_Get_CHAOS(t *testing.T) {
+	mux := dns.NewServeMux()
+	mux.HandleFunc("whoami.cloudflare.", func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		if req.Question[0].Qclass != dns.ClassCHAOS {
+			m.Rcode = dns.RcodeRefused
+			w.WriteMsg(m)
+			return
+		}
+
+		m.Answer = append(m.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassCHAOS},
+			Txt: []string{"2001:db8::1"},
+		})
+		w.WriteMsg(m)
+	})
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: mux}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	p, _ := NewDNSProviderWithOptions(&DNSProviderOptions{
+		Record:      "whoami.cloudflare.",
+		Type:        dns.TypeTXT,
+		Class:       dns.ClassCHAOS,
+		Nameservers: []string{pc.LocalAddr().String()},
+	})
+
+	ip, err := p.Get()
+	if err != nil {
+		t.Fatalf("DNSProvider.Get returned unexpected error: %+v", err)
+	}
+
+	if !ip.Equal(net.ParseIP("2001:db8::1")) {
+		t.Fatalf("DNSProvider.Get returned unexpected response: %s", ip)
+	}
+}
+
+func TestDNSProvider_Get_customParser(t *testing.T) {
+	servers, serverAddresses, err := startMockDNSServerFleet(map[string][]string{"myip.example.com.": []string{"ip=1.2.3.4"}})
+	defer stopMockDNSServerFleet(servers)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+
+	p, _ := NewDNSProviderWithOptions(&DNSProviderOptions{
+		Record:      "myip.example.com.",
+		Type:        dns.TypeTXT,
+		Nameservers: serverAddresses,
+		Parse: func(rr dns.RR) (net.IP, error) {
+			txt, ok := rr.(*dns.TXT)
+			if !ok {
+				return nil, nil
+			}
+			return net.ParseIP(strings.TrimPrefix(txt.Txt[0], "ip=")), nil
+		},
+	})
+
+	if ip, err := p.Get(); err != nil || !ip.Equal(net.ParseIP("1.2.3.4")) {
+		t.Fatalf("DNSProvider.Get returned unexpected result: %s, %+v", ip, err)
+	}
+}
+
+func TestDNSProvider_Get_parallel(t *testing.T) {
+	servers, serverAddresses, err := startMockDNSServerFleet(map[string][]string{"myip.opendns.com.": []string{"1.2.3.4"}})
+	defer stopMockDNSServerFleet(servers)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+
+	p, _ := NewDNSProviderWithOptions(&DNSProviderOptions{
+		Record:      "myip.opendns.com.",
+		Nameservers: serverAddresses,
+		Parallel:    true,
+	})
+
+	ip, err := p.Get()
+	if err != nil {
+		t.Fatalf("DNSProvider.Get returned unexpected error: %+v", err)
+	}
+
+	if !ip.Equal(net.ParseIP("1.2.3.4")) {
+		t.Fatalf("DNSProvider.Get returned unexpected response: %+v", ip)
+	}
+}
+
+func TestDNSProvider_Get_parallelInconsistent(t *testing.T) {
+	s1, addr1, err := startMockDNSServer("127.0.0.1:0", map[string][]string{"myip.opendns.com.": []string{"1.2.3.4"}})
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	s2, addr2, err := startMockDNSServer("127.0.0.1:0", map[string][]string{"myip.opendns.com.": []string{"5.6.7.8"}})
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer stopMockDNSServerFleet([]*dns.Server{s1, s2})
+
+	p, _ := NewDNSProviderWithOptions(&DNSProviderOptions{
+		Record:      "myip.opendns.com.",
+		Nameservers: []string{"127.0.0.1:10000", addr1, addr2},
+		Parallel:    true,
+	})
+
+	ip, err := p.Get()
+	inconsistent, ok := err.(*DNSProviderInconsistentError)
+	if !ok {
+		t.Fatalf("DNSProvider.Get returned unexpected error: %+v", err)
+	}
+
+	if len(inconsistent.Results) != 3 || inconsistent.Results[0].Err == nil {
+		t.Errorf("DNSProvider.Get returned unexpected results: %s", inconsistent.Results)
+	}
+
+	if !ip.Equal(net.ParseIP("1.2.3.4")) {
+		t.Fatalf("DNSProvider.Get returned unexpected response: %+v", ip)
+	}
+}
+
+func TestDNSProvider_Get_parallelError(t *testing.T) {
+	p, _ := NewDNSProviderWithOptions(&DNSProviderOptions{
+		Record:      "myip.opendns.com.",
+		Nameservers: []string{"127.0.0.1:10000"},
+		Parallel:    true,
+	})
+
+	if _, err := p.Get(); err == nil {
+		t.Fatalf("DNSProvider.Get did not return an error")
+	}
+}
@@ -15,6 +15,7 @@
 package odyn
 
 import (
+	"context"
 	"errors"
 	"io"
 	"io/ioutil"
@@ -32,6 +33,10 @@ var (
 	// to parse the IP address from the response body.
 	ErrHTTPProviderCouldNotParseIP = errors.New("provider could not parse IP address from the response")
 
+	// ErrHTTPProviderNotIPv6 is returned when an IPv6 provider responds with
+	// an IPv4 address.
+	ErrHTTPProviderNotIPv6 = errors.New("provider returned an address that is not IPv6")
+
 	// ErrHTTPProviderURLIsRequired is returned when trying to create an
 	// HTTPProvider with a nil URL address.
 	ErrHTTPProviderURLIsRequired = errors.New("the URL option is required")
@@ -43,11 +48,12 @@ var (
 		"User-Agent": "odyn/0",
 	}
 
-	defaultHTTPProviderRequester = func(options *HTTPProviderOptions) ([]byte, error) {
+	defaultHTTPProviderRequester = func(ctx context.Context, options *HTTPProviderOptions) ([]byte, error) {
 		req, err := http.NewRequest(http.MethodGet, options.URL, nil)
 		if err != nil {
 			return nil, err
 		}
+		req = req.WithContext(ctx)
 
 		for k, v := range options.Headers {
 			req.Header.Set(k, v)
@@ -109,8 +115,9 @@ type HTTPProviderOptions struct {
 }
 
 // HTTPProviderRequester is tasked with sending an HTTP request to the service
-// ander returning the body of the response if the request was successful.
-type HTTPProviderRequester func(options *HTTPProviderOptions) ([]byte, error)
+// ander returning the body of the response if the request was successful. The
+// request should be aborted when the context is cancelled.
+type HTTPProviderRequester func(ctx context.Context, options *HTTPProviderOptions) ([]byte, error)
 
 // HTTPProviderResponseParser is tasked with parsing the HTTP response body and
 // returning an IP address.
@@ -155,7 +162,13 @@ func NewHTTPProviderWithOptions(options *HTTPProviderOptions) (*HTTPProvider, er
 // Get will discover the public IP address using the HTTP service defined in
 // the options of the HTTPProvider.
 func (p *HTTPProvider) Get() (net.IP, error) {
-	body, err := p.options.Request(p.options)
+	return p.GetContext(context.Background())
+}
+
+// GetContext is like Get but aborts the HTTP request when the context is
+// cancelled.
+func (p *HTTPProvider) GetContext(ctx context.Context) (net.IP, error) {
+	body, err := p.options.Request(ctx, p.options)
 	if err != nil {
 		return nil, err
 	}
@@ -15,12 +15,14 @@
 package odyn
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 var (
@@ -117,6 +119,27 @@ func TestHTTPProvider_Get_noConnectivity(t *testing.T) {
 	}
 }
 
+func TestHTTPProvider_GetContext_cancelled(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	p, err := NewHTTPProvider(ts.URL)
+	if err != nil {
+		t.Fatalf("NewHTTPProvider returned unexpected error: %+v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err = p.GetContext(ctx); err == nil {
+		t.Errorf("HTTPProvider.GetContext did not return expected error")
+	}
+}
+
 func TestNewHTTPProvider_error(t *testing.T) {
 	if _, err := NewHTTPProvider(""); err != ErrHTTPProviderURLIsRequired {
 		t.Errorf("NewHTTPProvider returned unexpected error: %+v", err)
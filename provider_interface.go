@@ -0,0 +1,194 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+var (
+	// ErrInterfaceProviderNameIsRequired is returned when trying to create an
+	// InterfaceProvider without an interface name.
+	ErrInterfaceProviderNameIsRequired = errors.New("the interface name is required")
+
+	// ErrInterfaceProviderNoAddress is returned when none of the interface's
+	// addresses match the provider's filters.
+	ErrInterfaceProviderNoAddress = errors.New("interface has no matching address")
+
+	// privateIPNets are the ranges that are not routable on the internet:
+	// RFC 1918 and RFC 6598 (carrier-grade NAT) for IPv4 and RFC 4193
+	// (unique local addresses) for IPv6.
+	privateIPNets = mustParseCIDRs(
+		"10.0.0.0/8",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"100.64.0.0/10",
+		"fc00::/7",
+	)
+)
+
+// InterfaceProviderScope selects addresses by their scope.
+type InterfaceProviderScope int
+
+const (
+	// InterfaceProviderScopeGlobal selects global unicast addresses. This is
+	// the default.
+	InterfaceProviderScopeGlobal InterfaceProviderScope = iota
+
+	// InterfaceProviderScopeLinkLocal selects link-local unicast addresses.
+	InterfaceProviderScopeLinkLocal
+
+	// InterfaceProviderScopeAny selects addresses of any scope, including
+	// loopback addresses.
+	InterfaceProviderScopeAny
+)
+
+// InterfaceProvider reads the IP address directly from a local network
+// interface, which is useful for hosts that have a public IP address assigned
+// to them.
+type InterfaceProvider struct {
+	options *InterfaceProviderOptions
+
+	// addrs returns the addresses of the interface, it is replaced in tests.
+	addrs func(name string) ([]net.Addr, error)
+}
+
+// InterfaceProviderOptions are used to alter the behaviour of the
+// InterfaceProvider.
+type InterfaceProviderOptions struct {
+	// Name of the network interface, e.g. eth0.
+	Interface string
+
+	// IPv6 selects IPv6 addresses instead of IPv4 ones.
+	IPv6 bool
+
+	// Scope of the addresses to select.
+	Scope InterfaceProviderScope
+
+	// AllowPrivate includes addresses in private ranges, which are excluded
+	// by default.
+	AllowPrivate bool
+}
+
+// NewInterfaceProvider returns an InterfaceProvider that reads the public
+// IPv4 address of the named interface.
+func NewInterfaceProvider(name string) (*InterfaceProvider, error) {
+	return NewInterfaceProviderWithOptions(&InterfaceProviderOptions{Interface: name})
+}
+
+// NewInterfaceProvider6 returns an InterfaceProvider that reads the public
+// IPv6 address of the named interface.
+func NewInterfaceProvider6(name string) (*InterfaceProvider, error) {
+	return NewInterfaceProviderWithOptions(&InterfaceProviderOptions{Interface: name, IPv6: true})
+}
+
+// NewInterfaceProviderWithOptions allows you to specify the
+// InterfaceProviderOptions and customise which addresses are selected.
+func NewInterfaceProviderWithOptions(options *InterfaceProviderOptions) (*InterfaceProvider, error) {
+	if options.Interface == "" {
+		return nil, ErrInterfaceProviderNameIsRequired
+	}
+
+	return &InterfaceProvider{options: options, addrs: interfaceAddrs}, nil
+}
+
+func interfaceAddrs(name string) ([]net.Addr, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return iface.Addrs()
+}
+
+// Get returns the first address of the interface that matches the filters.
+func (p *InterfaceProvider) Get() (net.IP, error) {
+	return p.GetContext(context.Background())
+}
+
+// GetContext is like Get. Reading the interface addresses does not block, so
+// the context is only checked before doing so.
+func (p *InterfaceProvider) GetContext(ctx context.Context) (net.IP, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	addrs, err := p.addrs(p.options.Interface)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addrs {
+		var ip net.IP
+		switch a := addr.(type) {
+		case *net.IPNet:
+			ip = a.IP
+		case *net.IPAddr:
+			ip = a.IP
+		default:
+			continue
+		}
+
+		if p.matches(ip) {
+			return ip, nil
+		}
+	}
+
+	return nil, ErrInterfaceProviderNoAddress
+}
+
+func (p *InterfaceProvider) matches(ip net.IP) bool {
+	if (ip.To4() == nil) != p.options.IPv6 {
+		return false
+	}
+
+	switch p.options.Scope {
+	case InterfaceProviderScopeGlobal:
+		if !ip.IsGlobalUnicast() {
+			return false
+		}
+	case InterfaceProviderScopeLinkLocal:
+		if !ip.IsLinkLocalUnicast() {
+			return false
+		}
+	}
+
+	return p.options.AllowPrivate || !isPrivateIP(ip)
+}
+
+func isPrivateIP(ip net.IP) bool {
+	for _, n := range privateIPNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+
+	return nets
+}
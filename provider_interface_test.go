@@ -0,0 +1,114 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func testInterfaceAddrs(name string) ([]net.Addr, error) {
+	var addrs []net.Addr
+	for _, c := range []string{"127.0.0.1/8", "192.168.1.10/24", "169.254.1.1/16", "203.0.113.5/24", "::1/128", "fe80::1/64", "fd00::1/64", "2001:db8::1/64"} {
+		ip, n, _ := net.ParseCIDR(c)
+		n.IP = ip
+		addrs = append(addrs, n)
+	}
+
+	return addrs, nil
+}
+
+func TestNewInterfaceProvider_nameIsRequired(t *testing.T) {
+	if _, err := NewInterfaceProvider(""); err != ErrInterfaceProviderNameIsRequired {
+		t.Errorf("NewInterfaceProvider returned unexpected error: %+v", err)
+	}
+}
+
+func TestInterfaceProvider_Get(t *testing.T) {
+	testCases := []struct {
+		options  InterfaceProviderOptions
+		expected string
+	}{
+		{InterfaceProviderOptions{}, "203.0.113.5"},
+		{InterfaceProviderOptions{AllowPrivate: true}, "192.168.1.10"},
+		{InterfaceProviderOptions{Scope: InterfaceProviderScopeLinkLocal}, "169.254.1.1"},
+		{InterfaceProviderOptions{Scope: InterfaceProviderScopeAny}, "127.0.0.1"},
+		{InterfaceProviderOptions{IPv6: true}, "2001:db8::1"},
+		{InterfaceProviderOptions{IPv6: true, AllowPrivate: true}, "fd00::1"},
+		{InterfaceProviderOptions{IPv6: true, Scope: InterfaceProviderScopeLinkLocal}, "fe80::1"},
+	}
+
+	for _, tc := range testCases {
+		options := tc.options
+		options.Interface = "eth0"
+		p, _ := NewInterfaceProviderWithOptions(&options)
+		p.addrs = testInterfaceAddrs
+
+		ip, err := p.Get()
+		if err != nil {
+			t.Errorf("InterfaceProvider.Get returned unexpected error for %+v: %+v", tc.options, err)
+			continue
+		}
+
+		if !ip.Equal(net.ParseIP(tc.expected)) {
+			t.Errorf("InterfaceProvider.Get returned %s instead of %s for %+v", ip, tc.expected, tc.options)
+		}
+	}
+}
+
+func TestInterfaceProvider_Get_noAddress(t *testing.T) {
+	p, _ := NewInterfaceProvider("eth0")
+	p.addrs = func(name string) ([]net.Addr, error) {
+		return []net.Addr{&net.IPNet{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(8, 32)}}, nil
+	}
+
+	if _, err := p.Get(); err != ErrInterfaceProviderNoAddress {
+		t.Errorf("InterfaceProvider.Get returned unexpected error: %+v", err)
+	}
+}
+
+func TestInterfaceProvider_Get_unknownInterface(t *testing.T) {
+	p, _ := NewInterfaceProvider("odyn-does-not-exist0")
+	if _, err := p.Get(); err == nil {
+		t.Errorf("InterfaceProvider.Get did not return an error")
+	}
+}
+
+func TestInterfaceProvider_GetContext_cancelled(t *testing.T) {
+	p, _ := NewInterfaceProvider("eth0")
+	p.addrs = testInterfaceAddrs
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := p.GetContext(ctx); err != context.Canceled {
+		t.Errorf("InterfaceProvider.GetContext returned unexpected error: %+v", err)
+	}
+}
+
+func TestInterfaceProvider_inProviderSet(t *testing.T) {
+	p, _ := NewInterfaceProvider("eth0")
+	p.addrs = testInterfaceAddrs
+
+	ps, err := NewProviderSet(ProviderSetSerial, p, &testProvider{Error: ErrInterfaceProviderNoAddress})
+	if err != nil {
+		t.Fatalf("NewProviderSet returned unexpected error: %+v", err)
+	}
+
+	if ip, err := ps.Get(); err != nil || !ip.Equal(net.ParseIP("203.0.113.5")) {
+		t.Errorf("ProviderSet.Get returned unexpected result: %s, %+v", ip, err)
+	}
+}
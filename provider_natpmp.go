@@ -0,0 +1,297 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	natpmpPort    = "5351"
+	natpmpVersion = 0
+	pcpVersion    = 2
+
+	natpmpOpExternalAddress = 0
+	pcpOpMap                = 1
+	natpmpOpResponse        = 0x80
+
+	// natpmpResultUnsupportedVersion is the result code of both NAT-PMP and
+	// PCP for requests of a version that the gateway does not support.
+	natpmpResultUnsupportedVersion = 1
+
+	pcpMapRequestSize  = 60
+	pcpMapResponseSize = 60
+	pcpProtocolUDP     = 17
+
+	// pcpMappingLifetime is the lifetime, in seconds, of the mapping that is
+	// requested to learn the external address. It is deleted straight after.
+	pcpMappingLifetime = 60
+)
+
+var (
+	// ErrGatewayNotFound is returned when the default gateway could not be
+	// found in the routing table.
+	ErrGatewayNotFound = errors.New("default gateway not found")
+
+	// ErrGatewayDiscoveryUnsupported is returned when the default gateway
+	// cannot be discovered on this platform and has to be set explicitly.
+	ErrGatewayDiscoveryUnsupported = errors.New("default gateway discovery is not supported on this platform")
+
+	// ErrNATPMPProviderInvalidResponse is returned when the gateway replies
+	// with a message that is not a response to the request.
+	ErrNATPMPProviderInvalidResponse = errors.New("nat-pmp gateway returned an invalid response")
+
+	defaultNATPMPProviderTimeout = 3 * time.Second
+
+	// natpmpInitialRetransmit is the time to wait before sending the request
+	// again, doubled after every attempt as per RFC 6886.
+	natpmpInitialRetransmit = 250 * time.Millisecond
+)
+
+// NATPMPError is returned when the gateway replies with a non-zero result
+// code.
+type NATPMPError struct {
+	ResultCode int
+}
+
+func (e *NATPMPError) Error() string {
+	return fmt.Sprintf("nat-pmp gateway returned result code %d", e.ResultCode)
+}
+
+// NATPMPProvider asks the router for its external IP address using NAT-PMP
+// (RFC 6886) or its successor PCP (RFC 6887).
+//
+// PCP has no request that only returns the external address, so the provider
+// requests a short-lived UDP mapping and deletes it as soon as the response
+// arrives. Gateways that only support NAT-PMP reject PCP requests with an
+// unsupported version result, in which case the provider falls back to
+// NAT-PMP as described in RFC 6887 section 9.
+type NATPMPProvider struct {
+	options *NATPMPProviderOptions
+}
+
+// NATPMPProviderOptions are used to alter the behaviour of the
+// NATPMPProvider.
+type NATPMPProviderOptions struct {
+	// Address of the gateway, e.g. 192.168.1.1 or 192.168.1.1:5351. Defaults
+	// to the default gateway of the host, which can only be discovered on
+	// Linux.
+	Gateway string
+
+	// PCP sends PCP requests instead of NAT-PMP ones, falling back to
+	// NAT-PMP if the gateway does not support PCP.
+	PCP bool
+
+	// Timeout to wait for the gateway to respond. Defaults to 3 seconds.
+	Timeout time.Duration
+}
+
+// NewNATPMPProvider returns a NATPMPProvider that talks NAT-PMP to the
+// gateway, or to the default gateway if empty.
+func NewNATPMPProvider(gateway string) (*NATPMPProvider, error) {
+	return NewNATPMPProviderWithOptions(&NATPMPProviderOptions{Gateway: gateway})
+}
+
+// NewPCPProvider returns a NATPMPProvider that talks PCP to the gateway, or
+// to the default gateway if empty, falling back to NAT-PMP.
+func NewPCPProvider(gateway string) (*NATPMPProvider, error) {
+	return NewNATPMPProviderWithOptions(&NATPMPProviderOptions{Gateway: gateway, PCP: true})
+}
+
+// NewNATPMPProviderWithOptions allows you to specify the
+// NATPMPProviderOptions.
+func NewNATPMPProviderWithOptions(options *NATPMPProviderOptions) (*NATPMPProvider, error) {
+	if options.Gateway != "" {
+		if _, _, err := net.SplitHostPort(options.Gateway); err != nil {
+			options.Gateway = net.JoinHostPort(options.Gateway, natpmpPort)
+		}
+	}
+
+	if options.Timeout == 0 {
+		options.Timeout = defaultNATPMPProviderTimeout
+	}
+
+	return &NATPMPProvider{options: options}, nil
+}
+
+// Get asks the gateway for its external IP address.
+func (p *NATPMPProvider) Get() (net.IP, error) {
+	return p.GetContext(context.Background())
+}
+
+// GetContext is like Get but aborts the request when the context is
+// cancelled.
+func (p *NATPMPProvider) GetContext(ctx context.Context) (net.IP, error) {
+	gateway := p.options.Gateway
+	if gateway == "" {
+		ip, err := defaultGateway()
+		if err != nil {
+			return nil, err
+		}
+		gateway = net.JoinHostPort(ip.String(), natpmpPort)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.options.Timeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp4", gateway)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// unblock the read when the context is cancelled
+	go func() {
+		<-ctx.Done()
+		conn.SetDeadline(time.Now())
+	}()
+
+	if !p.options.PCP {
+		return natpmpExchange(ctx, conn, []byte{natpmpVersion, natpmpOpExternalAddress}, parseNATPMPResponse)
+	}
+
+	ip, err := pcpExchange(ctx, conn)
+	if nErr, ok := err.(*NATPMPError); ok && nErr.ResultCode == natpmpResultUnsupportedVersion {
+		return natpmpExchange(ctx, conn, []byte{natpmpVersion, natpmpOpExternalAddress}, parseNATPMPResponse)
+	}
+
+	return ip, err
+}
+
+// pcpExchange learns the external address by requesting a PCP mapping and
+// deletes the mapping once the response arrives.
+func pcpExchange(ctx context.Context, conn net.Conn) (net.IP, error) {
+	local := conn.LocalAddr().(*net.UDPAddr)
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	ip, err := natpmpExchange(ctx, conn, newPCPMapRequest(local, nonce, pcpMappingLifetime), func(msg []byte) (net.IP, error) {
+		return parsePCPMapResponse(msg, nonce)
+	})
+	if err == nil {
+		// delete the mapping, there is no need to wait for the response
+		conn.Write(newPCPMapRequest(local, nonce, 0))
+	}
+
+	return ip, err
+}
+
+// natpmpExchange sends the request, retransmitting it until a valid response
+// arrives or the context is done.
+func natpmpExchange(ctx context.Context, conn net.Conn, req []byte, parse func([]byte) (net.IP, error)) (net.IP, error) {
+	buf := make([]byte, 1100)
+	for wait := natpmpInitialRetransmit; ; wait *= 2 {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+
+		conn.SetReadDeadline(time.Now().Add(wait))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
+					break
+				}
+				return nil, err
+			}
+
+			ip, err := parse(buf[:n])
+			if err == ErrNATPMPProviderInvalidResponse {
+				// ignore stray packets, e.g. announcements
+				continue
+			}
+
+			return ip, err
+		}
+	}
+}
+
+func parseNATPMPResponse(msg []byte) (net.IP, error) {
+	if len(msg) < 4 || msg[1] != natpmpOpResponse|natpmpOpExternalAddress {
+		return nil, ErrNATPMPProviderInvalidResponse
+	}
+
+	if code := binary.BigEndian.Uint16(msg[2:4]); code != 0 {
+		return nil, &NATPMPError{ResultCode: int(code)}
+	}
+
+	if len(msg) < 12 {
+		return nil, ErrNATPMPProviderInvalidResponse
+	}
+
+	ip := make(net.IP, net.IPv4len)
+	copy(ip, msg[8:12])
+
+	return ip, nil
+}
+
+func newPCPMapRequest(local *net.UDPAddr, nonce []byte, lifetime uint32) []byte {
+	msg := make([]byte, pcpMapRequestSize)
+	msg[0] = pcpVersion
+	msg[1] = pcpOpMap
+	binary.BigEndian.PutUint32(msg[4:8], lifetime)
+	copy(msg[8:24], local.IP.To16())
+
+	copy(msg[24:36], nonce)
+	msg[36] = pcpProtocolUDP
+	binary.BigEndian.PutUint16(msg[40:42], uint16(local.Port))
+	// no suggested external port or address, the latter being the
+	// IPv4-mapped unspecified address
+	msg[54], msg[55] = 0xff, 0xff
+
+	return msg
+}
+
+func parsePCPMapResponse(msg []byte, nonce []byte) (net.IP, error) {
+	// gateways that only support NAT-PMP reply with an unsupported version
+	// result in the NAT-PMP format
+	if len(msg) >= 4 && msg[0] == natpmpVersion && msg[1]&natpmpOpResponse != 0 {
+		if code := binary.BigEndian.Uint16(msg[2:4]); code != 0 {
+			return nil, &NATPMPError{ResultCode: int(code)}
+		}
+	}
+
+	if len(msg) < 4 || msg[0] != pcpVersion || msg[1] != natpmpOpResponse|pcpOpMap {
+		return nil, ErrNATPMPProviderInvalidResponse
+	}
+
+	if msg[3] != 0 {
+		return nil, &NATPMPError{ResultCode: int(msg[3])}
+	}
+
+	if len(msg) < pcpMapResponseSize || !bytes.Equal(msg[24:36], nonce) {
+		return nil, ErrNATPMPProviderInvalidResponse
+	}
+
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, msg[44:60])
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4, nil
+	}
+
+	return ip, nil
+}
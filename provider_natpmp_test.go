@@ -0,0 +1,209 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockNATPMPGateway answers NAT-PMP and PCP requests with the external
+// address 203.0.113.7, or the given result code, ignoring the first request
+// to exercise retransmission. If noPCP is set it behaves like a gateway that
+// only supports NAT-PMP.
+type mockNATPMPGateway struct {
+	sync.Mutex
+	net.PacketConn
+	requests [][]byte
+	dropped  bool
+	result   byte
+	noPCP    bool
+}
+
+func startMockNATPMPGateway(result byte, noPCP bool) (*mockNATPMPGateway, error) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	g := &mockNATPMPGateway{PacketConn: pc, result: result, noPCP: noPCP}
+	go g.serve()
+
+	return g, nil
+}
+
+func (g *mockNATPMPGateway) serve() {
+	buf := make([]byte, 1100)
+	for {
+		n, addr, err := g.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		req := make([]byte, n)
+		copy(req, buf[:n])
+
+		g.Lock()
+		g.requests = append(g.requests, req)
+		drop := !g.dropped
+		g.dropped = true
+		g.Unlock()
+
+		if drop {
+			continue
+		}
+
+		var resp []byte
+		switch {
+		case req[0] == pcpVersion && g.noPCP:
+			resp = []byte{natpmpVersion, natpmpOpResponse | req[1], 0, 1, 0, 0, 0, 0}
+		case req[0] == pcpVersion:
+			resp = make([]byte, pcpMapResponseSize)
+			resp[0] = pcpVersion
+			resp[1] = natpmpOpResponse | pcpOpMap
+			resp[3] = g.result
+			copy(resp[4:8], req[4:8])
+			copy(resp[24:44], req[24:44])
+			copy(resp[44:60], net.ParseIP("203.0.113.7").To16())
+		default:
+			resp = make([]byte, 12)
+			resp[1] = natpmpOpResponse | natpmpOpExternalAddress
+			binary.BigEndian.PutUint16(resp[2:4], uint16(g.result))
+			copy(resp[8:12], net.ParseIP("203.0.113.7").To4())
+		}
+
+		g.WriteTo(resp, addr)
+	}
+}
+
+func TestNATPMPProvider_Get(t *testing.T) {
+	g, err := startMockNATPMPGateway(0, false)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer g.Close()
+
+	p, _ := NewNATPMPProvider(g.LocalAddr().String())
+	ip, err := p.Get()
+	if err != nil {
+		t.Fatalf("NATPMPProvider.Get returned unexpected error: %+v", err)
+	}
+
+	if !ip.Equal(net.ParseIP("203.0.113.7")) {
+		t.Errorf("NATPMPProvider.Get returned unexpected IP address: %s", ip)
+	}
+
+	g.Lock()
+	defer g.Unlock()
+	if len(g.requests) != 2 {
+		t.Errorf("NATPMPProvider.Get did not retransmit the request: %d requests", len(g.requests))
+	}
+}
+
+func TestNATPMPProvider_Get_resultCode(t *testing.T) {
+	g, err := startMockNATPMPGateway(2, false)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer g.Close()
+
+	p, _ := NewNATPMPProvider(g.LocalAddr().String())
+	if _, err := p.Get(); err == nil || err.(*NATPMPError).ResultCode != 2 {
+		t.Errorf("NATPMPProvider.Get returned unexpected error: %+v", err)
+	}
+}
+
+func TestPCPProvider_Get(t *testing.T) {
+	g, err := startMockNATPMPGateway(0, false)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer g.Close()
+
+	p, _ := NewPCPProvider(g.LocalAddr().String())
+	ip, err := p.Get()
+	if err != nil {
+		t.Fatalf("NATPMPProvider.Get returned unexpected error: %+v", err)
+	}
+
+	if !ip.Equal(net.ParseIP("203.0.113.7")) {
+		t.Errorf("NATPMPProvider.Get returned unexpected IP address: %s", ip)
+	}
+
+	// wait for the mapping to be deleted
+	time.Sleep(20 * time.Millisecond)
+	g.Lock()
+	defer g.Unlock()
+
+	if len(g.requests) != 3 {
+		t.Fatalf("NATPMPProvider.Get sent %d requests", len(g.requests))
+	}
+
+	if lifetime := binary.BigEndian.Uint32(g.requests[2][4:8]); lifetime != 0 {
+		t.Errorf("NATPMPProvider.Get did not delete the mapping, lifetime: %d", lifetime)
+	}
+}
+
+func TestPCPProvider_Get_unsupportedVersion(t *testing.T) {
+	g, err := startMockNATPMPGateway(0, true)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer g.Close()
+
+	p, _ := NewPCPProvider(g.LocalAddr().String())
+	ip, err := p.Get()
+	if err != nil {
+		t.Fatalf("NATPMPProvider.Get returned unexpected error: %+v", err)
+	}
+
+	if !ip.Equal(net.ParseIP("203.0.113.7")) {
+		t.Errorf("NATPMPProvider.Get returned unexpected IP address: %s", ip)
+	}
+
+	g.Lock()
+	defer g.Unlock()
+	if last := g.requests[len(g.requests)-1]; last[0] != natpmpVersion {
+		t.Errorf("NATPMPProvider.Get did not fall back to NAT-PMP, last request version: %d", last[0])
+	}
+}
+
+func TestNATPMPProvider_GetContext_cancelled(t *testing.T) {
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer silent.Close()
+
+	p, _ := NewNATPMPProvider(silent.LocalAddr().String())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	if _, err := p.GetContext(ctx); err != context.Canceled {
+		t.Errorf("NATPMPProvider.GetContext returned unexpected error: %+v", err)
+	}
+}
+
+func TestNewNATPMPProvider_defaultPort(t *testing.T) {
+	p, _ := NewNATPMPProvider("192.168.1.1")
+	if p.options.Gateway != "192.168.1.1:5351" {
+		t.Errorf("NewNATPMPProvider did not set the default port: %s", p.options.Gateway)
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	stunHeaderSize  = 20
+	stunMagicCookie = 0x2112A442
+
+	stunBindingRequest       = 0x0001
+	stunBindingSuccess       = 0x0101
+	stunBindingErrorResponse = 0x0111
+
+	stunAttrMappedAddress    = 0x0001
+	stunAttrXORMappedAddress = 0x0020
+
+	stunFamilyIPv4 = 0x01
+	stunFamilyIPv6 = 0x02
+)
+
+var (
+	// ErrSTUNProviderServersAreRequired is returned when trying to create a
+	// STUNProvider without any servers.
+	ErrSTUNProviderServersAreRequired = errors.New("at least one STUN server is required")
+
+	// ErrSTUNProviderInvalidResponse is returned when the STUN server replies
+	// with a message that is not a response to the binding request.
+	ErrSTUNProviderInvalidResponse = errors.New("stun server returned an invalid response")
+
+	// ErrSTUNProviderErrorResponse is returned when the STUN server rejects
+	// the binding request.
+	ErrSTUNProviderErrorResponse = errors.New("stun server returned an error response")
+
+	// ErrSTUNProviderNoAddress is returned when the response of the STUN
+	// server does not include the mapped address.
+	ErrSTUNProviderNoAddress = errors.New("stun server response did not include the mapped address")
+
+	defaultSTUNProviderTimeout = 5 * time.Second
+
+	// stunInitialRetransmit is the time to wait before sending the request
+	// again, doubled after every attempt as per RFC 5389.
+	stunInitialRetransmit = 250 * time.Millisecond
+)
+
+// STUNProvider sends STUN Binding Requests (RFC 5389) over UDP to discover
+// the public IP address. The address returned is the one the NAT maps UDP
+// traffic to, which may differ from the one used for TCP connections behind
+// some carrier-grade NATs.
+type STUNProvider struct {
+	options *STUNProviderOptions
+}
+
+// STUNProviderOptions are used to alter the behaviour of the STUNProvider.
+type STUNProviderOptions struct {
+	// Addresses of the STUN servers, e.g. stun.example.com:3478. They are
+	// tried in order until one of them responds.
+	Servers []string
+
+	// Network to send the requests over, one of udp, udp4 or udp6. Defaults
+	// to udp4.
+	Network string
+
+	// Timeout to wait for each server to respond, during which the request
+	// is retransmitted with an exponential backoff. Defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// NewSTUNProvider returns a STUNProvider that discovers the public IPv4
+// address using the given STUN servers.
+func NewSTUNProvider(servers []string) (*STUNProvider, error) {
+	return NewSTUNProviderWithOptions(&STUNProviderOptions{Servers: servers})
+}
+
+// NewSTUNProvider6 returns a STUNProvider that discovers the public IPv6
+// address using the given STUN servers.
+func NewSTUNProvider6(servers []string) (*STUNProvider, error) {
+	return NewSTUNProviderWithOptions(&STUNProviderOptions{Servers: servers, Network: "udp6"})
+}
+
+// NewSTUNProviderWithOptions allows you to specify the STUNProviderOptions.
+func NewSTUNProviderWithOptions(options *STUNProviderOptions) (*STUNProvider, error) {
+	if len(options.Servers) == 0 {
+		return nil, ErrSTUNProviderServersAreRequired
+	}
+
+	if options.Network == "" {
+		options.Network = "udp4"
+	}
+
+	if options.Timeout == 0 {
+		options.Timeout = defaultSTUNProviderTimeout
+	}
+
+	return &STUNProvider{options: options}, nil
+}
+
+// Get sends a binding request to the STUN servers and returns the mapped
+// address of the first successful response.
+func (p *STUNProvider) Get() (net.IP, error) {
+	return p.GetContext(context.Background())
+}
+
+// GetContext is like Get but aborts the requests when the context is
+// cancelled.
+func (p *STUNProvider) GetContext(ctx context.Context) (net.IP, error) {
+	var err error
+	for _, server := range p.options.Servers {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		var ip net.IP
+		ip, err = p.bind(ctx, server)
+		if err == nil {
+			return ip, nil
+		}
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	return nil, err
+}
+
+func (p *STUNProvider) bind(ctx context.Context, server string) (net.IP, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.options.Timeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, p.options.Network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// unblock the read when the context is cancelled
+	go func() {
+		<-ctx.Done()
+		conn.SetDeadline(time.Now())
+	}()
+
+	req, txID, err := newSTUNBindingRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	return stunExchange(ctx, conn, req, txID)
+}
+
+// stunExchange sends the request and waits for the response, retransmitting
+// the request with the same transaction ID until a response arrives or the
+// context is done.
+func stunExchange(ctx context.Context, conn net.Conn, req []byte, txID []byte) (net.IP, error) {
+	buf := make([]byte, 1500)
+	for wait := stunInitialRetransmit; ; wait *= 2 {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+
+		conn.SetReadDeadline(time.Now().Add(wait))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return nil, ctxErr
+				}
+				if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
+					break
+				}
+				return nil, err
+			}
+
+			ip, err := parseSTUNBindingResponse(buf[:n], txID)
+			if err == ErrSTUNProviderInvalidResponse {
+				// ignore stray packets, e.g. responses to earlier requests
+				continue
+			}
+
+			return ip, err
+		}
+	}
+}
+
+func newSTUNBindingRequest() ([]byte, []byte, error) {
+	msg := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(msg[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint16(msg[2:4], 0)
+	binary.BigEndian.PutUint32(msg[4:8], stunMagicCookie)
+	if _, err := rand.Read(msg[8:20]); err != nil {
+		return nil, nil, err
+	}
+
+	return msg, msg[8:20], nil
+}
+
+// parseSTUNBindingResponse returns the address in the XOR-MAPPED-ADDRESS
+// attribute of the response, falling back to the MAPPED-ADDRESS attribute
+// sent by older (RFC 3489) servers.
+func parseSTUNBindingResponse(msg []byte, txID []byte) (net.IP, error) {
+	if len(msg) < stunHeaderSize ||
+		binary.BigEndian.Uint32(msg[4:8]) != stunMagicCookie ||
+		!bytes.Equal(msg[8:20], txID) {
+		return nil, ErrSTUNProviderInvalidResponse
+	}
+
+	switch binary.BigEndian.Uint16(msg[0:2]) {
+	case stunBindingSuccess:
+	case stunBindingErrorResponse:
+		return nil, ErrSTUNProviderErrorResponse
+	default:
+		return nil, ErrSTUNProviderInvalidResponse
+	}
+
+	length := int(binary.BigEndian.Uint16(msg[2:4]))
+	if len(msg) < stunHeaderSize+length {
+		return nil, ErrSTUNProviderInvalidResponse
+	}
+
+	var mapped net.IP
+	attrs := msg[stunHeaderSize : stunHeaderSize+length]
+	for len(attrs) >= 4 {
+		attrType := binary.BigEndian.Uint16(attrs[0:2])
+		attrLen := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if len(attrs) < 4+attrLen {
+			return nil, ErrSTUNProviderInvalidResponse
+		}
+		value := attrs[4 : 4+attrLen]
+
+		switch attrType {
+		case stunAttrXORMappedAddress:
+			if ip := parseSTUNAddress(value, msg[4:20]); ip != nil {
+				return ip, nil
+			}
+		case stunAttrMappedAddress:
+			mapped = parseSTUNAddress(value, nil)
+		}
+
+		// attributes are padded to a multiple of 4 bytes
+		next := 4 + (attrLen+3)&^3
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+
+	if mapped != nil {
+		return mapped, nil
+	}
+
+	return nil, ErrSTUNProviderNoAddress
+}
+
+// parseSTUNAddress parses a (XOR-)MAPPED-ADDRESS attribute value. If key is
+// set, the address is XORed with it, the key being the magic cookie followed
+// by the transaction ID.
+func parseSTUNAddress(value []byte, key []byte) net.IP {
+	if len(value) < 4 {
+		return nil
+	}
+
+	var size int
+	switch value[1] {
+	case stunFamilyIPv4:
+		size = net.IPv4len
+	case stunFamilyIPv6:
+		size = net.IPv6len
+	default:
+		return nil
+	}
+
+	if len(value) < 4+size {
+		return nil
+	}
+
+	ip := make(net.IP, size)
+	copy(ip, value[4:4+size])
+	if key != nil {
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+
+	return ip
+}
@@ -0,0 +1,240 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// stunTestResponse builds a binding response for the request, answering with
+// the given attribute.
+func stunTestResponse(req []byte, msgType uint16, attrType uint16, ip net.IP, port int) []byte {
+	family := byte(stunFamilyIPv4)
+	if ip.To4() != nil {
+		ip = ip.To4()
+	} else {
+		family = stunFamilyIPv6
+	}
+
+	value := make([]byte, 4+len(ip))
+	value[1] = family
+	binary.BigEndian.PutUint16(value[2:4], uint16(port))
+	copy(value[4:], ip)
+	if attrType == stunAttrXORMappedAddress {
+		binary.BigEndian.PutUint16(value[2:4], uint16(port)^uint16(stunMagicCookie>>16))
+		for i := range ip {
+			value[4+i] ^= req[4+i]
+		}
+	}
+
+	// an unrelated attribute, SOFTWARE, with padding
+	msg := make([]byte, stunHeaderSize)
+	msg = append(msg, 0x80, 0x22, 0x00, 0x05, 'o', 'd', 'y', 'n', '!', 0, 0, 0)
+	msg = append(msg, byte(attrType>>8), byte(attrType), 0, byte(len(value)))
+	msg = append(msg, value...)
+
+	binary.BigEndian.PutUint16(msg[0:2], msgType)
+	binary.BigEndian.PutUint16(msg[2:4], uint16(len(msg)-stunHeaderSize))
+	copy(msg[4:20], req[4:20])
+
+	return msg
+}
+
+// startMockSTUNServer runs a STUN responder that replies to binding requests
+// with the client's address in the given attribute.
+func startMockSTUNServer(msgType uint16, attrType uint16) (net.PacketConn, error) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			if n < stunHeaderSize || binary.BigEndian.Uint16(buf[0:2]) != stunBindingRequest {
+				continue
+			}
+
+			udpAddr := addr.(*net.UDPAddr)
+			pc.WriteTo(stunTestResponse(buf[:n], msgType, attrType, udpAddr.IP, udpAddr.Port), addr)
+		}
+	}()
+
+	return pc, nil
+}
+
+func TestNewSTUNProvider_serversAreRequired(t *testing.T) {
+	if _, err := NewSTUNProvider(nil); err != ErrSTUNProviderServersAreRequired {
+		t.Errorf("NewSTUNProvider returned unexpected error: %+v", err)
+	}
+}
+
+func TestSTUNProvider_Get(t *testing.T) {
+	for _, attr := range []uint16{stunAttrXORMappedAddress, stunAttrMappedAddress} {
+		pc, err := startMockSTUNServer(stunBindingSuccess, attr)
+		if err != nil {
+			t.Fatalf("unable to run test server: %v", err)
+		}
+		defer pc.Close()
+
+		p, _ := NewSTUNProvider([]string{pc.LocalAddr().String()})
+		ip, err := p.Get()
+		if err != nil {
+			t.Errorf("STUNProvider.Get returned unexpected error for attribute %#04x: %+v", attr, err)
+			continue
+		}
+
+		if !ip.Equal(net.ParseIP("127.0.0.1")) {
+			t.Errorf("STUNProvider.Get returned unexpected IP address for attribute %#04x: %s", attr, ip)
+		}
+	}
+}
+
+func TestSTUNProvider_Get_retransmit(t *testing.T) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer pc.Close()
+
+	// drop the first request and answer the retransmission, which must reuse
+	// the transaction ID
+	txIDs := make(chan string, 2)
+	go func() {
+		buf := make([]byte, 1500)
+		for i := 0; ; i++ {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			txIDs <- string(buf[8:20])
+			if i == 0 {
+				continue
+			}
+
+			udpAddr := addr.(*net.UDPAddr)
+			pc.WriteTo(stunTestResponse(buf[:n], stunBindingSuccess, stunAttrXORMappedAddress, udpAddr.IP, udpAddr.Port), addr)
+			return
+		}
+	}()
+
+	p, _ := NewSTUNProviderWithOptions(&STUNProviderOptions{
+		Servers: []string{pc.LocalAddr().String()},
+		Timeout: 2 * time.Second,
+	})
+
+	start := time.Now()
+	ip, err := p.Get()
+	if err != nil {
+		t.Fatalf("STUNProvider.Get returned unexpected error: %+v", err)
+	}
+
+	if !ip.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("STUNProvider.Get returned unexpected IP address: %s", ip)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("STUNProvider.Get did not retransmit the request, took %s", elapsed)
+	}
+
+	if first, second := <-txIDs, <-txIDs; first != second {
+		t.Errorf("STUNProvider.Get retransmitted the request with a different transaction ID")
+	}
+}
+
+func TestSTUNProvider_Get_errorResponse(t *testing.T) {
+	pc, err := startMockSTUNServer(stunBindingErrorResponse, stunAttrXORMappedAddress)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer pc.Close()
+
+	p, _ := NewSTUNProvider([]string{pc.LocalAddr().String()})
+	if _, err := p.Get(); err != ErrSTUNProviderErrorResponse {
+		t.Errorf("STUNProvider.Get returned unexpected error: %+v", err)
+	}
+}
+
+func TestSTUNProvider_Get_failover(t *testing.T) {
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer silent.Close()
+
+	pc, err := startMockSTUNServer(stunBindingSuccess, stunAttrXORMappedAddress)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer pc.Close()
+
+	p, _ := NewSTUNProviderWithOptions(&STUNProviderOptions{
+		Servers: []string{silent.LocalAddr().String(), pc.LocalAddr().String()},
+		Timeout: 50 * time.Millisecond,
+	})
+
+	if ip, err := p.Get(); err != nil || !ip.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("STUNProvider.Get returned unexpected result: %s, %+v", ip, err)
+	}
+}
+
+func TestSTUNProvider_GetContext_cancelled(t *testing.T) {
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer silent.Close()
+
+	p, _ := NewSTUNProvider([]string{silent.LocalAddr().String()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	if _, err := p.GetContext(ctx); err != context.Canceled {
+		t.Errorf("STUNProvider.GetContext returned unexpected error: %+v", err)
+	}
+}
+
+func TestParseSTUNBindingResponse(t *testing.T) {
+	req, txID, _ := newSTUNBindingRequest()
+
+	ip6 := net.ParseIP("2001:db8::1")
+	resp := stunTestResponse(req, stunBindingSuccess, stunAttrXORMappedAddress, ip6, 4242)
+	if ip, err := parseSTUNBindingResponse(resp, txID); err != nil || !ip.Equal(ip6) {
+		t.Errorf("parseSTUNBindingResponse returned unexpected result: %s, %+v", ip, err)
+	}
+
+	// responses to other transactions are ignored
+	other, _, _ := newSTUNBindingRequest()
+	resp = stunTestResponse(other, stunBindingSuccess, stunAttrXORMappedAddress, ip6, 4242)
+	if _, err := parseSTUNBindingResponse(resp, txID); err != ErrSTUNProviderInvalidResponse {
+		t.Errorf("parseSTUNBindingResponse returned unexpected error: %+v", err)
+	}
+
+	// responses without a mapped address
+	resp = stunTestResponse(req, stunBindingSuccess, 0x8022, ip6, 4242)
+	if _, err := parseSTUNBindingResponse(resp, txID); err != ErrSTUNProviderNoAddress {
+		t.Errorf("parseSTUNBindingResponse returned unexpected error: %+v", err)
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUPnPProviderNoGateway is returned when no Internet Gateway Device
+	// responds to the SSDP search.
+	ErrUPnPProviderNoGateway = errors.New("no upnp internet gateway device found")
+
+	// ErrUPnPProviderNoService is returned when the gateway's description
+	// does not include a WAN connection service.
+	ErrUPnPProviderNoService = errors.New("upnp gateway has no wan connection service")
+
+	// ErrUPnPProviderInvalidResponse is returned when the gateway does not
+	// reply with a valid external IP address.
+	ErrUPnPProviderInvalidResponse = errors.New("upnp gateway returned an invalid response")
+
+	defaultUPnPProviderSSDPAddress = "239.255.255.250:1900"
+	defaultUPnPProviderTimeout     = 3 * time.Second
+	defaultUPnPProviderClient      = &http.Client{}
+
+	upnpSearchTarget = "urn:schemas-upnp-org:device:InternetGatewayDevice:1"
+	upnpServiceTypes = []string{
+		"urn:schemas-upnp-org:service:WANIPConnection:",
+		"urn:schemas-upnp-org:service:WANPPPConnection:",
+	}
+)
+
+// UPnPProvider asks the router for its external IP address using UPnP
+// Internet Gateway Device protocol. The router is discovered using SSDP.
+type UPnPProvider struct {
+	options *UPnPProviderOptions
+}
+
+// UPnPProviderOptions are used to alter the behaviour of the UPnPProvider.
+type UPnPProviderOptions struct {
+	// Address to send the SSDP search to. Defaults to the SSDP multicast
+	// address, 239.255.255.250:1900.
+	SSDPAddress string
+
+	// URL of the gateway's device description. If set, SSDP discovery is
+	// skipped.
+	Location string
+
+	// Timeout to wait for a gateway to respond to the SSDP search. Defaults
+	// to 3 seconds.
+	Timeout time.Duration
+
+	// HTTP Client used to talk to the gateway.
+	Client *http.Client
+}
+
+// NewUPnPProvider returns a UPnPProvider that discovers the gateway on the
+// local network.
+func NewUPnPProvider() (*UPnPProvider, error) {
+	return NewUPnPProviderWithOptions(&UPnPProviderOptions{})
+}
+
+// NewUPnPProviderWithOptions allows you to specify the UPnPProviderOptions.
+func NewUPnPProviderWithOptions(options *UPnPProviderOptions) (*UPnPProvider, error) {
+	if options.SSDPAddress == "" {
+		options.SSDPAddress = defaultUPnPProviderSSDPAddress
+	}
+
+	if options.Timeout == 0 {
+		options.Timeout = defaultUPnPProviderTimeout
+	}
+
+	if options.Client == nil {
+		options.Client = defaultUPnPProviderClient
+	}
+
+	return &UPnPProvider{options: options}, nil
+}
+
+// Get asks the gateway for its external IP address.
+func (p *UPnPProvider) Get() (net.IP, error) {
+	return p.GetContext(context.Background())
+}
+
+// GetContext is like Get but aborts the discovery and requests when the
+// context is cancelled.
+func (p *UPnPProvider) GetContext(ctx context.Context) (net.IP, error) {
+	location := p.options.Location
+	if location == "" {
+		var err error
+		if location, err = p.discover(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	serviceType, controlURL, err := p.service(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.externalIP(ctx, serviceType, controlURL)
+}
+
+// discover sends an SSDP search for Internet Gateway Devices and returns the
+// location of the description of the first one that responds.
+func (p *UPnPProvider) discover(ctx context.Context) (string, error) {
+	addr, err := net.ResolveUDPAddr("udp4", p.options.SSDPAddress)
+	if err != nil {
+		return "", err
+	}
+
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, p.options.Timeout)
+	defer cancel()
+
+	// unblock the read when the context is cancelled
+	go func() {
+		<-ctx.Done()
+		conn.SetDeadline(time.Now())
+	}()
+
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + defaultUPnPProviderSSDPAddress + "\r\n" +
+		"ST: " + upnpSearchTarget + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(search), addr); err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return "", ErrUPnPProviderNoGateway
+			}
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", err
+		}
+
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+
+		if location := resp.Header.Get("Location"); location != "" {
+			return location, nil
+		}
+	}
+}
+
+type upnpDescription struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+type upnpDevice struct {
+	Services []upnpService `xml:"serviceList>service"`
+	Devices  []upnpDevice  `xml:"deviceList>device"`
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+func (d *upnpDevice) findService() *upnpService {
+	for i, s := range d.Services {
+		for _, t := range upnpServiceTypes {
+			if strings.HasPrefix(s.ServiceType, t) {
+				return &d.Services[i]
+			}
+		}
+	}
+
+	for i := range d.Devices {
+		if s := d.Devices[i].findService(); s != nil {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// service fetches the device description and returns the type and control
+// URL of its WAN connection service.
+func (p *UPnPProvider) service(ctx context.Context, location string) (string, string, error) {
+	req, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	resp, err := p.options.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", ErrUPnPProviderInvalidResponse
+	}
+
+	desc := &upnpDescription{}
+	if err := xml.NewDecoder(resp.Body).Decode(desc); err != nil {
+		return "", "", err
+	}
+
+	service := desc.Device.findService()
+	if service == nil {
+		return "", "", ErrUPnPProviderNoService
+	}
+
+	base := location
+	if desc.URLBase != "" {
+		base = desc.URLBase
+	}
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", "", err
+	}
+
+	controlURL, err := baseURL.Parse(service.ControlURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	return service.ServiceType, controlURL.String(), nil
+}
+
+type upnpEnvelope struct {
+	Body struct {
+		Response struct {
+			IP string `xml:"NewExternalIPAddress"`
+		} `xml:"GetExternalIPAddressResponse"`
+	} `xml:"Body"`
+}
+
+// externalIP invokes the GetExternalIPAddress action of the service.
+func (p *UPnPProvider) externalIP(ctx context.Context, serviceType, controlURL string) (net.IP, error) {
+	body := `<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:GetExternalIPAddress xmlns:u="` + serviceType + `"/></s:Body>` +
+		`</s:Envelope>`
+
+	req, err := http.NewRequest(http.MethodPost, controlURL, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+serviceType+`#GetExternalIPAddress"`)
+
+	resp, err := p.options.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrUPnPProviderInvalidResponse
+	}
+
+	envelope := &upnpEnvelope{}
+	if err := xml.NewDecoder(resp.Body).Decode(envelope); err != nil {
+		return nil, err
+	}
+
+	// gateways that are not connected reply with an empty address
+	ip := net.ParseIP(strings.TrimSpace(envelope.Body.Response.IP))
+	if ip == nil || ip.IsUnspecified() {
+		return nil, ErrUPnPProviderInvalidResponse
+	}
+
+	return ip, nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testUPnPDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <serviceList>
+      <service>
+        <serviceType>urn:schemas-upnp-org:service:Layer3Forwarding:1</serviceType>
+        <controlURL>/l3f</controlURL>
+      </service>
+    </serviceList>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/ctl/IPConn</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`
+
+const testUPnPResponse = `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+  <s:Body>
+    <u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+      <NewExternalIPAddress>%s</NewExternalIPAddress>
+    </u:GetExternalIPAddressResponse>
+  </s:Body>
+</s:Envelope>`
+
+// startMockUPnPGateway serves the device description and the control URL of
+// a gateway with the given external address.
+func startMockUPnPGateway(externalIP string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rootDesc.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testUPnPDescription)
+	})
+	mux.HandleFunc("/ctl/IPConn", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != "POST" ||
+			r.Header.Get("SOAPAction") != `"urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"` ||
+			!strings.Contains(string(body), "GetExternalIPAddress") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, testUPnPResponse, externalIP)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+// startMockSSDPResponder answers M-SEARCH requests for gateways with the
+// given location.
+func startMockSSDPResponder(location string) (net.PacketConn, error) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			req := string(buf[:n])
+			if !strings.HasPrefix(req, "M-SEARCH") || !strings.Contains(req, upnpSearchTarget) {
+				continue
+			}
+
+			// a response from an unrelated device first
+			pc.WriteTo([]byte("garbage"), addr)
+			pc.WriteTo([]byte("HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=120\r\nST: "+upnpSearchTarget+"\r\nLOCATION: "+location+"\r\n\r\n"), addr)
+		}
+	}()
+
+	return pc, nil
+}
+
+func TestUPnPProvider_Get(t *testing.T) {
+	ts := startMockUPnPGateway("203.0.113.9")
+	defer ts.Close()
+
+	pc, err := startMockSSDPResponder(ts.URL + "/rootDesc.xml")
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer pc.Close()
+
+	p, _ := NewUPnPProviderWithOptions(&UPnPProviderOptions{SSDPAddress: pc.LocalAddr().String()})
+	ip, err := p.Get()
+	if err != nil {
+		t.Fatalf("UPnPProvider.Get returned unexpected error: %+v", err)
+	}
+
+	if !ip.Equal(net.ParseIP("203.0.113.9")) {
+		t.Errorf("UPnPProvider.Get returned unexpected IP address: %s", ip)
+	}
+}
+
+func TestUPnPProvider_Get_notConnected(t *testing.T) {
+	ts := startMockUPnPGateway("")
+	defer ts.Close()
+
+	p, _ := NewUPnPProviderWithOptions(&UPnPProviderOptions{Location: ts.URL + "/rootDesc.xml"})
+	if _, err := p.Get(); err != ErrUPnPProviderInvalidResponse {
+		t.Errorf("UPnPProvider.Get returned unexpected error: %+v", err)
+	}
+}
+
+func TestUPnPProvider_Get_noService(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<root><device><serviceList></serviceList></device></root>`)
+	}))
+	defer ts.Close()
+
+	p, _ := NewUPnPProviderWithOptions(&UPnPProviderOptions{Location: ts.URL})
+	if _, err := p.Get(); err != ErrUPnPProviderNoService {
+		t.Errorf("UPnPProvider.Get returned unexpected error: %+v", err)
+	}
+}
+
+func TestUPnPProvider_Get_noGateway(t *testing.T) {
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer silent.Close()
+
+	p, _ := NewUPnPProviderWithOptions(&UPnPProviderOptions{
+		SSDPAddress: silent.LocalAddr().String(),
+		Timeout:     50 * time.Millisecond,
+	})
+
+	if _, err := p.Get(); err != ErrUPnPProviderNoGateway {
+		t.Errorf("UPnPProvider.Get returned unexpected error: %+v", err)
+	}
+}
+
+func TestUPnPProvider_GetContext_cancelled(t *testing.T) {
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer silent.Close()
+
+	p, _ := NewUPnPProviderWithOptions(&UPnPProviderOptions{SSDPAddress: silent.LocalAddr().String()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	if _, err := p.GetContext(ctx); err != context.Canceled {
+		t.Errorf("UPnPProvider.GetContext returned unexpected error: %+v", err)
+	}
+}
@@ -15,6 +15,7 @@
 package odyn
 
 import (
+	"context"
 	"errors"
 	"net"
 	"sync"
@@ -26,6 +27,16 @@ const (
 
 	// ProviderSetParallel sets the ProviderSet mode to parallel.
 	ProviderSetParallel = ProviderSetKind(2)
+
+	// ProviderSetQuorum sets the ProviderSet mode to quorum.
+	ProviderSetQuorum = ProviderSetKind(3)
+
+	// ProviderSetRace sets the ProviderSet mode to race.
+	ProviderSetRace = ProviderSetKind(4)
+
+	// ProviderSetQuorumMajority can be used as the quorum of a ProviderSet
+	// to require a strict majority of the providers to agree.
+	ProviderSetQuorumMajority = 0
 )
 
 var (
@@ -40,6 +51,14 @@ var (
 	// ErrProviderSetMultipleResults is returned when providers in a parallel
 	// mode ProviderSet return different (conflicting) results.
 	ErrProviderSetMultipleResults = errors.New("the providers returned multiple different results")
+
+	// ErrProviderSetInvalidQuorum is returned when trying to create a quorum
+	// mode ProviderSet that requires more agreeing providers than it has.
+	ErrProviderSetInvalidQuorum = errors.New("quorum is larger than the number of providers")
+
+	// ErrProviderSetNoQuorum is returned when not enough providers in a
+	// quorum mode ProviderSet agree on the same result.
+	ErrProviderSetNoQuorum = errors.New("not enough providers agreed on the same result")
 )
 
 // ProviderSetKind represents the operational mode of a ProviderSet.
@@ -49,6 +68,7 @@ type ProviderSetKind int64
 // handling results from multiple sources.
 type ProviderSet struct {
 	kind      ProviderSetKind
+	quorum    int
 	providers []IPProvider
 }
 
@@ -61,8 +81,15 @@ type ProviderSet struct {
 //
 // ProviderSetParallel will query all the providers at once and ensure that
 // they return the same result or return an error.
+//
+// ProviderSetQuorum will query all the providers at once and return the
+// result that a strict majority of them agree on. Use NewProviderSetQuorum
+// to require a specific number of agreeing providers instead.
+//
+// ProviderSetRace will query all the providers at once and return the first
+// successful result, cancelling the requests to the rest of the Providers.
 func NewProviderSet(kind ProviderSetKind, providers ...IPProvider) (*ProviderSet, error) {
-	if kind != ProviderSetSerial && kind != ProviderSetParallel {
+	if kind < ProviderSetSerial || kind > ProviderSetRace {
 		return nil, ErrProviderSetInvalidKind
 	}
 
@@ -72,24 +99,55 @@ func NewProviderSet(kind ProviderSetKind, providers ...IPProvider) (*ProviderSet
 	}, nil
 }
 
+// NewProviderSetQuorum creates a new quorum mode ProviderSet which returns
+// the IP address that at least quorum of the providers agree on. A quorum of
+// ProviderSetQuorumMajority requires a strict majority of the providers. If
+// more than one address is returned by at least quorum of the providers, the
+// result is ambiguous and ErrProviderSetNoQuorum is returned.
+func NewProviderSetQuorum(quorum int, providers ...IPProvider) (*ProviderSet, error) {
+	if quorum < 0 || quorum > len(providers) {
+		return nil, ErrProviderSetInvalidQuorum
+	}
+
+	return &ProviderSet{
+		kind:      ProviderSetQuorum,
+		quorum:    quorum,
+		providers: providers,
+	}, nil
+}
+
 // Get will use the providers to get the IP address.
 func (p *ProviderSet) Get() (net.IP, error) {
+	return p.GetContext(context.Background())
+}
+
+// GetContext is like Get but passes the context down to the providers so
+// that cancelling it aborts any requests that are in progress.
+func (p *ProviderSet) GetContext(ctx context.Context) (net.IP, error) {
 	switch p.kind {
 	case ProviderSetSerial:
-		return p.getSerial()
+		return p.getSerial(ctx)
 	case ProviderSetParallel:
-		return p.getParallel()
+		return p.getParallel(ctx)
+	case ProviderSetQuorum:
+		return p.getQuorum(ctx)
+	case ProviderSetRace:
+		return p.getRace(ctx)
 	default:
 		return nil, ErrProviderSetInvalidKind
 	}
 }
 
-func (p *ProviderSet) getSerial() (net.IP, error) {
+func (p *ProviderSet) getSerial(ctx context.Context) (net.IP, error) {
 	for _, provider := range p.providers {
-		ip, err := provider.Get()
+		ip, err := GetContext(ctx, provider)
 		if err == nil {
 			return ip, err
 		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 	}
 
 	return nil, ErrProviderSetAllProvidersFailed
@@ -100,26 +158,35 @@ type providerSetParallelResult struct {
 	Error error
 }
 
-func providerSetParallelRun(wg *sync.WaitGroup, provider IPProvider, results chan providerSetParallelResult) {
+func providerSetParallelRun(ctx context.Context, wg *sync.WaitGroup, provider IPProvider, results chan providerSetParallelResult) {
 	defer wg.Done()
-	ip, err := provider.Get()
+	ip, err := GetContext(ctx, provider)
 	results <- providerSetParallelResult{
 		IP:    ip,
 		Error: err,
 	}
 }
 
-func (p *ProviderSet) getParallel() (net.IP, error) {
+func (p *ProviderSet) runParallel(ctx context.Context) chan providerSetParallelResult {
 	results := make(chan providerSetParallelResult, len(p.providers))
 
 	wg := &sync.WaitGroup{}
 	wg.Add(len(p.providers))
 	for _, provider := range p.providers {
-		go providerSetParallelRun(wg, provider, results)
+		go providerSetParallelRun(ctx, wg, provider, results)
 	}
 	wg.Wait()
 	close(results)
 
+	return results
+}
+
+func (p *ProviderSet) getParallel(ctx context.Context) (net.IP, error) {
+	results := p.runParallel(ctx)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
 	ips := map[string]net.IP{}
 	for r := range results {
 		if r.Error == nil {
@@ -139,3 +206,75 @@ func (p *ProviderSet) getParallel() (net.IP, error) {
 
 	return ip, nil
 }
+
+func (p *ProviderSet) getQuorum(ctx context.Context) (net.IP, error) {
+	quorum := p.quorum
+	if quorum == ProviderSetQuorumMajority {
+		quorum = len(p.providers)/2 + 1
+	}
+
+	results := p.runParallel(ctx)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	votes := map[string]int{}
+	ips := map[string]net.IP{}
+	for r := range results {
+		if r.Error != nil || r.IP == nil {
+			continue
+		}
+
+		votes[r.IP.String()]++
+		ips[r.IP.String()] = r.IP
+	}
+
+	// with a quorum of half the providers or less, more than one address can
+	// reach it, in which case there is no single answer to return
+	var ip net.IP
+	for k, v := range votes {
+		if v < quorum {
+			continue
+		}
+
+		if ip != nil {
+			return nil, ErrProviderSetNoQuorum
+		}
+		ip = ips[k]
+	}
+
+	if ip == nil {
+		return nil, ErrProviderSetNoQuorum
+	}
+
+	return ip, nil
+}
+
+func (p *ProviderSet) getRace(ctx context.Context) (net.IP, error) {
+	raceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan providerSetParallelResult, len(p.providers))
+	for _, provider := range p.providers {
+		go func(provider IPProvider) {
+			ip, err := GetContext(raceCtx, provider)
+			results <- providerSetParallelResult{
+				IP:    ip,
+				Error: err,
+			}
+		}(provider)
+	}
+
+	for range p.providers {
+		r := <-results
+		if r.Error == nil && r.IP != nil {
+			return r.IP, nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return nil, ErrProviderSetAllProvidersFailed
+}
@@ -15,9 +15,11 @@
 package odyn
 
 import (
+	"context"
 	"errors"
 	"net"
 	"testing"
+	"time"
 )
 
 var (
@@ -35,14 +37,30 @@ func (p *testProvider) Get() (net.IP, error) {
 	return p.IP, p.Error
 }
 
+func (p *testProvider) GetContext(ctx context.Context) (net.IP, error) {
+	return p.IP, p.Error
+}
+
+// testBlockingProvider blocks until its context is cancelled.
+type testBlockingProvider struct{}
+
+func (p *testBlockingProvider) Get() (net.IP, error) {
+	return p.GetContext(context.Background())
+}
+
+func (p *testBlockingProvider) GetContext(ctx context.Context) (net.IP, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
 func TestNewProviderSet_invalidKind(t *testing.T) {
-	_, err := NewProviderSet(ProviderSetKind(3))
+	_, err := NewProviderSet(ProviderSetKind(0))
 	if err != ErrProviderSetInvalidKind {
 		t.Errorf("NewProviderSet returned unexpected error: %+v", err)
 	}
 
 	p, _ := NewProviderSet(ProviderSetKind(1))
-	p.kind = ProviderSetKind(3)
+	p.kind = ProviderSetKind(0)
 	_, err = p.Get()
 	if err != ErrProviderSetInvalidKind {
 		t.Errorf("NewProviderSet returned unexpected error: %+v", err)
@@ -88,3 +106,165 @@ func TestProviderSet_Parallel_Get_different(t *testing.T) {
 		t.Errorf("ProviderSet.Get returned unexpected error: %+v", err)
 	}
 }
+
+func TestProviderSet_Serial_GetContext_cancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	ps, _ := NewProviderSet(ProviderSetSerial, &testBlockingProvider{}, testProviderOK)
+	_, err := ps.GetContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("ProviderSet.GetContext returned unexpected error: %+v", err)
+	}
+}
+
+func TestProviderSet_Parallel_GetContext_cancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	ps, _ := NewProviderSet(ProviderSetParallel, &testBlockingProvider{}, testProviderOK)
+	_, err := ps.GetContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("ProviderSet.GetContext returned unexpected error: %+v", err)
+	}
+}
+
+func TestNewProviderSetQuorum_invalidQuorum(t *testing.T) {
+	_, err := NewProviderSetQuorum(3, testProviderOK, testProviderOK)
+	if err != ErrProviderSetInvalidQuorum {
+		t.Errorf("NewProviderSetQuorum returned unexpected error: %+v", err)
+	}
+
+	_, err = NewProviderSetQuorum(-1, testProviderOK)
+	if err != ErrProviderSetInvalidQuorum {
+		t.Errorf("NewProviderSetQuorum returned unexpected error: %+v", err)
+	}
+}
+
+func TestProviderSet_Quorum_Get(t *testing.T) {
+	testProviderOther := &testProvider{IP: net.ParseIP("6.6.6.6"), Error: nil}
+
+	testCases := []struct {
+		quorum      int
+		providers   []IPProvider
+		expectedIP  net.IP
+		expectedErr error
+	}{
+		{ // majority agrees despite one dissenting and one broken provider
+			ProviderSetQuorumMajority,
+			[]IPProvider{testProviderOK, testProviderOK, testProviderOK, testProviderOther, testProviderBroken},
+			testProviderOK.IP,
+			nil,
+		},
+		{ // no majority
+			ProviderSetQuorumMajority,
+			[]IPProvider{testProviderOK, testProviderOK, testProviderOther, testProviderBroken},
+			nil,
+			ErrProviderSetNoQuorum,
+		},
+		{ // explicit quorum reached
+			2,
+			[]IPProvider{testProviderOK, testProviderOK, testProviderOther, testProviderBroken},
+			testProviderOK.IP,
+			nil,
+		},
+		{ // explicit quorum not reached
+			3,
+			[]IPProvider{testProviderOK, testProviderOK, testProviderOther, testProviderBroken},
+			nil,
+			ErrProviderSetNoQuorum,
+		},
+		{ // two conflicting addresses both reach the quorum
+			2,
+			[]IPProvider{testProviderOK, testProviderOK, testProviderOther, testProviderOther},
+			nil,
+			ErrProviderSetNoQuorum,
+		},
+		{ // any single provider is enough but they disagree
+			1,
+			[]IPProvider{testProviderOK, testProviderOther},
+			nil,
+			ErrProviderSetNoQuorum,
+		},
+		{ // all providers failed
+			ProviderSetQuorumMajority,
+			[]IPProvider{testProviderBroken, testProviderBroken},
+			nil,
+			ErrProviderSetNoQuorum,
+		},
+	}
+
+	for i, tc := range testCases {
+		ps, _ := NewProviderSetQuorum(tc.quorum, tc.providers...)
+		ip, err := ps.Get()
+		if err != tc.expectedErr {
+			t.Errorf("ProviderSet.Get returned unexpected error for case %02d: %+v", i, err)
+		}
+
+		if !ip.Equal(tc.expectedIP) {
+			t.Errorf("ProviderSet.Get returned unexpected ip for case %02d: %+v", i, ip)
+		}
+	}
+}
+
+func TestNewProviderSet_Quorum_majority(t *testing.T) {
+	ps, err := NewProviderSet(ProviderSetQuorum, testProviderOK, testProviderOK, testProviderBroken)
+	if err != nil {
+		t.Fatalf("NewProviderSet returned unexpected error: %+v", err)
+	}
+
+	ip, err := ps.Get()
+	if err != nil {
+		t.Errorf("ProviderSet.Get returned unexpected error: %+v", err)
+	}
+
+	if !ip.Equal(testProviderOK.IP) {
+		t.Errorf("ProviderSet.Get returned unexpected ip: %+v", ip)
+	}
+}
+
+func TestProviderSet_Race_Get(t *testing.T) {
+	blocking := &testBlockingProvider{}
+	ps, _ := NewProviderSet(ProviderSetRace, blocking, testProviderBroken, testProviderOK)
+
+	done := make(chan struct{})
+	var ip net.IP
+	var err error
+	go func() {
+		ip, err = ps.Get()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("ProviderSet.Get waited for the blocking provider")
+	}
+
+	if err != nil {
+		t.Errorf("ProviderSet.Get returned unexpected error: %+v", err)
+	}
+
+	if !ip.Equal(testProviderOK.IP) {
+		t.Errorf("ProviderSet.Get returned unexpected ip: %+v", ip)
+	}
+}
+
+func TestProviderSet_Race_Get_allFail(t *testing.T) {
+	ps, _ := NewProviderSet(ProviderSetRace, testProviderBroken, testProviderBroken)
+	_, err := ps.Get()
+	if err != ErrProviderSetAllProvidersFailed {
+		t.Errorf("ProviderSet.Get returned unexpected error: %+v", err)
+	}
+}
+
+func TestProviderSet_Race_GetContext_cancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	ps, _ := NewProviderSet(ProviderSetRace, &testBlockingProvider{}, testProviderBroken)
+	_, err := ps.GetContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("ProviderSet.GetContext returned unexpected error: %+v", err)
+	}
+}
@@ -0,0 +1,441 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const azureDNSAPIVersion = "2018-05-01"
+
+var (
+	// ErrAzureDNSCredentialsAreRequired is returned when trying to create an
+	// AzureDNSZone without the tenant, client ID and client secret of a
+	// service principal.
+	ErrAzureDNSCredentialsAreRequired = errors.New("the TenantID, ClientID and ClientSecret options are required")
+
+	// ErrAzureDNSResourceGroupIsRequired is returned when trying to create
+	// an AzureDNSZone without the subscription and resource group of the
+	// zones.
+	ErrAzureDNSResourceGroupIsRequired = errors.New("the SubscriptionID and ResourceGroup options are required")
+
+	// ErrAzureDNSNoZoneFound is returned when the Azure DNS Zone provider
+	// fails to find the DNS zone in the resource group.
+	ErrAzureDNSNoZoneFound = errors.New("could not find an Azure DNS zone")
+
+	// ErrAzureDNSRecordNotInZone is returned when trying to update a record
+	// whose name is not within the DNS zone.
+	ErrAzureDNSRecordNotInZone = errors.New("the record is not in the Azure DNS zone")
+
+	// ErrAzureDNSConcurrentUpdate is returned when the record set keeps being
+	// modified by someone else while trying to update it.
+	ErrAzureDNSConcurrentUpdate = errors.New("the Azure DNS record set was modified concurrently")
+
+	defaultAzureDNSZoneRecordTTL    int64 = 60
+	defaultAzureDNSZoneAPIURL             = "https://management.azure.com"
+	defaultAzureDNSZoneAuthorityURL       = "https://login.microsoftonline.com"
+	defaultAzureDNSZoneClient             = &http.Client{}
+
+	// azureDNSZoneUpdateAttempts is the number of times a record set update
+	// is attempted when it fails because the etag no longer matches.
+	azureDNSZoneUpdateAttempts = 3
+)
+
+// AzureDNSZone is a DNS Zone provider based on the Azure DNS REST API,
+// authenticating as a service principal using the OAuth 2.0 client
+// credentials flow.
+type AzureDNSZone struct {
+	options *AzureDNSZoneOptions
+
+	tokenMutex  sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// AzureDNSZoneOptions are used to alter the behaviour of the Azure DNS zone
+// provider. Empty credentials, subscription and resource group default to
+// the AZURE_TENANT_ID, AZURE_CLIENT_ID, AZURE_CLIENT_SECRET,
+// AZURE_SUBSCRIPTION_ID and AZURE_RESOURCE_GROUP environment variables.
+type AzureDNSZoneOptions struct {
+	// Credentials of the service principal, which needs the DNS Zone
+	// Contributor role or equivalent permissions.
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+
+	// Subscription and resource group that hold the DNS zones.
+	SubscriptionID string
+	ResourceGroup  string
+
+	// TTL of the records.
+	TTL int64
+
+	// Base URL of the Azure Resource Manager API.
+	APIURL string
+
+	// URL of the OAuth 2.0 token endpoint. Defaults to the v2.0 endpoint of
+	// the tenant.
+	TokenURL string
+
+	// HTTP Client used to send the API requests.
+	Client *http.Client
+}
+
+// AzureError is returned when the Azure APIs respond with an unsuccessful
+// status code.
+type AzureError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *AzureError) Error() string {
+	if e.Message == "" {
+		return "azure API request failed: " + http.StatusText(e.StatusCode)
+	}
+
+	return "azure API request failed: " + e.Message
+}
+
+type azureRecordSet struct {
+	Etag       string                   `json:"etag,omitempty"`
+	Properties azureRecordSetProperties `json:"properties"`
+}
+
+type azureRecordSetProperties struct {
+	TTL         int64             `json:"TTL"`
+	ARecords    []azureARecord    `json:"ARecords,omitempty"`
+	AAAARecords []azureAAAARecord `json:"AAAARecords,omitempty"`
+}
+
+type azureARecord struct {
+	IPv4Address string `json:"ipv4Address"`
+}
+
+type azureAAAARecord struct {
+	IPv6Address string `json:"ipv6Address"`
+}
+
+// NewAzureDNSZone returns a new instantiated Azure DNS zone provider with
+// default options, reading the credentials, subscription and resource group
+// from the environment.
+func NewAzureDNSZone() (*AzureDNSZone, error) {
+	return NewAzureDNSZoneWithOptions(&AzureDNSZoneOptions{})
+}
+
+// NewAzureDNSZoneWithOptions returns a new instantiated Azure DNS zone
+// provider using the specified options.
+func NewAzureDNSZoneWithOptions(options *AzureDNSZoneOptions) (*AzureDNSZone, error) {
+	for _, o := range []struct {
+		value *string
+		env   string
+	}{
+		{&options.TenantID, "AZURE_TENANT_ID"},
+		{&options.ClientID, "AZURE_CLIENT_ID"},
+		{&options.ClientSecret, "AZURE_CLIENT_SECRET"},
+		{&options.SubscriptionID, "AZURE_SUBSCRIPTION_ID"},
+		{&options.ResourceGroup, "AZURE_RESOURCE_GROUP"},
+	} {
+		if *o.value == "" {
+			*o.value = os.Getenv(o.env)
+		}
+	}
+
+	if options.TenantID == "" || options.ClientID == "" || options.ClientSecret == "" {
+		return nil, ErrAzureDNSCredentialsAreRequired
+	}
+
+	if options.SubscriptionID == "" || options.ResourceGroup == "" {
+		return nil, ErrAzureDNSResourceGroupIsRequired
+	}
+
+	if options.TTL == 0 {
+		options.TTL = defaultAzureDNSZoneRecordTTL
+	}
+
+	if options.APIURL == "" {
+		options.APIURL = defaultAzureDNSZoneAPIURL
+	}
+
+	if options.TokenURL == "" {
+		options.TokenURL = defaultAzureDNSZoneAuthorityURL + "/" + options.TenantID + "/oauth2/v2.0/token"
+	}
+
+	for _, u := range []string{options.APIURL, options.TokenURL} {
+		if _, err := url.Parse(u); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Client == nil {
+		options.Client = defaultAzureDNSZoneClient
+	}
+
+	return &AzureDNSZone{options: options}, nil
+}
+
+// UpdateA will set the A Record set in the specified zone to point to the
+// provided IP address, creating the record set if it does not exist.
+func (p *AzureDNSZone) UpdateA(recordName string, zoneName string, ip net.IP) error {
+	return p.UpdateAContext(context.Background(), recordName, zoneName, ip)
+}
+
+// UpdateAContext is like UpdateA but aborts the API requests when the context
+// is cancelled.
+func (p *AzureDNSZone) UpdateAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error {
+	return p.updateRecord(ctx, recordName, zoneName, "A", ip)
+}
+
+// UpdateAAAA will set the AAAA Record set in the specified zone to point to
+// the provided IPv6 address, creating the record set if it does not exist.
+func (p *AzureDNSZone) UpdateAAAA(recordName string, zoneName string, ip net.IP) error {
+	return p.UpdateAAAAContext(context.Background(), recordName, zoneName, ip)
+}
+
+// UpdateAAAAContext is like UpdateAAAA but aborts the API requests when the
+// context is cancelled.
+func (p *AzureDNSZone) UpdateAAAAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error {
+	return p.updateRecord(ctx, recordName, zoneName, "AAAA", ip)
+}
+
+// Nameservers returns the list of authoritative namservers for a DNS zone.
+func (p *AzureDNSZone) Nameservers(zoneName string) ([]string, error) {
+	return p.NameserversContext(context.Background(), zoneName)
+}
+
+// NameserversContext is like Nameservers but aborts the API requests when the
+// context is cancelled.
+func (p *AzureDNSZone) NameserversContext(ctx context.Context, zoneName string) ([]string, error) {
+	zone := struct {
+		Properties struct {
+			NameServers []string `json:"nameServers"`
+		} `json:"properties"`
+	}{}
+	_, err := p.request(ctx, http.MethodGet, p.zonePath(zoneName), nil, nil, &zone)
+	if azErr, ok := err.(*AzureError); ok && azErr.StatusCode == http.StatusNotFound {
+		return nil, ErrAzureDNSNoZoneFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nameservers := make([]string, len(zone.Properties.NameServers))
+	for i, ns := range zone.Properties.NameServers {
+		nameservers[i] = strings.TrimSuffix(ns, ".")
+	}
+
+	return nameservers, nil
+}
+
+func (p *AzureDNSZone) zonePath(zoneName string) string {
+	return "/subscriptions/" + p.options.SubscriptionID +
+		"/resourceGroups/" + p.options.ResourceGroup +
+		"/providers/Microsoft.Network/dnsZones/" + strings.TrimSuffix(zoneName, ".")
+}
+
+func (p *AzureDNSZone) updateRecord(ctx context.Context, recordName string, zoneName string, rrType string, ip net.IP) error {
+	// record sets are named relative to the zone, with @ being the apex
+	zone := strings.ToLower(strings.TrimSuffix(zoneName, "."))
+	name := strings.ToLower(strings.TrimSuffix(recordName, "."))
+	switch {
+	case name == zone:
+		name = "@"
+	case strings.HasSuffix(name, "."+zone):
+		name = strings.TrimSuffix(name, "."+zone)
+	default:
+		return ErrAzureDNSRecordNotInZone
+	}
+
+	path := p.zonePath(zoneName) + "/" + rrType + "/" + name
+
+	record := azureRecordSet{Properties: azureRecordSetProperties{TTL: p.options.TTL}}
+	if rrType == "A" {
+		record.Properties.ARecords = []azureARecord{{IPv4Address: ip.String()}}
+	} else {
+		record.Properties.AAAARecords = []azureAAAARecord{{IPv6Address: ip.String()}}
+	}
+
+	for attempt := 0; attempt < azureDNSZoneUpdateAttempts; attempt++ {
+		etag, err := p.getEtag(ctx, path)
+		if err != nil {
+			return err
+		}
+
+		// the etag ensures that the record set has not changed since it
+		// was read, or that it still does not exist
+		header := http.Header{}
+		if etag != "" {
+			header.Set("If-Match", etag)
+		} else {
+			header.Set("If-None-Match", "*")
+		}
+
+		_, err = p.request(ctx, http.MethodPut, path, header, record, nil)
+		if azErr, ok := err.(*AzureError); ok && azErr.StatusCode == http.StatusPreconditionFailed {
+			continue
+		}
+
+		return err
+	}
+
+	return ErrAzureDNSConcurrentUpdate
+}
+
+// getEtag returns the etag of the record set, or an empty string if it does
+// not exist.
+func (p *AzureDNSZone) getEtag(ctx context.Context, path string) (string, error) {
+	existing := azureRecordSet{}
+	header, err := p.request(ctx, http.MethodGet, path, nil, nil, &existing)
+	if azErr, ok := err.(*AzureError); ok && azErr.StatusCode == http.StatusNotFound {
+		// tell a missing record set apart from a missing zone
+		if azErr.Code == "ParentResourceNotFound" {
+			return "", ErrAzureDNSNoZoneFound
+		}
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if etag := header.Get("ETag"); etag != "" {
+		return etag, nil
+	}
+
+	return existing.Etag, nil
+}
+
+func (p *AzureDNSZone) request(ctx context.Context, method string, path string, header http.Header, body interface{}, result interface{}) (http.Header, error) {
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, p.options.APIURL+path+"?api-version="+azureDNSAPIVersion, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	return p.do(req, result)
+}
+
+func (p *AzureDNSZone) do(req *http.Request, result interface{}) (http.Header, error) {
+	resp, err := p.options.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		azErr := &AzureError{StatusCode: resp.StatusCode}
+
+		// the resource manager and the token endpoint report errors
+		// differently
+		response := struct {
+			Error            json.RawMessage `json:"error"`
+			ErrorDescription string          `json:"error_description"`
+		}{}
+		if json.NewDecoder(resp.Body).Decode(&response) == nil {
+			apiError := struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			}{}
+			if json.Unmarshal(response.Error, &apiError) == nil && apiError.Code != "" {
+				azErr.Code, azErr.Message = apiError.Code, apiError.Message
+			} else {
+				json.Unmarshal(response.Error, &azErr.Code)
+				azErr.Message = response.ErrorDescription
+			}
+		}
+
+		return nil, azErr
+	}
+
+	if result == nil {
+		return resp.Header, nil
+	}
+
+	return resp.Header, json.NewDecoder(resp.Body).Decode(result)
+}
+
+// accessToken returns an OAuth 2.0 access token for the service principal,
+// requesting a new one when the previous one is about to expire.
+func (p *AzureDNSZone) accessToken(ctx context.Context) (string, error) {
+	p.tokenMutex.Lock()
+	defer p.tokenMutex.Unlock()
+
+	if p.token != "" && time.Now().Before(p.tokenExpiry) {
+		return p.token, nil
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.options.TokenURL, strings.NewReader(url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {p.options.ClientID},
+		"client_secret": {p.options.ClientSecret},
+		"scope":         {p.options.APIURL + "/.default"},
+	}.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}{}
+	if _, err := p.do(req, &token); err != nil {
+		return "", err
+	}
+
+	if token.AccessToken == "" {
+		return "", &AzureError{StatusCode: http.StatusOK, Message: "no access token in the response"}
+	}
+
+	// renew the token a minute before it expires
+	p.token = token.AccessToken
+	p.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+
+	return p.token, nil
+}
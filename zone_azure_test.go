@@ -0,0 +1,351 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// mockAzureDNSAPI is a minimal in-memory stand-in for the Microsoft identity
+// platform token endpoint and the Azure DNS REST API, serving a single zone.
+type mockAzureDNSAPI struct {
+	sync.Mutex
+	zone          string
+	nameservers   []string
+	recordSets    map[string]azureRecordSet
+	nextEtag      int
+	tokenRequests int
+
+	// conflicts is the number of record set updates that fail because the
+	// record set is modified concurrently.
+	conflicts int
+}
+
+func newMockAzureDNSAPI() *mockAzureDNSAPI {
+	return &mockAzureDNSAPI{
+		zone:        "example.com",
+		nameservers: []string{"ns1-01.azure-dns.com.", "ns2-01.azure-dns.net."},
+		recordSets:  map[string]azureRecordSet{},
+	}
+}
+
+func (m *mockAzureDNSAPI) reply(w http.ResponseWriter, code int, errCode string, result interface{}) {
+	if code >= 400 {
+		result = map[string]interface{}{"error": map[string]interface{}{"code": errCode, "message": result}}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(result)
+}
+
+func (m *mockAzureDNSAPI) etag() string {
+	m.nextEtag++
+	return strconv.Itoa(m.nextEtag)
+}
+
+func (m *mockAzureDNSAPI) token(w http.ResponseWriter, r *http.Request) {
+	m.tokenRequests++
+
+	if r.PostFormValue("grant_type") != "client_credentials" || r.PostFormValue("client_id") != "client-id" || r.PostFormValue("client_secret") != "client-secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client", "error_description": "Invalid client secret provided."})
+		return
+	}
+
+	m.reply(w, http.StatusOK, "", map[string]interface{}{
+		"access_token": "test-access-token",
+		"expires_in":   3599,
+		"token_type":   "Bearer",
+	})
+}
+
+func (m *mockAzureDNSAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	if r.URL.Path == "/tenant-id/oauth2/v2.0/token" && r.Method == http.MethodPost {
+		m.token(w, r)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer test-access-token" {
+		m.reply(w, http.StatusUnauthorized, "InvalidAuthenticationToken", "The access token is invalid.")
+		return
+	}
+
+	if r.URL.Query().Get("api-version") != azureDNSAPIVersion {
+		m.reply(w, http.StatusBadRequest, "InvalidApiVersionParameter", "The api-version is invalid.")
+		return
+	}
+
+	zonesPath := "/subscriptions/subscription-id/resourceGroups/resource-group/providers/Microsoft.Network/dnsZones/"
+	if !strings.HasPrefix(r.URL.Path, zonesPath) {
+		m.reply(w, http.StatusNotFound, "ResourceGroupNotFound", "Resource group could not be found.")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, zonesPath), "/")
+	if parts[0] != m.zone {
+		code := "ResourceNotFound"
+		if len(parts) > 1 {
+			code = "ParentResourceNotFound"
+		}
+		m.reply(w, http.StatusNotFound, code, "The DNS zone was not found.")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		m.reply(w, http.StatusOK, "", map[string]interface{}{
+			"name":       m.zone,
+			"properties": map[string]interface{}{"nameServers": m.nameservers},
+		})
+	case len(parts) == 3 && r.Method == http.MethodGet:
+		rs, ok := m.recordSets[parts[1]+"/"+parts[2]]
+		if !ok {
+			m.reply(w, http.StatusNotFound, "NotFound", "The resource record was not found.")
+			return
+		}
+		w.Header().Set("ETag", rs.Etag)
+		m.reply(w, http.StatusOK, "", rs)
+	case len(parts) == 3 && r.Method == http.MethodPut:
+		key := parts[1] + "/" + parts[2]
+		if m.conflicts > 0 {
+			m.conflicts--
+			if rs, ok := m.recordSets[key]; ok {
+				rs.Etag = m.etag()
+				m.recordSets[key] = rs
+			}
+		}
+
+		existing, ok := m.recordSets[key]
+		if (ok && r.Header.Get("If-Match") != existing.Etag) || (!ok && r.Header.Get("If-None-Match") != "*") {
+			m.reply(w, http.StatusPreconditionFailed, "PreconditionFailed", "The etag does not match.")
+			return
+		}
+
+		rs := azureRecordSet{}
+		json.NewDecoder(r.Body).Decode(&rs)
+		rs.Etag = m.etag()
+		m.recordSets[key] = rs
+		m.reply(w, http.StatusOK, "", rs)
+	default:
+		m.reply(w, http.StatusNotFound, "NotFound", "Not found")
+	}
+}
+
+func setupTestAzureDNSZone(options *AzureDNSZoneOptions) (*AzureDNSZone, *mockAzureDNSAPI, func()) {
+	api := newMockAzureDNSAPI()
+	ts := httptest.NewServer(api)
+
+	options.TenantID = "tenant-id"
+	options.ClientID = "client-id"
+	if options.ClientSecret == "" {
+		options.ClientSecret = "client-secret"
+	}
+	options.SubscriptionID = "subscription-id"
+	options.ResourceGroup = "resource-group"
+	options.APIURL = ts.URL
+	options.TokenURL = ts.URL + "/tenant-id/oauth2/v2.0/token"
+
+	p, _ := NewAzureDNSZoneWithOptions(options)
+	return p, api, ts.Close
+}
+
+func TestNewAzureDNSZone_required(t *testing.T) {
+	if _, err := NewAzureDNSZoneWithOptions(&AzureDNSZoneOptions{TenantID: "tenant-id", ClientID: "client-id"}); err != ErrAzureDNSCredentialsAreRequired {
+		t.Errorf("NewAzureDNSZoneWithOptions returned unexpected error: %+v", err)
+	}
+
+	if _, err := NewAzureDNSZoneWithOptions(&AzureDNSZoneOptions{
+		TenantID:       "tenant-id",
+		ClientID:       "client-id",
+		ClientSecret:   "client-secret",
+		SubscriptionID: "subscription-id",
+	}); err != ErrAzureDNSResourceGroupIsRequired {
+		t.Errorf("NewAzureDNSZoneWithOptions returned unexpected error: %+v", err)
+	}
+}
+
+func TestAzureDNSZone_defaults(t *testing.T) {
+	p, err := NewAzureDNSZoneWithOptions(&AzureDNSZoneOptions{
+		TenantID:       "tenant-id",
+		ClientID:       "client-id",
+		ClientSecret:   "client-secret",
+		SubscriptionID: "subscription-id",
+		ResourceGroup:  "resource-group",
+	})
+	if err != nil {
+		t.Fatalf("NewAzureDNSZoneWithOptions returned unexpected error: %+v", err)
+	}
+
+	if p.options.TTL != defaultAzureDNSZoneRecordTTL {
+		t.Errorf("NewAzureDNSZoneWithOptions default TTL is not what was expected: %+v", p.options.TTL)
+	}
+
+	if p.options.APIURL != defaultAzureDNSZoneAPIURL {
+		t.Errorf("NewAzureDNSZoneWithOptions default APIURL is not what was expected: %+v", p.options.APIURL)
+	}
+
+	if p.options.TokenURL != "https://login.microsoftonline.com/tenant-id/oauth2/v2.0/token" {
+		t.Errorf("NewAzureDNSZoneWithOptions default TokenURL is not what was expected: %+v", p.options.TokenURL)
+	}
+}
+
+func TestAzureDNSZone_UpdateA(t *testing.T) {
+	p, api, stop := setupTestAzureDNSZone(&AzureDNSZoneOptions{TTL: 120})
+	defer stop()
+
+	// creates the record set
+	if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.1.1.1")); err != nil {
+		t.Fatalf("AzureDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	// updates the existing record set
+	if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.2.3.4")); err != nil {
+		t.Fatalf("AzureDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	rs, ok := api.recordSets["A/test"]
+	if !ok || len(api.recordSets) != 1 {
+		t.Fatalf("AzureDNSZone.UpdateA did not store the record set: %+v", api.recordSets)
+	}
+
+	if rs.Properties.TTL != 120 || len(rs.Properties.ARecords) != 1 || rs.Properties.ARecords[0].IPv4Address != "1.2.3.4" {
+		t.Errorf("AzureDNSZone.UpdateA stored unexpected record set: %+v", rs)
+	}
+
+	if api.tokenRequests != 1 {
+		t.Errorf("AzureDNSZone.UpdateA did not reuse the access token: %d requests", api.tokenRequests)
+	}
+}
+
+func TestAzureDNSZone_UpdateAAAA_apex(t *testing.T) {
+	p, api, stop := setupTestAzureDNSZone(&AzureDNSZoneOptions{})
+	defer stop()
+
+	if err := p.UpdateAAAA("example.com.", "example.com.", net.ParseIP("2001:db8::1")); err != nil {
+		t.Fatalf("AzureDNSZone.UpdateAAAA returned unexpected error: %+v", err)
+	}
+
+	rs := api.recordSets["AAAA/@"]
+	if rs.Properties.TTL != defaultAzureDNSZoneRecordTTL || len(rs.Properties.AAAARecords) != 1 || rs.Properties.AAAARecords[0].IPv6Address != "2001:db8::1" {
+		t.Errorf("AzureDNSZone.UpdateAAAA stored unexpected record set: %+v", rs)
+	}
+}
+
+func TestAzureDNSZone_UpdateA_concurrentUpdate(t *testing.T) {
+	p, api, stop := setupTestAzureDNSZone(&AzureDNSZoneOptions{})
+	defer stop()
+
+	if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.1.1.1")); err != nil {
+		t.Fatalf("AzureDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	// retries with the new etag
+	api.conflicts = azureDNSZoneUpdateAttempts - 1
+	if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.2.3.4")); err != nil {
+		t.Fatalf("AzureDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	if ip := api.recordSets["A/test"].Properties.ARecords[0].IPv4Address; ip != "1.2.3.4" {
+		t.Errorf("AzureDNSZone.UpdateA stored unexpected IP address: %s", ip)
+	}
+
+	// gives up
+	api.conflicts = azureDNSZoneUpdateAttempts
+	if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("5.6.7.8")); err != ErrAzureDNSConcurrentUpdate {
+		t.Errorf("AzureDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+}
+
+func TestAzureDNSZone_UpdateA_noZone(t *testing.T) {
+	p, _, stop := setupTestAzureDNSZone(&AzureDNSZoneOptions{})
+	defer stop()
+
+	err := p.UpdateA("test.example.org.", "example.org.", net.ParseIP("1.1.1.1"))
+	if err != ErrAzureDNSNoZoneFound {
+		t.Errorf("AzureDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+}
+
+func TestAzureDNSZone_UpdateA_badSecret(t *testing.T) {
+	p, _, stop := setupTestAzureDNSZone(&AzureDNSZoneOptions{ClientSecret: "wrong"})
+	defer stop()
+
+	err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.1.1.1"))
+	azErr, ok := err.(*AzureError)
+	if !ok {
+		t.Fatalf("AzureDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	if azErr.StatusCode != http.StatusUnauthorized || azErr.Code != "invalid_client" || azErr.Message != "Invalid client secret provided." {
+		t.Errorf("AzureDNSZone.UpdateA returned unexpected error: %+v", azErr)
+	}
+}
+
+func TestAzureDNSZone_Nameservers(t *testing.T) {
+	p, _, stop := setupTestAzureDNSZone(&AzureDNSZoneOptions{})
+	defer stop()
+
+	ns, err := p.Nameservers("example.com.")
+	if err != nil {
+		t.Fatalf("AzureDNSZone.Nameservers returned unexpected error: %+v", err)
+	}
+
+	if len(ns) != 2 || ns[0] != "ns1-01.azure-dns.com" || ns[1] != "ns2-01.azure-dns.net" {
+		t.Errorf("AzureDNSZone.Nameservers returned unexpected nameservers: %+v", ns)
+	}
+
+	if _, err := p.Nameservers("example.org."); err != ErrAzureDNSNoZoneFound {
+		t.Errorf("AzureDNSZone.Nameservers returned unexpected error: %+v", err)
+	}
+}
+
+func TestAzureDNSZone_UpdateA_caseInsensitive(t *testing.T) {
+	p, api, stop := setupTestAzureDNSZone(&AzureDNSZoneOptions{})
+	defer stop()
+
+	if err := p.UpdateA("Test.Example.COM.", "example.com.", net.ParseIP("1.1.1.1")); err != nil {
+		t.Fatalf("AzureDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	if _, ok := api.recordSets["A/test"]; !ok || len(api.recordSets) != 1 {
+		t.Errorf("AzureDNSZone.UpdateA stored unexpected record sets: %+v", api.recordSets)
+	}
+}
+
+func TestAzureDNSZone_UpdateA_notInZone(t *testing.T) {
+	p, api, stop := setupTestAzureDNSZone(&AzureDNSZoneOptions{})
+	defer stop()
+
+	for _, recordName := range []string{"test.example.org.", "testexample.com."} {
+		if err := p.UpdateA(recordName, "example.com.", net.ParseIP("1.1.1.1")); err != ErrAzureDNSRecordNotInZone {
+			t.Errorf("AzureDNSZone.UpdateA returned unexpected error: %+v", err)
+		}
+	}
+
+	if len(api.recordSets) != 0 {
+		t.Errorf("AzureDNSZone.UpdateA stored unexpected record sets: %+v", api.recordSets)
+	}
+}
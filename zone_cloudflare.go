@@ -0,0 +1,280 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrCloudflareNoZoneFound is returned when the Cloudflare DNS Zone
+	// provider fails to find the Cloudflare zone.
+	ErrCloudflareNoZoneFound = errors.New("could not find a Cloudflare zone")
+
+	// ErrCloudflareAPITokenIsRequired is returned when trying to create a
+	// CloudflareZone without an API token.
+	ErrCloudflareAPITokenIsRequired = errors.New("the APIToken option is required")
+
+	defaultCloudflareZoneRecordTTL int64 = 60
+	defaultCloudflareZoneAPIURL          = "https://api.cloudflare.com/client/v4"
+	defaultCloudflareZoneClient          = &http.Client{}
+)
+
+// CloudflareZone is a DNS Zone provider based on the Cloudflare v4 API.
+type CloudflareZone struct {
+	options *CloudflareZoneOptions
+}
+
+// CloudflareZoneOptions are used to alter the behaviour of the Cloudflare DNS
+// zone provider.
+type CloudflareZoneOptions struct {
+	// API token used to authenticate with the Cloudflare API. It needs the
+	// Zone:Read and DNS:Edit permissions.
+	APIToken string
+
+	// TTL of the records. Proxied records always use an automatic TTL.
+	TTL int64
+
+	// Whether the records should be proxied through Cloudflare.
+	Proxied bool
+
+	// Base URL of the Cloudflare API.
+	APIURL string
+
+	// HTTP Client used to send the API requests.
+	Client *http.Client
+}
+
+// CloudflareError is returned when the Cloudflare API responds with an
+// unsuccessful result.
+type CloudflareError struct {
+	StatusCode int
+	Messages   []string
+}
+
+func (e *CloudflareError) Error() string {
+	if len(e.Messages) == 0 {
+		return "cloudflare API request failed: " + http.StatusText(e.StatusCode)
+	}
+
+	return "cloudflare API request failed: " + strings.Join(e.Messages, ", ")
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+type cloudflareZoneResult struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	NameServers []string `json:"name_servers"`
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int64  `json:"ttl"`
+	Proxied bool   `json:"proxied"`
+}
+
+// NewCloudflareZone returns a new instantiated Cloudflare DNS zone provider
+// with default options, authenticating using the API token.
+func NewCloudflareZone(apiToken string) (*CloudflareZone, error) {
+	return NewCloudflareZoneWithOptions(&CloudflareZoneOptions{APIToken: apiToken})
+}
+
+// NewCloudflareZoneWithOptions returns a new instantiated Cloudflare DNS zone
+// provider using the specified options.
+func NewCloudflareZoneWithOptions(options *CloudflareZoneOptions) (*CloudflareZone, error) {
+	if options.APIToken == "" {
+		return nil, ErrCloudflareAPITokenIsRequired
+	}
+
+	if options.TTL == 0 {
+		options.TTL = defaultCloudflareZoneRecordTTL
+	}
+
+	if options.APIURL == "" {
+		options.APIURL = defaultCloudflareZoneAPIURL
+	}
+
+	if _, err := url.Parse(options.APIURL); err != nil {
+		return nil, err
+	}
+
+	if options.Client == nil {
+		options.Client = defaultCloudflareZoneClient
+	}
+
+	return &CloudflareZone{options: options}, nil
+}
+
+// UpdateA will set the Cloudflare A Record in the specified zone to point to
+// the provided IP address, creating the record if it does not exist.
+func (p *CloudflareZone) UpdateA(recordName string, zoneName string, ip net.IP) error {
+	return p.UpdateAContext(context.Background(), recordName, zoneName, ip)
+}
+
+// UpdateAContext is like UpdateA but aborts the API requests when the context
+// is cancelled.
+func (p *CloudflareZone) UpdateAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error {
+	return p.updateRecord(ctx, recordName, zoneName, "A", ip)
+}
+
+// UpdateAAAA will set the Cloudflare AAAA Record in the specified zone to
+// point to the provided IPv6 address, creating the record if it does not
+// exist.
+func (p *CloudflareZone) UpdateAAAA(recordName string, zoneName string, ip net.IP) error {
+	return p.UpdateAAAAContext(context.Background(), recordName, zoneName, ip)
+}
+
+// UpdateAAAAContext is like UpdateAAAA but aborts the API requests when the
+// context is cancelled.
+func (p *CloudflareZone) UpdateAAAAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error {
+	return p.updateRecord(ctx, recordName, zoneName, "AAAA", ip)
+}
+
+// Nameservers returns the list of authoritative namservers for a DNS zone.
+func (p *CloudflareZone) Nameservers(zoneName string) ([]string, error) {
+	return p.NameserversContext(context.Background(), zoneName)
+}
+
+// NameserversContext is like Nameservers but aborts the API requests when the
+// context is cancelled.
+func (p *CloudflareZone) NameserversContext(ctx context.Context, zoneName string) ([]string, error) {
+	zone, err := p.getZone(ctx, zoneName)
+	if err != nil {
+		return nil, err
+	}
+
+	return zone.NameServers, nil
+}
+
+func (p *CloudflareZone) updateRecord(ctx context.Context, recordName string, zoneName string, rrType string, ip net.IP) error {
+	zone, err := p.getZone(ctx, zoneName)
+	if err != nil {
+		return err
+	}
+
+	record := cloudflareRecord{
+		Type:    rrType,
+		Name:    strings.TrimSuffix(recordName, "."),
+		Content: ip.String(),
+		TTL:     p.options.TTL,
+		Proxied: p.options.Proxied,
+	}
+	if record.Proxied {
+		// Cloudflare requires proxied records to use an automatic TTL.
+		record.TTL = 1
+	}
+
+	records := []cloudflareRecord{}
+	err = p.request(ctx, http.MethodGet, "/zones/"+zone.ID+"/dns_records", url.Values{
+		"type": {record.Type},
+		"name": {record.Name},
+	}, nil, &records)
+	if err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		return p.request(ctx, http.MethodPost, "/zones/"+zone.ID+"/dns_records", nil, record, nil)
+	}
+
+	return p.request(ctx, http.MethodPatch, "/zones/"+zone.ID+"/dns_records/"+records[0].ID, nil, record, nil)
+}
+
+func (p *CloudflareZone) getZone(ctx context.Context, name string) (*cloudflareZoneResult, error) {
+	name = strings.TrimSuffix(name, ".")
+
+	zones := []cloudflareZoneResult{}
+	if err := p.request(ctx, http.MethodGet, "/zones", url.Values{"name": {name}}, nil, &zones); err != nil {
+		return nil, err
+	}
+
+	if len(zones) == 0 || zones[0].Name != name {
+		return nil, ErrCloudflareNoZoneFound
+	}
+
+	return &zones[0], nil
+}
+
+func (p *CloudflareZone) request(ctx context.Context, method string, path string, query url.Values, body interface{}, result interface{}) error {
+	u := p.options.APIURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+p.options.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.options.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	response := cloudflareResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil && resp.StatusCode == http.StatusOK {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK || !response.Success {
+		cfErr := &CloudflareError{StatusCode: resp.StatusCode}
+		for _, e := range response.Errors {
+			cfErr.Messages = append(cfErr.Messages, e.Message)
+		}
+		return cfErr
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(response.Result, result)
+}
@@ -0,0 +1,226 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// mockCloudflareAPI is a minimal in-memory stand-in for the Cloudflare v4
+// API, serving a single zone.
+type mockCloudflareAPI struct {
+	sync.Mutex
+	token   string
+	zone    cloudflareZoneResult
+	records map[string]cloudflareRecord
+	nextID  int
+}
+
+func newMockCloudflareAPI() *mockCloudflareAPI {
+	return &mockCloudflareAPI{
+		token: "test-token",
+		zone: cloudflareZoneResult{
+			ID:          "zone-id",
+			Name:        "example.com",
+			NameServers: []string{"ns1.example.com", "ns2.example.com"},
+		},
+		records: map[string]cloudflareRecord{},
+	}
+}
+
+func (m *mockCloudflareAPI) reply(w http.ResponseWriter, code int, result interface{}) {
+	resp := map[string]interface{}{
+		"success": code == http.StatusOK,
+		"errors":  []interface{}{},
+		"result":  result,
+	}
+	if code != http.StatusOK {
+		resp["errors"] = []interface{}{map[string]interface{}{"code": 1000, "message": result}}
+		resp["result"] = nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (m *mockCloudflareAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+m.token {
+		m.reply(w, http.StatusForbidden, "Invalid API Token")
+		return
+	}
+
+	recordsPath := "/zones/" + m.zone.ID + "/dns_records"
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/zones":
+		zones := []cloudflareZoneResult{}
+		if r.URL.Query().Get("name") == m.zone.Name {
+			zones = append(zones, m.zone)
+		}
+		m.reply(w, http.StatusOK, zones)
+	case r.Method == http.MethodGet && r.URL.Path == recordsPath:
+		records := []cloudflareRecord{}
+		for _, rec := range m.records {
+			if rec.Name == r.URL.Query().Get("name") && rec.Type == r.URL.Query().Get("type") {
+				records = append(records, rec)
+			}
+		}
+		m.reply(w, http.StatusOK, records)
+	case r.Method == http.MethodPost && r.URL.Path == recordsPath:
+		rec := cloudflareRecord{}
+		json.NewDecoder(r.Body).Decode(&rec)
+		m.nextID++
+		rec.ID = strings.Repeat("r", m.nextID)
+		m.records[rec.ID] = rec
+		m.reply(w, http.StatusOK, rec)
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, recordsPath+"/"):
+		id := strings.TrimPrefix(r.URL.Path, recordsPath+"/")
+		if _, ok := m.records[id]; !ok {
+			m.reply(w, http.StatusNotFound, "Record not found")
+			return
+		}
+		rec := cloudflareRecord{}
+		json.NewDecoder(r.Body).Decode(&rec)
+		rec.ID = id
+		m.records[id] = rec
+		m.reply(w, http.StatusOK, rec)
+	default:
+		m.reply(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func setupTestCloudflareZone(options *CloudflareZoneOptions) (*CloudflareZone, *mockCloudflareAPI, func()) {
+	api := newMockCloudflareAPI()
+	ts := httptest.NewServer(api)
+
+	if options.APIToken == "" {
+		options.APIToken = api.token
+	}
+	options.APIURL = ts.URL
+
+	p, _ := NewCloudflareZoneWithOptions(options)
+	return p, api, ts.Close
+}
+
+func TestNewCloudflareZone_noToken(t *testing.T) {
+	if _, err := NewCloudflareZone(""); err != ErrCloudflareAPITokenIsRequired {
+		t.Errorf("NewCloudflareZone returned unexpected error: %+v", err)
+	}
+}
+
+func TestCloudflareZone_defaults(t *testing.T) {
+	p, _ := NewCloudflareZone("token")
+
+	if p.options.TTL != defaultCloudflareZoneRecordTTL {
+		t.Errorf("NewCloudflareZone default TTL is not what was expected: %+v", p.options.TTL)
+	}
+
+	if p.options.APIURL != defaultCloudflareZoneAPIURL {
+		t.Errorf("NewCloudflareZone default APIURL is not what was expected: %+v", p.options.APIURL)
+	}
+}
+
+func TestCloudflareZone_UpdateA(t *testing.T) {
+	p, api, stop := setupTestCloudflareZone(&CloudflareZoneOptions{TTL: 120})
+	defer stop()
+
+	// creates the record
+	if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.1.1.1")); err != nil {
+		t.Fatalf("CloudflareZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	if len(api.records) != 1 {
+		t.Fatalf("CloudflareZone.UpdateA did not create the record")
+	}
+
+	// updates the existing record
+	if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.2.3.4")); err != nil {
+		t.Fatalf("CloudflareZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	if len(api.records) != 1 {
+		t.Fatalf("CloudflareZone.UpdateA created a duplicate record")
+	}
+
+	for _, rec := range api.records {
+		if rec.Type != "A" || rec.Name != "test.example.com" || rec.Content != "1.2.3.4" || rec.TTL != 120 || rec.Proxied {
+			t.Errorf("CloudflareZone.UpdateA stored unexpected record: %+v", rec)
+		}
+	}
+}
+
+func TestCloudflareZone_UpdateAAAA_proxied(t *testing.T) {
+	p, api, stop := setupTestCloudflareZone(&CloudflareZoneOptions{Proxied: true})
+	defer stop()
+
+	if err := p.UpdateAAAA("test.example.com.", "example.com.", net.ParseIP("2001:db8::1")); err != nil {
+		t.Fatalf("CloudflareZone.UpdateAAAA returned unexpected error: %+v", err)
+	}
+
+	for _, rec := range api.records {
+		if rec.Type != "AAAA" || rec.Content != "2001:db8::1" || rec.TTL != 1 || !rec.Proxied {
+			t.Errorf("CloudflareZone.UpdateAAAA stored unexpected record: %+v", rec)
+		}
+	}
+}
+
+func TestCloudflareZone_UpdateA_noZone(t *testing.T) {
+	p, _, stop := setupTestCloudflareZone(&CloudflareZoneOptions{})
+	defer stop()
+
+	err := p.UpdateA("test.example.org.", "example.org.", net.ParseIP("1.1.1.1"))
+	if err != ErrCloudflareNoZoneFound {
+		t.Errorf("CloudflareZone.UpdateA returned unexpected error: %+v", err)
+	}
+}
+
+func TestCloudflareZone_UpdateA_badToken(t *testing.T) {
+	p, _, stop := setupTestCloudflareZone(&CloudflareZoneOptions{APIToken: "wrong"})
+	defer stop()
+
+	err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.1.1.1"))
+	cfErr, ok := err.(*CloudflareError)
+	if !ok {
+		t.Fatalf("CloudflareZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	if cfErr.StatusCode != http.StatusForbidden || len(cfErr.Messages) != 1 || cfErr.Messages[0] != "Invalid API Token" {
+		t.Errorf("CloudflareZone.UpdateA returned unexpected error: %+v", cfErr)
+	}
+}
+
+func TestCloudflareZone_Nameservers(t *testing.T) {
+	p, _, stop := setupTestCloudflareZone(&CloudflareZoneOptions{})
+	defer stop()
+
+	ns, err := p.Nameservers("example.com.")
+	if err != nil {
+		t.Fatalf("CloudflareZone.Nameservers returned unexpected error: %+v", err)
+	}
+
+	if len(ns) != 2 || ns[0] != "ns1.example.com" || ns[1] != "ns2.example.com" {
+		t.Errorf("CloudflareZone.Nameservers returned unexpected nameservers: %+v", ns)
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrDigitalOceanNoDomainFound is returned when the DigitalOcean DNS Zone
+	// provider fails to find the DigitalOcean domain.
+	ErrDigitalOceanNoDomainFound = errors.New("could not find a DigitalOcean domain")
+
+	// ErrDigitalOceanRecordNotInZone is returned when trying to update a
+	// record whose name is not within the DigitalOcean domain.
+	ErrDigitalOceanRecordNotInZone = errors.New("the record is not in the DigitalOcean domain")
+
+	// ErrDigitalOceanAPITokenIsRequired is returned when trying to create a
+	// DigitalOceanZone without an API token.
+	ErrDigitalOceanAPITokenIsRequired = errors.New("the APIToken option is required")
+
+	defaultDigitalOceanZoneRecordTTL int64 = 60
+	defaultDigitalOceanZoneAPIURL          = "https://api.digitalocean.com/v2"
+	defaultDigitalOceanZoneClient          = &http.Client{}
+)
+
+// DigitalOceanZone is a DNS Zone provider based on the DigitalOcean v2 API.
+type DigitalOceanZone struct {
+	options *DigitalOceanZoneOptions
+}
+
+// DigitalOceanZoneOptions are used to alter the behaviour of the DigitalOcean
+// DNS zone provider.
+type DigitalOceanZoneOptions struct {
+	// API token used to authenticate with the DigitalOcean API. It needs
+	// write access.
+	APIToken string
+
+	// TTL of the records.
+	TTL int64
+
+	// Base URL of the DigitalOcean API.
+	APIURL string
+
+	// HTTP Client used to send the API requests.
+	Client *http.Client
+}
+
+// DigitalOceanError is returned when the DigitalOcean API responds with an
+// unsuccessful status code.
+type DigitalOceanError struct {
+	StatusCode int
+	ID         string
+	Message    string
+}
+
+func (e *DigitalOceanError) Error() string {
+	if e.Message == "" {
+		return "digitalocean API request failed: " + http.StatusText(e.StatusCode)
+	}
+
+	return "digitalocean API request failed: " + e.Message
+}
+
+type digitalOceanRecord struct {
+	ID   int64  `json:"id,omitempty"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Data string `json:"data"`
+	TTL  int64  `json:"ttl,omitempty"`
+}
+
+// NewDigitalOceanZone returns a new instantiated DigitalOcean DNS zone
+// provider with default options, authenticating using the API token.
+func NewDigitalOceanZone(apiToken string) (*DigitalOceanZone, error) {
+	return NewDigitalOceanZoneWithOptions(&DigitalOceanZoneOptions{APIToken: apiToken})
+}
+
+// NewDigitalOceanZoneWithOptions returns a new instantiated DigitalOcean DNS
+// zone provider using the specified options.
+func NewDigitalOceanZoneWithOptions(options *DigitalOceanZoneOptions) (*DigitalOceanZone, error) {
+	if options.APIToken == "" {
+		return nil, ErrDigitalOceanAPITokenIsRequired
+	}
+
+	if options.TTL == 0 {
+		options.TTL = defaultDigitalOceanZoneRecordTTL
+	}
+
+	if options.APIURL == "" {
+		options.APIURL = defaultDigitalOceanZoneAPIURL
+	}
+
+	if _, err := url.Parse(options.APIURL); err != nil {
+		return nil, err
+	}
+
+	if options.Client == nil {
+		options.Client = defaultDigitalOceanZoneClient
+	}
+
+	return &DigitalOceanZone{options: options}, nil
+}
+
+// UpdateA will set the DigitalOcean A Record in the specified domain to point
+// to the provided IP address, creating the record if it does not exist.
+func (p *DigitalOceanZone) UpdateA(recordName string, zoneName string, ip net.IP) error {
+	return p.UpdateAContext(context.Background(), recordName, zoneName, ip)
+}
+
+// UpdateAContext is like UpdateA but aborts the API requests when the context
+// is cancelled.
+func (p *DigitalOceanZone) UpdateAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error {
+	return p.updateRecord(ctx, recordName, zoneName, "A", ip)
+}
+
+// UpdateAAAA will set the DigitalOcean AAAA Record in the specified domain to
+// point to the provided IPv6 address, creating the record if it does not
+// exist.
+func (p *DigitalOceanZone) UpdateAAAA(recordName string, zoneName string, ip net.IP) error {
+	return p.UpdateAAAAContext(context.Background(), recordName, zoneName, ip)
+}
+
+// UpdateAAAAContext is like UpdateAAAA but aborts the API requests when the
+// context is cancelled.
+func (p *DigitalOceanZone) UpdateAAAAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error {
+	return p.updateRecord(ctx, recordName, zoneName, "AAAA", ip)
+}
+
+// Nameservers returns the list of authoritative namservers for a DNS zone.
+func (p *DigitalOceanZone) Nameservers(zoneName string) ([]string, error) {
+	return p.NameserversContext(context.Background(), zoneName)
+}
+
+// NameserversContext is like Nameservers but aborts the API requests when the
+// context is cancelled.
+func (p *DigitalOceanZone) NameserversContext(ctx context.Context, zoneName string) ([]string, error) {
+	domain, err := p.getDomain(ctx, zoneName)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := p.getRecords(ctx, domain, url.Values{"type": {"NS"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var nameservers []string
+	for _, rec := range records {
+		if rec.Name == "@" {
+			nameservers = append(nameservers, strings.TrimSuffix(rec.Data, "."))
+		}
+	}
+
+	return nameservers, nil
+}
+
+func (p *DigitalOceanZone) updateRecord(ctx context.Context, recordName string, zoneName string, rrType string, ip net.IP) error {
+	domain, err := p.getDomain(ctx, zoneName)
+	if err != nil {
+		return err
+	}
+
+	// records are named relative to the domain, with @ being the apex
+	fqdn := strings.ToLower(strings.TrimSuffix(recordName, "."))
+	name := "@"
+	switch {
+	case fqdn == domain:
+	case strings.HasSuffix(fqdn, "."+domain):
+		name = strings.TrimSuffix(fqdn, "."+domain)
+	default:
+		return ErrDigitalOceanRecordNotInZone
+	}
+
+	record := digitalOceanRecord{
+		Type: rrType,
+		Name: name,
+		Data: ip.String(),
+		TTL:  p.options.TTL,
+	}
+
+	// the name filter expects the fully qualified name of the record
+	records, err := p.getRecords(ctx, domain, url.Values{
+		"type": {record.Type},
+		"name": {fqdn},
+	})
+	if err != nil {
+		return err
+	}
+
+	path := "/domains/" + domain + "/records"
+	if len(records) == 0 {
+		return p.request(ctx, http.MethodPost, path, nil, record, nil)
+	}
+
+	if err := p.request(ctx, http.MethodPut, path+"/"+strconv.FormatInt(records[0].ID, 10), nil, record, nil); err != nil {
+		return err
+	}
+
+	// the record may have been created more than once, delete the others so
+	// that it does not keep resolving to the old addresses
+	for _, rec := range records[1:] {
+		if err := p.request(ctx, http.MethodDelete, path+"/"+strconv.FormatInt(rec.ID, 10), nil, nil, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *DigitalOceanZone) getRecords(ctx context.Context, domain string, query url.Values) ([]digitalOceanRecord, error) {
+	response := struct {
+		Records []digitalOceanRecord `json:"domain_records"`
+	}{}
+	if err := p.request(ctx, http.MethodGet, "/domains/"+domain+"/records", query, nil, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Records, nil
+}
+
+// getDomain returns the name of the domain, which DigitalOcean keeps in lower
+// case.
+func (p *DigitalOceanZone) getDomain(ctx context.Context, name string) (string, error) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	response := struct {
+		Domain struct {
+			Name string `json:"name"`
+		} `json:"domain"`
+	}{}
+	err := p.request(ctx, http.MethodGet, "/domains/"+name, nil, nil, &response)
+	if doErr, ok := err.(*DigitalOceanError); ok && doErr.StatusCode == http.StatusNotFound {
+		return "", ErrDigitalOceanNoDomainFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if response.Domain.Name != name {
+		return "", ErrDigitalOceanNoDomainFound
+	}
+
+	return name, nil
+}
+
+func (p *DigitalOceanZone) request(ctx context.Context, method string, path string, query url.Values, body interface{}, result interface{}) error {
+	u := p.options.APIURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+p.options.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.options.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		response := struct {
+			ID      string `json:"id"`
+			Message string `json:"message"`
+		}{}
+		json.NewDecoder(resp.Body).Decode(&response)
+		return &DigitalOceanError{StatusCode: resp.StatusCode, ID: response.ID, Message: response.Message}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,313 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// mockDigitalOceanAPI is a minimal in-memory stand-in for the DigitalOcean v2
+// API, serving a single domain.
+type mockDigitalOceanAPI struct {
+	sync.Mutex
+	token   string
+	domain  string
+	records map[int64]digitalOceanRecord
+	nextID  int64
+}
+
+func newMockDigitalOceanAPI() *mockDigitalOceanAPI {
+	api := &mockDigitalOceanAPI{
+		token:   "test-token",
+		domain:  "example.com",
+		records: map[int64]digitalOceanRecord{},
+	}
+
+	for _, ns := range []string{"ns1.digitalocean.com", "ns2.digitalocean.com"} {
+		api.nextID++
+		api.records[api.nextID] = digitalOceanRecord{ID: api.nextID, Type: "NS", Name: "@", Data: ns, TTL: 1800}
+	}
+
+	return api
+}
+
+func (m *mockDigitalOceanAPI) reply(w http.ResponseWriter, code int, result interface{}) {
+	if code >= 400 {
+		result = map[string]interface{}{"id": strings.ToLower(strings.Replace(http.StatusText(code), " ", "_", -1)), "message": result}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(result)
+}
+
+func (m *mockDigitalOceanAPI) fqdn(name string) string {
+	if name == "@" {
+		return m.domain
+	}
+
+	return name + "." + m.domain
+}
+
+func (m *mockDigitalOceanAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+m.token {
+		m.reply(w, http.StatusUnauthorized, "Unable to authenticate you")
+		return
+	}
+
+	domainPath := "/domains/" + m.domain
+	recordsPath := domainPath + "/records"
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == domainPath:
+		m.reply(w, http.StatusOK, map[string]interface{}{"domain": map[string]interface{}{"name": m.domain, "ttl": 1800}})
+	case r.Method == http.MethodGet && r.URL.Path == recordsPath:
+		records := []digitalOceanRecord{}
+		for _, rec := range m.records {
+			if t := r.URL.Query().Get("type"); t != "" && rec.Type != t {
+				continue
+			}
+			if n := r.URL.Query().Get("name"); n != "" && m.fqdn(rec.Name) != n {
+				continue
+			}
+			records = append(records, rec)
+		}
+		m.reply(w, http.StatusOK, map[string]interface{}{"domain_records": records})
+	case r.Method == http.MethodPost && r.URL.Path == recordsPath:
+		rec := digitalOceanRecord{}
+		json.NewDecoder(r.Body).Decode(&rec)
+		m.nextID++
+		rec.ID = m.nextID
+		m.records[rec.ID] = rec
+		m.reply(w, http.StatusCreated, map[string]interface{}{"domain_record": rec})
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, recordsPath+"/"):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, recordsPath+"/"), 10, 64)
+		if _, ok := m.records[id]; !ok {
+			m.reply(w, http.StatusNotFound, "The resource you were accessing could not be found.")
+			return
+		}
+		rec := digitalOceanRecord{}
+		json.NewDecoder(r.Body).Decode(&rec)
+		rec.ID = id
+		m.records[id] = rec
+		m.reply(w, http.StatusOK, map[string]interface{}{"domain_record": rec})
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, recordsPath+"/"):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, recordsPath+"/"), 10, 64)
+		if _, ok := m.records[id]; !ok {
+			m.reply(w, http.StatusNotFound, "The resource you were accessing could not be found.")
+			return
+		}
+		delete(m.records, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		m.reply(w, http.StatusNotFound, "The resource you were accessing could not be found.")
+	}
+}
+
+// recordsOfType returns the records of the given type.
+func (m *mockDigitalOceanAPI) recordsOfType(rrType string) []digitalOceanRecord {
+	var records []digitalOceanRecord
+	for _, rec := range m.records {
+		if rec.Type == rrType {
+			records = append(records, rec)
+		}
+	}
+
+	return records
+}
+
+func setupTestDigitalOceanZone(options *DigitalOceanZoneOptions) (*DigitalOceanZone, *mockDigitalOceanAPI, func()) {
+	api := newMockDigitalOceanAPI()
+	ts := httptest.NewServer(api)
+
+	if options.APIToken == "" {
+		options.APIToken = api.token
+	}
+	options.APIURL = ts.URL
+
+	p, _ := NewDigitalOceanZoneWithOptions(options)
+	return p, api, ts.Close
+}
+
+func TestNewDigitalOceanZone_noToken(t *testing.T) {
+	if _, err := NewDigitalOceanZone(""); err != ErrDigitalOceanAPITokenIsRequired {
+		t.Errorf("NewDigitalOceanZone returned unexpected error: %+v", err)
+	}
+}
+
+func TestDigitalOceanZone_defaults(t *testing.T) {
+	p, _ := NewDigitalOceanZone("token")
+
+	if p.options.TTL != defaultDigitalOceanZoneRecordTTL {
+		t.Errorf("NewDigitalOceanZone default TTL is not what was expected: %+v", p.options.TTL)
+	}
+
+	if p.options.APIURL != defaultDigitalOceanZoneAPIURL {
+		t.Errorf("NewDigitalOceanZone default APIURL is not what was expected: %+v", p.options.APIURL)
+	}
+}
+
+func TestDigitalOceanZone_UpdateA(t *testing.T) {
+	p, api, stop := setupTestDigitalOceanZone(&DigitalOceanZoneOptions{TTL: 120})
+	defer stop()
+
+	// creates the record
+	if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.1.1.1")); err != nil {
+		t.Fatalf("DigitalOceanZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	if len(api.recordsOfType("A")) != 1 {
+		t.Fatalf("DigitalOceanZone.UpdateA did not create the record")
+	}
+
+	// updates the existing record
+	if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.2.3.4")); err != nil {
+		t.Fatalf("DigitalOceanZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	records := api.recordsOfType("A")
+	if len(records) != 1 {
+		t.Fatalf("DigitalOceanZone.UpdateA created a duplicate record")
+	}
+
+	if rec := records[0]; rec.Name != "test" || rec.Data != "1.2.3.4" || rec.TTL != 120 {
+		t.Errorf("DigitalOceanZone.UpdateA stored unexpected record: %+v", rec)
+	}
+}
+
+func TestDigitalOceanZone_UpdateA_apex(t *testing.T) {
+	p, api, stop := setupTestDigitalOceanZone(&DigitalOceanZoneOptions{})
+	defer stop()
+
+	if err := p.UpdateA("example.com.", "example.com.", net.ParseIP("1.1.1.1")); err != nil {
+		t.Fatalf("DigitalOceanZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	records := api.recordsOfType("A")
+	if len(records) != 1 || records[0].Name != "@" {
+		t.Errorf("DigitalOceanZone.UpdateA stored unexpected records: %+v", records)
+	}
+}
+
+func TestDigitalOceanZone_UpdateAAAA(t *testing.T) {
+	p, api, stop := setupTestDigitalOceanZone(&DigitalOceanZoneOptions{})
+	defer stop()
+
+	if err := p.UpdateAAAA("test.example.com.", "example.com.", net.ParseIP("2001:db8::1")); err != nil {
+		t.Fatalf("DigitalOceanZone.UpdateAAAA returned unexpected error: %+v", err)
+	}
+
+	records := api.recordsOfType("AAAA")
+	if len(records) != 1 || records[0].Data != "2001:db8::1" || records[0].TTL != defaultDigitalOceanZoneRecordTTL {
+		t.Errorf("DigitalOceanZone.UpdateAAAA stored unexpected records: %+v", records)
+	}
+}
+
+func TestDigitalOceanZone_UpdateA_noDomain(t *testing.T) {
+	p, _, stop := setupTestDigitalOceanZone(&DigitalOceanZoneOptions{})
+	defer stop()
+
+	err := p.UpdateA("test.example.org.", "example.org.", net.ParseIP("1.1.1.1"))
+	if err != ErrDigitalOceanNoDomainFound {
+		t.Errorf("DigitalOceanZone.UpdateA returned unexpected error: %+v", err)
+	}
+}
+
+func TestDigitalOceanZone_UpdateA_badToken(t *testing.T) {
+	p, _, stop := setupTestDigitalOceanZone(&DigitalOceanZoneOptions{APIToken: "wrong"})
+	defer stop()
+
+	err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.1.1.1"))
+	doErr, ok := err.(*DigitalOceanError)
+	if !ok {
+		t.Fatalf("DigitalOceanZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	if doErr.StatusCode != http.StatusUnauthorized || doErr.ID != "unauthorized" || doErr.Message != "Unable to authenticate you" {
+		t.Errorf("DigitalOceanZone.UpdateA returned unexpected error: %+v", doErr)
+	}
+}
+
+func TestDigitalOceanZone_Nameservers(t *testing.T) {
+	p, _, stop := setupTestDigitalOceanZone(&DigitalOceanZoneOptions{})
+	defer stop()
+
+	ns, err := p.Nameservers("example.com.")
+	if err != nil {
+		t.Fatalf("DigitalOceanZone.Nameservers returned unexpected error: %+v", err)
+	}
+
+	if len(ns) != 2 || !(ns[0] == "ns1.digitalocean.com" || ns[1] == "ns1.digitalocean.com") {
+		t.Errorf("DigitalOceanZone.Nameservers returned unexpected nameservers: %+v", ns)
+	}
+}
+
+func TestDigitalOceanZone_UpdateA_duplicates(t *testing.T) {
+	p, api, stop := setupTestDigitalOceanZone(&DigitalOceanZoneOptions{})
+	defer stop()
+
+	for _, ip := range []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"} {
+		api.nextID++
+		api.records[api.nextID] = digitalOceanRecord{ID: api.nextID, Type: "A", Name: "test", Data: ip, TTL: 60}
+	}
+
+	if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.2.3.4")); err != nil {
+		t.Fatalf("DigitalOceanZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	records := api.recordsOfType("A")
+	if len(records) != 1 || records[0].Data != "1.2.3.4" {
+		t.Errorf("DigitalOceanZone.UpdateA left unexpected records: %+v", records)
+	}
+}
+
+func TestDigitalOceanZone_UpdateA_caseInsensitive(t *testing.T) {
+	p, api, stop := setupTestDigitalOceanZone(&DigitalOceanZoneOptions{})
+	defer stop()
+
+	if err := p.UpdateA("Test.Example.COM.", "Example.com.", net.ParseIP("1.1.1.1")); err != nil {
+		t.Fatalf("DigitalOceanZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	records := api.recordsOfType("A")
+	if len(records) != 1 || records[0].Name != "test" {
+		t.Errorf("DigitalOceanZone.UpdateA stored unexpected records: %+v", records)
+	}
+}
+
+func TestDigitalOceanZone_UpdateA_notInZone(t *testing.T) {
+	p, api, stop := setupTestDigitalOceanZone(&DigitalOceanZoneOptions{})
+	defer stop()
+
+	for _, recordName := range []string{"foo.other.com.", "testexample.com."} {
+		if err := p.UpdateA(recordName, "example.com.", net.ParseIP("1.1.1.1")); err != ErrDigitalOceanRecordNotInZone {
+			t.Errorf("DigitalOceanZone.UpdateA returned unexpected error: %+v", err)
+		}
+	}
+
+	if records := api.recordsOfType("A"); len(records) != 0 {
+		t.Errorf("DigitalOceanZone.UpdateA stored unexpected records: %+v", records)
+	}
+}
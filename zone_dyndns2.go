@@ -0,0 +1,318 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	// ErrDynDNS2URLIsRequired is returned when trying to create a DynDNS2Zone
+	// without the URL of the service.
+	ErrDynDNS2URLIsRequired = errors.New("the URL option is required")
+
+	// ErrDynDNS2BadAuth is returned when the username or password are wrong
+	// (badauth).
+	ErrDynDNS2BadAuth = errors.New("dyndns2: invalid username or password")
+
+	// ErrDynDNS2NotFQDN is returned when the hostname is not a fully
+	// qualified domain name (notfqdn).
+	ErrDynDNS2NotFQDN = errors.New("dyndns2: the hostname is not a fully qualified domain name")
+
+	// ErrDynDNS2NoHost is returned when the hostname does not exist in the
+	// account (nohost).
+	ErrDynDNS2NoHost = errors.New("dyndns2: the hostname does not exist in this account")
+
+	// ErrDynDNS2NumHost is returned when too many hostnames are updated at
+	// once (numhost).
+	ErrDynDNS2NumHost = errors.New("dyndns2: too many hosts specified")
+
+	// ErrDynDNS2Abuse is returned when the hostname is blocked for update
+	// abuse (abuse).
+	ErrDynDNS2Abuse = errors.New("dyndns2: the hostname is blocked for update abuse")
+
+	// ErrDynDNS2BadAgent is returned when the user agent is blocked or the
+	// request is malformed (badagent).
+	ErrDynDNS2BadAgent = errors.New("dyndns2: the user agent was blocked or the request is invalid")
+
+	// ErrDynDNS2NotDonator is returned when the update uses a feature that
+	// the account does not have access to (!donator).
+	ErrDynDNS2NotDonator = errors.New("dyndns2: the feature is not available to this account")
+
+	// ErrDynDNS2DNSError is returned when the service could not update the
+	// record because of an internal DNS error (dnserr).
+	ErrDynDNS2DNSError = errors.New("dyndns2: DNS error on the server side")
+
+	// ErrDynDNS2ServerError is returned when the service is down or under
+	// maintenance (911).
+	ErrDynDNS2ServerError = errors.New("dyndns2: the service is temporarily unavailable")
+
+	// ErrDynDNS2BackingOff is returned instead of contacting the service
+	// while backing off after a 911, dnserr or abuse response.
+	ErrDynDNS2BackingOff = errors.New("dyndns2: backing off after a server error or abuse response")
+
+	dynDNS2Errors = map[string]error{
+		"badauth":  ErrDynDNS2BadAuth,
+		"notfqdn":  ErrDynDNS2NotFQDN,
+		"nohost":   ErrDynDNS2NoHost,
+		"numhost":  ErrDynDNS2NumHost,
+		"abuse":    ErrDynDNS2Abuse,
+		"badagent": ErrDynDNS2BadAgent,
+		"!donator": ErrDynDNS2NotDonator,
+		"dnserr":   ErrDynDNS2DNSError,
+		"911":      ErrDynDNS2ServerError,
+	}
+
+	defaultDynDNS2ZoneUserAgent = "odyn"
+	defaultDynDNS2ZoneBackoff   = 30 * time.Minute
+	defaultDynDNS2ZoneClient    = &http.Client{}
+	defaultDynDNS2ZoneResolvers = []string{"8.8.8.8:53", "1.1.1.1:53"}
+)
+
+// DynDNS2Error is returned when the service responds with a return code that
+// is not part of the dyndns2 protocol.
+type DynDNS2Error struct {
+	StatusCode int
+	Response   string
+}
+
+func (e *DynDNS2Error) Error() string {
+	if e.Response == "" {
+		return "dyndns2: unexpected response: " + http.StatusText(e.StatusCode)
+	}
+
+	return "dyndns2: unexpected response: " + e.Response
+}
+
+// DynDNS2Zone is a DNS Zone provider for the many dynamic DNS services, such
+// as No-IP, Dyn, DNS-O-Matic and OVH DynHost, that implement the dyndns2
+// update protocol. The zone name is not used for updates, the record name
+// being the hostname registered with the service, and the TTL of the records
+// is set by the service.
+//
+// After a 911, dnserr or abuse response the service is not contacted again
+// until the back-off has elapsed, as the protocol requires. After a badauth,
+// notfqdn, nohost or badagent response it is not contacted again at all, the
+// same error being returned instead, as these need the configuration to be
+// fixed.
+type DynDNS2Zone struct {
+	options *DynDNS2ZoneOptions
+	dns     *DNSClient
+
+	backoffMutex sync.Mutex
+	backoffUntil time.Time
+	fatalErr     error
+}
+
+// DynDNS2ZoneOptions are used to alter the behaviour of the dyndns2 DNS zone
+// provider.
+type DynDNS2ZoneOptions struct {
+	// Base URL of the service, e.g. https://dynupdate.no-ip.com. The
+	// /nic/update path is appended unless the URL already has a path.
+	URL string
+
+	// Credentials used for HTTP basic authentication.
+	Username string
+	Password string
+
+	// UserAgent identifying the client, which some services require to
+	// include a contact address.
+	UserAgent string
+
+	// Resolvers used to look up the nameservers of the zone. Defaults to the
+	// public resolvers of Google and Cloudflare.
+	Resolvers []string
+
+	// Backoff is the time to wait after a 911, dnserr or abuse response.
+	// Defaults to
+	// 30 minutes.
+	Backoff time.Duration
+
+	// HTTP Client used to send the update requests.
+	Client *http.Client
+}
+
+// NewDynDNS2Zone returns a new instantiated dyndns2 DNS zone provider with
+// default options, sending updates to the service at the given URL.
+func NewDynDNS2Zone(serviceURL string, username string, password string) (*DynDNS2Zone, error) {
+	return NewDynDNS2ZoneWithOptions(&DynDNS2ZoneOptions{
+		URL:      serviceURL,
+		Username: username,
+		Password: password,
+	})
+}
+
+// NewDynDNS2ZoneWithOptions returns a new instantiated dyndns2 DNS zone
+// provider using the specified options.
+func NewDynDNS2ZoneWithOptions(options *DynDNS2ZoneOptions) (*DynDNS2Zone, error) {
+	if options.URL == "" {
+		return nil, ErrDynDNS2URLIsRequired
+	}
+
+	u, err := url.Parse(options.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/nic/update"
+		options.URL = u.String()
+	}
+
+	if options.UserAgent == "" {
+		options.UserAgent = defaultDynDNS2ZoneUserAgent
+	}
+
+	if len(options.Resolvers) == 0 {
+		options.Resolvers = defaultDynDNS2ZoneResolvers
+	}
+
+	if options.Backoff == 0 {
+		options.Backoff = defaultDynDNS2ZoneBackoff
+	}
+
+	if options.Client == nil {
+		options.Client = defaultDynDNS2ZoneClient
+	}
+
+	return &DynDNS2Zone{options: options, dns: NewDNSClient()}, nil
+}
+
+// UpdateA will ask the service to point the hostname to the provided IP
+// address.
+func (p *DynDNS2Zone) UpdateA(recordName string, zoneName string, ip net.IP) error {
+	return p.UpdateAContext(context.Background(), recordName, zoneName, ip)
+}
+
+// UpdateAContext is like UpdateA but aborts the request when the context is
+// cancelled.
+func (p *DynDNS2Zone) UpdateAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error {
+	return p.update(ctx, recordName, ip)
+}
+
+// UpdateAAAA will ask the service to point the hostname to the provided IPv6
+// address, which most services accept in place of an IPv4 address.
+func (p *DynDNS2Zone) UpdateAAAA(recordName string, zoneName string, ip net.IP) error {
+	return p.UpdateAAAAContext(context.Background(), recordName, zoneName, ip)
+}
+
+// UpdateAAAAContext is like UpdateAAAA but aborts the request when the
+// context is cancelled.
+func (p *DynDNS2Zone) UpdateAAAAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error {
+	return p.update(ctx, recordName, ip)
+}
+
+// Nameservers returns the list of authoritative namservers for a DNS zone,
+// looked up using the resolvers as the protocol has no way to query them.
+func (p *DynDNS2Zone) Nameservers(zoneName string) ([]string, error) {
+	return p.NameserversContext(context.Background(), zoneName)
+}
+
+// NameserversContext is like Nameservers but aborts the NS query when the
+// context is cancelled.
+func (p *DynDNS2Zone) NameserversContext(ctx context.Context, zoneName string) ([]string, error) {
+	return p.dns.ResolveNSContext(ctx, dns.Fqdn(zoneName), p.options.Resolvers)
+}
+
+func (p *DynDNS2Zone) update(ctx context.Context, recordName string, ip net.IP) error {
+	p.backoffMutex.Lock()
+	defer p.backoffMutex.Unlock()
+
+	if p.fatalErr != nil {
+		return p.fatalErr
+	}
+
+	if time.Now().Before(p.backoffUntil) {
+		return ErrDynDNS2BackingOff
+	}
+
+	code, err := p.request(ctx, recordName, ip)
+	switch code {
+	case "911", "dnserr", "abuse":
+		p.backoffUntil = time.Now().Add(p.options.Backoff)
+	case "badauth", "notfqdn", "nohost", "badagent":
+		// the protocol forbids retrying these without user intervention, as
+		// the service may block the client
+		p.fatalErr = err
+	}
+
+	return err
+}
+
+// request sends the update and returns the return code of the response along
+// with the error it stands for.
+func (p *DynDNS2Zone) request(ctx context.Context, recordName string, ip net.IP) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, p.options.URL+"?"+url.Values{
+		"hostname": {strings.TrimSuffix(recordName, ".")},
+		"myip":     {ip.String()},
+	}.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.SetBasicAuth(p.options.Username, p.options.Password)
+	req.Header.Set("User-Agent", p.options.UserAgent)
+
+	resp, err := p.options.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	// the return code is the first word of the response, followed by the IP
+	// address on success
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	response := strings.TrimSpace(line)
+
+	code := response
+	if i := strings.IndexAny(response, " \t"); i >= 0 {
+		code = response[:i]
+	}
+
+	switch code {
+	case "good", "nochg":
+		return code, nil
+	}
+
+	if err, ok := dynDNS2Errors[code]; ok {
+		return code, err
+	}
+
+	// some services reply to bad credentials with 401 and no return code,
+	// which may as well come from a proxy in front of the service
+	if resp.StatusCode == http.StatusUnauthorized {
+		return "", ErrDynDNS2BadAuth
+	}
+
+	return "", &DynDNS2Error{StatusCode: resp.StatusCode, Response: response}
+}
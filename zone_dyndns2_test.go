@@ -0,0 +1,271 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockDynDNS2Service is a minimal stand-in for a dyndns2 update service,
+// replying with a fixed return code.
+type mockDynDNS2Service struct {
+	sync.Mutex
+	response string
+	status   int
+	requests []url.Values
+}
+
+func (m *mockDynDNS2Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("badauth"))
+		return
+	}
+
+	if r.URL.Path != "/nic/update" || r.UserAgent() != defaultDynDNS2ZoneUserAgent {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("badagent"))
+		return
+	}
+
+	m.requests = append(m.requests, r.URL.Query())
+
+	if m.status != 0 {
+		w.WriteHeader(m.status)
+	}
+	w.Write([]byte(m.response))
+}
+
+func setupTestDynDNS2Zone(options *DynDNS2ZoneOptions, response string) (*DynDNS2Zone, *mockDynDNS2Service, func()) {
+	service := &mockDynDNS2Service{response: response}
+	ts := httptest.NewServer(service)
+
+	options.URL = ts.URL
+	if options.Username == "" {
+		options.Username = "user"
+	}
+	options.Password = "pass"
+
+	p, _ := NewDynDNS2ZoneWithOptions(options)
+	return p, service, ts.Close
+}
+
+func TestNewDynDNS2Zone_noURL(t *testing.T) {
+	if _, err := NewDynDNS2Zone("", "user", "pass"); err != ErrDynDNS2URLIsRequired {
+		t.Errorf("NewDynDNS2Zone returned unexpected error: %+v", err)
+	}
+}
+
+func TestDynDNS2Zone_defaults(t *testing.T) {
+	p, _ := NewDynDNS2Zone("https://dynupdate.no-ip.com", "user", "pass")
+
+	if p.options.URL != "https://dynupdate.no-ip.com/nic/update" {
+		t.Errorf("NewDynDNS2Zone default URL is not what was expected: %+v", p.options.URL)
+	}
+
+	if p.options.Backoff != defaultDynDNS2ZoneBackoff {
+		t.Errorf("NewDynDNS2Zone default Backoff is not what was expected: %+v", p.options.Backoff)
+	}
+
+	// custom paths are kept
+	p, _ = NewDynDNS2Zone("https://www.ovh.com/nic/update/", "user", "pass")
+	if p.options.URL != "https://www.ovh.com/nic/update/" {
+		t.Errorf("NewDynDNS2Zone did not keep the URL path: %+v", p.options.URL)
+	}
+}
+
+func TestDynDNS2Zone_UpdateA(t *testing.T) {
+	for _, response := range []string{"good 1.2.3.4", "nochg 1.2.3.4\n"} {
+		p, service, stop := setupTestDynDNS2Zone(&DynDNS2ZoneOptions{}, response)
+
+		if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.2.3.4")); err != nil {
+			t.Errorf("DynDNS2Zone.UpdateA returned unexpected error for %q: %+v", response, err)
+		}
+
+		if len(service.requests) != 1 || service.requests[0].Get("hostname") != "test.example.com" || service.requests[0].Get("myip") != "1.2.3.4" {
+			t.Errorf("DynDNS2Zone.UpdateA sent unexpected requests: %+v", service.requests)
+		}
+
+		stop()
+	}
+}
+
+func TestDynDNS2Zone_UpdateAAAA(t *testing.T) {
+	p, service, stop := setupTestDynDNS2Zone(&DynDNS2ZoneOptions{}, "good 2001:db8::1")
+	defer stop()
+
+	if err := p.UpdateAAAA("test.example.com.", "example.com.", net.ParseIP("2001:db8::1")); err != nil {
+		t.Fatalf("DynDNS2Zone.UpdateAAAA returned unexpected error: %+v", err)
+	}
+
+	if len(service.requests) != 1 || service.requests[0].Get("myip") != "2001:db8::1" {
+		t.Errorf("DynDNS2Zone.UpdateAAAA sent unexpected requests: %+v", service.requests)
+	}
+}
+
+func TestDynDNS2Zone_UpdateA_errors(t *testing.T) {
+	tests := map[string]error{
+		"badauth":  ErrDynDNS2BadAuth,
+		"notfqdn":  ErrDynDNS2NotFQDN,
+		"nohost":   ErrDynDNS2NoHost,
+		"numhost":  ErrDynDNS2NumHost,
+		"abuse":    ErrDynDNS2Abuse,
+		"badagent": ErrDynDNS2BadAgent,
+		"!donator": ErrDynDNS2NotDonator,
+		"dnserr":   ErrDynDNS2DNSError,
+		"911":      ErrDynDNS2ServerError,
+	}
+
+	for response, expected := range tests {
+		p, _, stop := setupTestDynDNS2Zone(&DynDNS2ZoneOptions{}, response+"\n")
+
+		if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.2.3.4")); err != expected {
+			t.Errorf("DynDNS2Zone.UpdateA returned unexpected error for %q: %+v", response, err)
+		}
+
+		stop()
+	}
+}
+
+func TestDynDNS2Zone_UpdateA_badCredentials(t *testing.T) {
+	p, _, stop := setupTestDynDNS2Zone(&DynDNS2ZoneOptions{Username: "wrong"}, "good 1.2.3.4")
+	defer stop()
+
+	if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.2.3.4")); err != ErrDynDNS2BadAuth {
+		t.Errorf("DynDNS2Zone.UpdateA returned unexpected error: %+v", err)
+	}
+}
+
+func TestDynDNS2Zone_UpdateA_unexpected(t *testing.T) {
+	p, service, stop := setupTestDynDNS2Zone(&DynDNS2ZoneOptions{}, "<html>Bad Gateway</html>")
+	defer stop()
+	service.status = http.StatusBadGateway
+
+	err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.2.3.4"))
+	ddErr, ok := err.(*DynDNS2Error)
+	if !ok {
+		t.Fatalf("DynDNS2Zone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	if ddErr.StatusCode != http.StatusBadGateway || ddErr.Response != "<html>Bad Gateway</html>" {
+		t.Errorf("DynDNS2Zone.UpdateA returned unexpected error: %+v", ddErr)
+	}
+}
+
+func TestDynDNS2Zone_UpdateA_backoff(t *testing.T) {
+	for _, response := range []string{"911", "dnserr", "abuse"} {
+		p, service, stop := setupTestDynDNS2Zone(&DynDNS2ZoneOptions{Backoff: 50 * time.Millisecond}, response)
+
+		if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.2.3.4")); err != dynDNS2Errors[response] {
+			t.Errorf("DynDNS2Zone.UpdateA returned unexpected error for %q: %+v", response, err)
+		}
+
+		// does not contact the service while backing off
+		if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.2.3.4")); err != ErrDynDNS2BackingOff {
+			t.Errorf("DynDNS2Zone.UpdateA returned unexpected error for %q: %+v", response, err)
+		}
+
+		if len(service.requests) != 1 {
+			t.Errorf("DynDNS2Zone.UpdateA sent %d requests while backing off", len(service.requests))
+		}
+
+		// tries again once the back-off has elapsed
+		time.Sleep(60 * time.Millisecond)
+		service.response = "good 1.2.3.4"
+		if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.2.3.4")); err != nil {
+			t.Errorf("DynDNS2Zone.UpdateA returned unexpected error after the back-off: %+v", err)
+		}
+
+		stop()
+	}
+}
+
+func TestDynDNS2Zone_UpdateA_fatal(t *testing.T) {
+	for _, response := range []string{"badauth", "nohost", "notfqdn", "badagent"} {
+		p, service, stop := setupTestDynDNS2Zone(&DynDNS2ZoneOptions{}, response)
+
+		if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.2.3.4")); err != dynDNS2Errors[response] {
+			t.Errorf("DynDNS2Zone.UpdateA returned unexpected error for %q: %+v", response, err)
+		}
+
+		// does not contact the service again, even for other records
+		service.response = "good 1.2.3.4"
+		for _, recordName := range []string{"test.example.com.", "other.example.com."} {
+			if err := p.UpdateA(recordName, "example.com.", net.ParseIP("1.2.3.4")); err != dynDNS2Errors[response] {
+				t.Errorf("DynDNS2Zone.UpdateA returned unexpected error for %q: %+v", response, err)
+			}
+		}
+
+		if len(service.requests) != 1 {
+			t.Errorf("DynDNS2Zone.UpdateA sent %d requests after %q", len(service.requests), response)
+		}
+
+		stop()
+	}
+}
+
+func TestDynDNS2Zone_UpdateA_unauthorized(t *testing.T) {
+	p, service, stop := setupTestDynDNS2Zone(&DynDNS2ZoneOptions{}, "")
+	defer stop()
+	service.status = http.StatusUnauthorized
+
+	if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.2.3.4")); err != ErrDynDNS2BadAuth {
+		t.Errorf("DynDNS2Zone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	// a 401 without a return code may be transient, e.g. from a proxy
+	service.status = 0
+	service.response = "good 1.2.3.4"
+	if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.2.3.4")); err != nil {
+		t.Errorf("DynDNS2Zone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	if len(service.requests) != 2 {
+		t.Errorf("DynDNS2Zone.UpdateA sent %d requests", len(service.requests))
+	}
+}
+
+func TestDynDNS2Zone_Nameservers(t *testing.T) {
+	servers, addr, err := startMockDNSServerRRs(map[string][]string{
+		"example.com.": []string{
+			"example.com. 60 IN NS ns1.example.net.",
+			"example.com. 60 IN NS ns2.example.net.",
+		},
+	})
+	if err != nil {
+		t.Fatalf("dnstest: unable to run test server: %v", err)
+	}
+	defer stopMockDNSServerFleet(servers)
+
+	p, _ := NewDynDNS2ZoneWithOptions(&DynDNS2ZoneOptions{URL: "http://127.0.0.1", Resolvers: []string{addr}})
+
+	ns, err := p.Nameservers("example.com")
+	if err != nil {
+		t.Fatalf("DynDNS2Zone.Nameservers returned unexpected error: %+v", err)
+	}
+
+	if len(ns) != 2 || ns[0] != "ns1.example.net" || ns[1] != "ns2.example.net" {
+		t.Errorf("DynDNS2Zone.Nameservers returned unexpected nameservers: %+v", ns)
+	}
+}
@@ -0,0 +1,541 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	// ErrGoogleCloudDNSCredentialsAreRequired is returned when trying to
+	// create a GoogleCloudDNSZone without service account credentials.
+	ErrGoogleCloudDNSCredentialsAreRequired = errors.New("the Credentials option is required")
+
+	// ErrGoogleCloudDNSInvalidCredentials is returned when the service
+	// account credentials are missing the client email or private key.
+	ErrGoogleCloudDNSInvalidCredentials = errors.New("invalid Google Cloud service account credentials")
+
+	// ErrGoogleCloudDNSProjectIsRequired is returned when the project is
+	// neither set in the options nor in the service account credentials.
+	ErrGoogleCloudDNSProjectIsRequired = errors.New("the Project option is required")
+
+	// ErrGoogleCloudDNSNoManagedZoneFound is returned when the Google Cloud
+	// DNS Zone provider fails to find the managed zone.
+	ErrGoogleCloudDNSNoManagedZoneFound = errors.New("could not find a Google Cloud DNS managed zone")
+
+	// ErrGoogleCloudDNSWatchTimedOut is returned when the update method times
+	// out waiting to confirm that the change has been applied.
+	ErrGoogleCloudDNSWatchTimedOut = errors.New("timed out")
+
+	defaultGoogleCloudDNSZoneRecordTTL     int64 = 60
+	defaultGoogleCloudDNSZoneAPIURL              = "https://dns.googleapis.com/dns/v1"
+	defaultGoogleCloudDNSZoneTokenURL            = "https://oauth2.googleapis.com/token"
+	defaultGoogleCloudDNSZoneClient              = &http.Client{}
+	defaultGoogleCloudDNSZoneWatchInterval       = 5 * time.Second
+	defaultGoogleCloudDNSZoneWatchTimeout        = 2 * time.Minute
+
+	googleCloudDNSScope = "https://www.googleapis.com/auth/ndev.clouddns.readwrite"
+)
+
+// GoogleCloudDNSZone is a DNS Zone provider based on the Google Cloud DNS v1
+// API, authenticating as a service account.
+type GoogleCloudDNSZone struct {
+	options     *GoogleCloudDNSZoneOptions
+	credentials *googleServiceAccount
+
+	tokenMutex  sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// GoogleCloudDNSZoneOptions are used to alter the behaviour of the Google
+// Cloud DNS zone provider.
+type GoogleCloudDNSZoneOptions struct {
+	// Credentials is the JSON key of the service account, which needs the
+	// DNS Administrator role or equivalent permissions.
+	Credentials []byte
+
+	// Project that owns the managed zones. Defaults to the project of the
+	// service account.
+	Project string
+
+	// TTL of the records.
+	TTL int64
+
+	// Base URL of the Cloud DNS API.
+	APIURL string
+
+	// URL of the OAuth 2.0 token endpoint. Defaults to the token_uri of the
+	// credentials.
+	TokenURL string
+
+	// HTTP Client used to send the API requests.
+	Client *http.Client
+
+	// Time between checks of the status of a change and time to wait for it
+	// to be applied.
+	WatchInterval time.Duration
+	WatchTimeout  time.Duration
+}
+
+// GoogleCloudDNSError is returned when the Google Cloud APIs respond with an
+// error.
+type GoogleCloudDNSError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *GoogleCloudDNSError) Error() string {
+	if e.Message == "" {
+		return "google cloud dns API request failed: " + http.StatusText(e.StatusCode)
+	}
+
+	return "google cloud dns API request failed: " + e.Message
+}
+
+type googleServiceAccount struct {
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+type googleCloudDNSManagedZone struct {
+	Name        string   `json:"name"`
+	DNSName     string   `json:"dnsName"`
+	NameServers []string `json:"nameServers"`
+}
+
+type googleCloudDNSRRSet struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     int64    `json:"ttl"`
+	RRDatas []string `json:"rrdatas"`
+}
+
+type googleCloudDNSChange struct {
+	ID        string                `json:"id,omitempty"`
+	Status    string                `json:"status,omitempty"`
+	Additions []googleCloudDNSRRSet `json:"additions,omitempty"`
+	Deletions []googleCloudDNSRRSet `json:"deletions,omitempty"`
+}
+
+// NewGoogleCloudDNSZone returns a new instantiated Google Cloud DNS zone
+// provider with default options, authenticating with the JSON key of a
+// service account.
+func NewGoogleCloudDNSZone(credentials []byte) (*GoogleCloudDNSZone, error) {
+	return NewGoogleCloudDNSZoneWithOptions(&GoogleCloudDNSZoneOptions{Credentials: credentials})
+}
+
+// NewGoogleCloudDNSZoneWithOptions returns a new instantiated Google Cloud
+// DNS zone provider using the specified options.
+func NewGoogleCloudDNSZoneWithOptions(options *GoogleCloudDNSZoneOptions) (*GoogleCloudDNSZone, error) {
+	if len(options.Credentials) == 0 {
+		return nil, ErrGoogleCloudDNSCredentialsAreRequired
+	}
+
+	credentials, err := parseGoogleServiceAccount(options.Credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Project == "" {
+		options.Project = credentials.ProjectID
+	}
+
+	if options.Project == "" {
+		return nil, ErrGoogleCloudDNSProjectIsRequired
+	}
+
+	if options.TTL == 0 {
+		options.TTL = defaultGoogleCloudDNSZoneRecordTTL
+	}
+
+	if options.APIURL == "" {
+		options.APIURL = defaultGoogleCloudDNSZoneAPIURL
+	}
+
+	if options.TokenURL == "" {
+		options.TokenURL = credentials.TokenURI
+	}
+
+	if options.TokenURL == "" {
+		options.TokenURL = defaultGoogleCloudDNSZoneTokenURL
+	}
+
+	for _, u := range []string{options.APIURL, options.TokenURL} {
+		if _, err := url.Parse(u); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Client == nil {
+		options.Client = defaultGoogleCloudDNSZoneClient
+	}
+
+	if options.WatchInterval == 0 {
+		options.WatchInterval = defaultGoogleCloudDNSZoneWatchInterval
+	}
+
+	if options.WatchTimeout == 0 {
+		options.WatchTimeout = defaultGoogleCloudDNSZoneWatchTimeout
+	}
+
+	return &GoogleCloudDNSZone{options: options, credentials: credentials}, nil
+}
+
+func parseGoogleServiceAccount(data []byte) (*googleServiceAccount, error) {
+	sa := &googleServiceAccount{}
+	if err := json.Unmarshal(data, sa); err != nil {
+		return nil, err
+	}
+
+	if sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, ErrGoogleCloudDNSInvalidCredentials
+	}
+
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return nil, ErrGoogleCloudDNSInvalidCredentials
+	}
+
+	// service account keys are PKCS #8 encoded, older ones PKCS #1
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, err
+		}
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrGoogleCloudDNSInvalidCredentials
+	}
+	sa.key = rsaKey
+
+	return sa, nil
+}
+
+// UpdateA will set the A Record in the specified managed zone to point to the
+// provided IP address, creating the record if it does not exist.
+func (p *GoogleCloudDNSZone) UpdateA(recordName string, zoneName string, ip net.IP) error {
+	return p.UpdateAContext(context.Background(), recordName, zoneName, ip)
+}
+
+// UpdateAContext is like UpdateA but aborts the API requests and stops
+// waiting for the change to be applied when the context is cancelled.
+func (p *GoogleCloudDNSZone) UpdateAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error {
+	return p.updateRecord(ctx, recordName, zoneName, "A", ip)
+}
+
+// UpdateAAAA will set the AAAA Record in the specified managed zone to point
+// to the provided IPv6 address, creating the record if it does not exist.
+func (p *GoogleCloudDNSZone) UpdateAAAA(recordName string, zoneName string, ip net.IP) error {
+	return p.UpdateAAAAContext(context.Background(), recordName, zoneName, ip)
+}
+
+// UpdateAAAAContext is like UpdateAAAA but aborts the API requests and stops
+// waiting for the change to be applied when the context is cancelled.
+func (p *GoogleCloudDNSZone) UpdateAAAAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error {
+	return p.updateRecord(ctx, recordName, zoneName, "AAAA", ip)
+}
+
+// Nameservers returns the list of authoritative namservers for a DNS zone.
+func (p *GoogleCloudDNSZone) Nameservers(zoneName string) ([]string, error) {
+	return p.NameserversContext(context.Background(), zoneName)
+}
+
+// NameserversContext is like Nameservers but aborts the API requests when the
+// context is cancelled.
+func (p *GoogleCloudDNSZone) NameserversContext(ctx context.Context, zoneName string) ([]string, error) {
+	zone, err := p.getZone(ctx, zoneName)
+	if err != nil {
+		return nil, err
+	}
+
+	nameservers := make([]string, len(zone.NameServers))
+	for i, ns := range zone.NameServers {
+		nameservers[i] = strings.TrimSuffix(ns, ".")
+	}
+
+	return nameservers, nil
+}
+
+func (p *GoogleCloudDNSZone) updateRecord(ctx context.Context, recordName string, zoneName string, rrType string, ip net.IP) error {
+	zone, err := p.getZone(ctx, zoneName)
+	if err != nil {
+		return err
+	}
+
+	rrset := googleCloudDNSRRSet{
+		Name:    dns.Fqdn(recordName),
+		Type:    rrType,
+		TTL:     p.options.TTL,
+		RRDatas: []string{ip.String()},
+	}
+
+	zonePath := "/projects/" + p.options.Project + "/managedZones/" + zone.Name
+
+	existing := struct {
+		RRSets []googleCloudDNSRRSet `json:"rrsets"`
+	}{}
+	err = p.request(ctx, http.MethodGet, zonePath+"/rrsets", url.Values{
+		"name": {rrset.Name},
+		"type": {rrset.Type},
+	}, nil, &existing)
+	if err != nil {
+		return err
+	}
+
+	// Cloud DNS has no upsert, the existing record set has to be deleted in
+	// the same change as it is replaced
+	change := googleCloudDNSChange{
+		Additions: []googleCloudDNSRRSet{rrset},
+		Deletions: existing.RRSets,
+	}
+	if err := p.request(ctx, http.MethodPost, zonePath+"/changes", nil, change, &change); err != nil {
+		return err
+	}
+
+	return p.waitForChange(ctx, zonePath+"/changes/"+change.ID, change.Status)
+}
+
+func (p *GoogleCloudDNSZone) waitForChange(ctx context.Context, changePath string, status string) error {
+	if status == "done" {
+		return nil
+	}
+
+	timeout := time.NewTimer(p.options.WatchTimeout)
+	tick := time.NewTicker(p.options.WatchInterval)
+	defer func() {
+		timeout.Stop()
+		tick.Stop()
+	}()
+
+	for {
+		select {
+		case <-tick.C:
+			change := googleCloudDNSChange{}
+			if err := p.request(ctx, http.MethodGet, changePath, nil, nil, &change); err != nil {
+				// the context may end while polling, which the HTTP client
+				// reports wrapped in its own error
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return ctxErr
+				}
+				return err
+			}
+
+			if change.Status == "done" {
+				return nil
+			}
+		case <-timeout.C:
+			return ErrGoogleCloudDNSWatchTimedOut
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (p *GoogleCloudDNSZone) getZone(ctx context.Context, name string) (*googleCloudDNSManagedZone, error) {
+	name = dns.Fqdn(name)
+
+	zones := struct {
+		ManagedZones []googleCloudDNSManagedZone `json:"managedZones"`
+	}{}
+	err := p.request(ctx, http.MethodGet, "/projects/"+p.options.Project+"/managedZones", url.Values{"dnsName": {name}}, nil, &zones)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, zone := range zones.ManagedZones {
+		if strings.EqualFold(zone.DNSName, name) {
+			return &zones.ManagedZones[i], nil
+		}
+	}
+
+	return nil, ErrGoogleCloudDNSNoManagedZoneFound
+}
+
+func (p *GoogleCloudDNSZone) request(ctx context.Context, method string, path string, query url.Values, body interface{}, result interface{}) error {
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	u := p.options.APIURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	return p.do(req, result)
+}
+
+func (p *GoogleCloudDNSZone) do(req *http.Request, result interface{}) error {
+	resp, err := p.options.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		gErr := &GoogleCloudDNSError{StatusCode: resp.StatusCode}
+
+		// the APIs and the token endpoint report errors differently
+		response := struct {
+			Error            json.RawMessage `json:"error"`
+			ErrorDescription string          `json:"error_description"`
+		}{}
+		if json.NewDecoder(resp.Body).Decode(&response) == nil {
+			apiError := struct {
+				Message string `json:"message"`
+			}{}
+			if json.Unmarshal(response.Error, &apiError) == nil && apiError.Message != "" {
+				gErr.Message = apiError.Message
+			} else if response.ErrorDescription != "" {
+				gErr.Message = response.ErrorDescription
+			}
+		}
+
+		return gErr
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// accessToken returns an OAuth 2.0 access token for the service account,
+// requesting a new one using a signed JWT (RFC 7523) when the previous one is
+// about to expire.
+func (p *GoogleCloudDNSZone) accessToken(ctx context.Context) (string, error) {
+	p.tokenMutex.Lock()
+	defer p.tokenMutex.Unlock()
+
+	if p.token != "" && time.Now().Before(p.tokenExpiry) {
+		return p.token, nil
+	}
+
+	assertion, err := p.credentials.signJWT(p.options.TokenURL, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.options.TokenURL, strings.NewReader(url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}{}
+	if err := p.do(req, &token); err != nil {
+		return "", err
+	}
+
+	if token.AccessToken == "" {
+		return "", &GoogleCloudDNSError{StatusCode: http.StatusOK, Message: "no access token in the response"}
+	}
+
+	// renew the token a minute before it expires
+	p.token = token.AccessToken
+	p.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+
+	return p.token, nil
+}
+
+// signJWT returns a JWT asserting the identity of the service account to the
+// token endpoint, signed with its private key using RS256.
+func (sa *googleServiceAccount) signJWT(audience string, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": sa.PrivateKeyID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   sa.ClientEmail,
+		"scope": googleCloudDNSScope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, sa.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,403 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testGoogleServiceAccountKeyOnce sync.Once
+	testGoogleServiceAccountKey     *rsa.PrivateKey
+)
+
+// testGoogleCredentials returns the JSON key of a service account, generating
+// its private key once for all tests.
+func testGoogleCredentials(tokenURI string) []byte {
+	testGoogleServiceAccountKeyOnce.Do(func() {
+		testGoogleServiceAccountKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	})
+
+	b, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "test-project",
+		"private_key_id": "key-id",
+		"private_key": string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(testGoogleServiceAccountKey),
+		})),
+		"client_email": "odyn@test-project.iam.gserviceaccount.com",
+		"token_uri":    tokenURI,
+	})
+
+	return b
+}
+
+// mockGoogleCloudDNSAPI is a minimal in-memory stand-in for the Google OAuth
+// 2.0 token endpoint and the Cloud DNS v1 API, serving a single managed zone.
+type mockGoogleCloudDNSAPI struct {
+	sync.Mutex
+	url           string
+	zone          googleCloudDNSManagedZone
+	rrsets        map[string]googleCloudDNSRRSet
+	changes       map[string]*googleCloudDNSChange
+	tokenRequests int
+
+	// pendingPolls is the number of times a change is reported as pending
+	// before it is done, or forever if negative.
+	pendingPolls int
+	polls        int
+}
+
+func newMockGoogleCloudDNSAPI() *mockGoogleCloudDNSAPI {
+	return &mockGoogleCloudDNSAPI{
+		zone: googleCloudDNSManagedZone{
+			Name:        "example-com",
+			DNSName:     "example.com.",
+			NameServers: []string{"ns-cloud-a1.googledomains.com.", "ns-cloud-a2.googledomains.com."},
+		},
+		rrsets:       map[string]googleCloudDNSRRSet{},
+		changes:      map[string]*googleCloudDNSChange{},
+		pendingPolls: 1,
+	}
+}
+
+func (m *mockGoogleCloudDNSAPI) reply(w http.ResponseWriter, code int, result interface{}) {
+	if code != http.StatusOK {
+		result = map[string]interface{}{"error": map[string]interface{}{"code": code, "message": result}}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(result)
+}
+
+// token verifies the signed JWT and issues an access token.
+func (m *mockGoogleCloudDNSAPI) token(w http.ResponseWriter, r *http.Request) {
+	m.tokenRequests++
+
+	parts := strings.Split(r.PostFormValue("assertion"), ".")
+	if r.PostFormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || len(parts) != 3 {
+		m.reply(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&testGoogleServiceAccountKey.PublicKey, crypto.SHA256, hash[:], signature); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "Invalid JWT Signature."})
+		return
+	}
+
+	claims := map[string]interface{}{}
+	b, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	json.Unmarshal(b, &claims)
+	if claims["iss"] != "odyn@test-project.iam.gserviceaccount.com" || claims["aud"] != m.url+"/token" || claims["scope"] != googleCloudDNSScope {
+		m.reply(w, http.StatusBadRequest, "invalid claims")
+		return
+	}
+
+	m.reply(w, http.StatusOK, map[string]interface{}{
+		"access_token": "test-access-token",
+		"expires_in":   3600,
+		"token_type":   "Bearer",
+	})
+}
+
+func (m *mockGoogleCloudDNSAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	if r.URL.Path == "/token" && r.Method == http.MethodPost {
+		m.token(w, r)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer test-access-token" {
+		m.reply(w, http.StatusUnauthorized, "Request had invalid authentication credentials.")
+		return
+	}
+
+	zonesPath := "/projects/test-project/managedZones"
+	zonePath := zonesPath + "/" + m.zone.Name
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == zonesPath:
+		zones := []googleCloudDNSManagedZone{}
+		if r.URL.Query().Get("dnsName") == m.zone.DNSName {
+			zones = append(zones, m.zone)
+		}
+		m.reply(w, http.StatusOK, map[string]interface{}{"managedZones": zones})
+	case r.Method == http.MethodGet && r.URL.Path == zonePath+"/rrsets":
+		rrsets := []googleCloudDNSRRSet{}
+		if rrset, ok := m.rrsets[r.URL.Query().Get("name")+r.URL.Query().Get("type")]; ok {
+			rrsets = append(rrsets, rrset)
+		}
+		m.reply(w, http.StatusOK, map[string]interface{}{"rrsets": rrsets})
+	case r.Method == http.MethodPost && r.URL.Path == zonePath+"/changes":
+		change := &googleCloudDNSChange{}
+		json.NewDecoder(r.Body).Decode(change)
+
+		for _, rrset := range change.Deletions {
+			if existing, ok := m.rrsets[rrset.Name+rrset.Type]; !ok || existing.RRDatas[0] != rrset.RRDatas[0] {
+				m.reply(w, http.StatusPreconditionFailed, "The resource record set to delete does not match")
+				return
+			}
+		}
+		for _, rrset := range change.Additions {
+			if _, ok := m.rrsets[rrset.Name+rrset.Type]; ok && len(change.Deletions) == 0 {
+				m.reply(w, http.StatusConflict, "The resource record set already exists")
+				return
+			}
+		}
+
+		for _, rrset := range change.Deletions {
+			delete(m.rrsets, rrset.Name+rrset.Type)
+		}
+		for _, rrset := range change.Additions {
+			m.rrsets[rrset.Name+rrset.Type] = rrset
+		}
+
+		change.ID = strconv.Itoa(len(m.changes) + 1)
+		change.Status = "pending"
+		m.changes[change.ID] = change
+		m.reply(w, http.StatusOK, change)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, zonePath+"/changes/"):
+		change, ok := m.changes[strings.TrimPrefix(r.URL.Path, zonePath+"/changes/")]
+		if !ok {
+			m.reply(w, http.StatusNotFound, "The requested change was not found")
+			return
+		}
+
+		m.polls++
+		if m.pendingPolls >= 0 && m.polls > m.pendingPolls {
+			change.Status = "done"
+		}
+		m.reply(w, http.StatusOK, change)
+	default:
+		m.reply(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func setupTestGoogleCloudDNSZone(options *GoogleCloudDNSZoneOptions) (*GoogleCloudDNSZone, *mockGoogleCloudDNSAPI, func()) {
+	api := newMockGoogleCloudDNSAPI()
+	ts := httptest.NewServer(api)
+	api.url = ts.URL
+
+	if options.Credentials == nil {
+		options.Credentials = testGoogleCredentials(ts.URL + "/token")
+	}
+	options.APIURL = ts.URL
+	options.WatchInterval = 10 * time.Millisecond
+
+	p, _ := NewGoogleCloudDNSZoneWithOptions(options)
+	return p, api, ts.Close
+}
+
+func TestNewGoogleCloudDNSZone_noCredentials(t *testing.T) {
+	if _, err := NewGoogleCloudDNSZone(nil); err != ErrGoogleCloudDNSCredentialsAreRequired {
+		t.Errorf("NewGoogleCloudDNSZone returned unexpected error: %+v", err)
+	}
+}
+
+func TestNewGoogleCloudDNSZone_invalidCredentials(t *testing.T) {
+	for _, credentials := range []string{
+		`{"project_id": "test-project"}`,
+		`{"client_email": "odyn@example.com", "private_key": "not a key"}`,
+	} {
+		if _, err := NewGoogleCloudDNSZone([]byte(credentials)); err != ErrGoogleCloudDNSInvalidCredentials {
+			t.Errorf("NewGoogleCloudDNSZone returned unexpected error: %+v", err)
+		}
+	}
+}
+
+func TestNewGoogleCloudDNSZone_noProject(t *testing.T) {
+	credentials := map[string]string{}
+	json.Unmarshal(testGoogleCredentials(""), &credentials)
+	delete(credentials, "project_id")
+	b, _ := json.Marshal(credentials)
+
+	if _, err := NewGoogleCloudDNSZone(b); err != ErrGoogleCloudDNSProjectIsRequired {
+		t.Errorf("NewGoogleCloudDNSZone returned unexpected error: %+v", err)
+	}
+}
+
+func TestGoogleCloudDNSZone_defaults(t *testing.T) {
+	p, err := NewGoogleCloudDNSZone(testGoogleCredentials(""))
+	if err != nil {
+		t.Fatalf("NewGoogleCloudDNSZone returned unexpected error: %+v", err)
+	}
+
+	if p.options.Project != "test-project" {
+		t.Errorf("NewGoogleCloudDNSZone default Project is not what was expected: %+v", p.options.Project)
+	}
+
+	if p.options.TTL != defaultGoogleCloudDNSZoneRecordTTL {
+		t.Errorf("NewGoogleCloudDNSZone default TTL is not what was expected: %+v", p.options.TTL)
+	}
+
+	if p.options.APIURL != defaultGoogleCloudDNSZoneAPIURL {
+		t.Errorf("NewGoogleCloudDNSZone default APIURL is not what was expected: %+v", p.options.APIURL)
+	}
+
+	if p.options.TokenURL != defaultGoogleCloudDNSZoneTokenURL {
+		t.Errorf("NewGoogleCloudDNSZone default TokenURL is not what was expected: %+v", p.options.TokenURL)
+	}
+}
+
+func TestGoogleCloudDNSZone_UpdateA(t *testing.T) {
+	p, api, stop := setupTestGoogleCloudDNSZone(&GoogleCloudDNSZoneOptions{TTL: 120})
+	defer stop()
+
+	// creates the record
+	if err := p.UpdateA("test.example.com", "example.com.", net.ParseIP("1.1.1.1")); err != nil {
+		t.Fatalf("GoogleCloudDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	// replaces the existing record
+	if err := p.UpdateA("test.example.com", "example.com.", net.ParseIP("1.2.3.4")); err != nil {
+		t.Fatalf("GoogleCloudDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	rrset, ok := api.rrsets["test.example.com.A"]
+	if !ok || len(api.rrsets) != 1 {
+		t.Fatalf("GoogleCloudDNSZone.UpdateA did not store the record: %+v", api.rrsets)
+	}
+
+	if rrset.TTL != 120 || len(rrset.RRDatas) != 1 || rrset.RRDatas[0] != "1.2.3.4" {
+		t.Errorf("GoogleCloudDNSZone.UpdateA stored unexpected record: %+v", rrset)
+	}
+
+	if len(api.changes["2"].Deletions) != 1 || api.changes["2"].Deletions[0].RRDatas[0] != "1.1.1.1" {
+		t.Errorf("GoogleCloudDNSZone.UpdateA did not delete the existing record: %+v", api.changes["2"])
+	}
+
+	if api.tokenRequests != 1 {
+		t.Errorf("GoogleCloudDNSZone.UpdateA did not reuse the access token: %d requests", api.tokenRequests)
+	}
+}
+
+func TestGoogleCloudDNSZone_UpdateAAAA(t *testing.T) {
+	p, api, stop := setupTestGoogleCloudDNSZone(&GoogleCloudDNSZoneOptions{})
+	defer stop()
+
+	if err := p.UpdateAAAA("test.example.com.", "example.com", net.ParseIP("2001:db8::1")); err != nil {
+		t.Fatalf("GoogleCloudDNSZone.UpdateAAAA returned unexpected error: %+v", err)
+	}
+
+	rrset := api.rrsets["test.example.com.AAAA"]
+	if rrset.TTL != defaultGoogleCloudDNSZoneRecordTTL || len(rrset.RRDatas) != 1 || rrset.RRDatas[0] != "2001:db8::1" {
+		t.Errorf("GoogleCloudDNSZone.UpdateAAAA stored unexpected record: %+v", rrset)
+	}
+}
+
+func TestGoogleCloudDNSZone_UpdateA_noZone(t *testing.T) {
+	p, _, stop := setupTestGoogleCloudDNSZone(&GoogleCloudDNSZoneOptions{})
+	defer stop()
+
+	err := p.UpdateA("test.example.org.", "example.org.", net.ParseIP("1.1.1.1"))
+	if err != ErrGoogleCloudDNSNoManagedZoneFound {
+		t.Errorf("GoogleCloudDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+}
+
+func TestGoogleCloudDNSZone_UpdateA_badKey(t *testing.T) {
+	p, _, stop := setupTestGoogleCloudDNSZone(&GoogleCloudDNSZoneOptions{})
+	defer stop()
+
+	// sign the JWT with a key the token endpoint does not know
+	p.credentials.key, _ = rsa.GenerateKey(rand.Reader, 1024)
+
+	err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.1.1.1"))
+	gErr, ok := err.(*GoogleCloudDNSError)
+	if !ok {
+		t.Fatalf("GoogleCloudDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	if gErr.StatusCode != http.StatusBadRequest || gErr.Message != "Invalid JWT Signature." {
+		t.Errorf("GoogleCloudDNSZone.UpdateA returned unexpected error: %+v", gErr)
+	}
+}
+
+func TestGoogleCloudDNSZone_UpdateA_apiError(t *testing.T) {
+	p, _, stop := setupTestGoogleCloudDNSZone(&GoogleCloudDNSZoneOptions{Project: "other-project"})
+	defer stop()
+
+	err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.1.1.1"))
+	gErr, ok := err.(*GoogleCloudDNSError)
+	if !ok {
+		t.Fatalf("GoogleCloudDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	if gErr.StatusCode != http.StatusNotFound || gErr.Message != "Not found" {
+		t.Errorf("GoogleCloudDNSZone.UpdateA returned unexpected error: %+v", gErr)
+	}
+}
+
+func TestGoogleCloudDNSZone_UpdateA_watchTimeout(t *testing.T) {
+	p, api, stop := setupTestGoogleCloudDNSZone(&GoogleCloudDNSZoneOptions{WatchTimeout: 50 * time.Millisecond})
+	defer stop()
+	api.pendingPolls = -1
+
+	err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.1.1.1"))
+	if err != ErrGoogleCloudDNSWatchTimedOut {
+		t.Errorf("GoogleCloudDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+}
+
+func TestGoogleCloudDNSZone_UpdateAContext_cancelled(t *testing.T) {
+	p, api, stop := setupTestGoogleCloudDNSZone(&GoogleCloudDNSZoneOptions{})
+	defer stop()
+	api.pendingPolls = -1
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := p.UpdateAContext(ctx, "test.example.com.", "example.com.", net.ParseIP("1.1.1.1"))
+	if err != context.DeadlineExceeded {
+		t.Errorf("GoogleCloudDNSZone.UpdateAContext returned unexpected error: %+v", err)
+	}
+}
+
+func TestGoogleCloudDNSZone_Nameservers(t *testing.T) {
+	p, _, stop := setupTestGoogleCloudDNSZone(&GoogleCloudDNSZoneOptions{})
+	defer stop()
+
+	ns, err := p.Nameservers("example.com.")
+	if err != nil {
+		t.Fatalf("GoogleCloudDNSZone.Nameservers returned unexpected error: %+v", err)
+	}
+
+	if len(ns) != 2 || ns[0] != "ns-cloud-a1.googledomains.com" || ns[1] != "ns-cloud-a2.googledomains.com" {
+		t.Errorf("GoogleCloudDNSZone.Nameservers returned unexpected nameservers: %+v", ns)
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	// ErrPowerDNSAPIURLIsRequired is returned when trying to create a
+	// PowerDNSZone without the URL of the API.
+	ErrPowerDNSAPIURLIsRequired = errors.New("the APIURL option is required")
+
+	// ErrPowerDNSAPIKeyIsRequired is returned when trying to create a
+	// PowerDNSZone without an API key.
+	ErrPowerDNSAPIKeyIsRequired = errors.New("the APIKey option is required")
+
+	// ErrPowerDNSNoZoneFound is returned when the PowerDNS DNS Zone provider
+	// fails to find the zone on the server.
+	ErrPowerDNSNoZoneFound = errors.New("could not find a PowerDNS zone")
+
+	defaultPowerDNSZoneRecordTTL int64 = 60
+	defaultPowerDNSZoneServer          = "localhost"
+	defaultPowerDNSZoneClient          = &http.Client{}
+)
+
+// PowerDNSZone is a DNS Zone provider based on the HTTP API of the PowerDNS
+// Authoritative Server.
+type PowerDNSZone struct {
+	options *PowerDNSZoneOptions
+}
+
+// PowerDNSZoneOptions are used to alter the behaviour of the PowerDNS DNS
+// zone provider.
+type PowerDNSZoneOptions struct {
+	// Base URL of the PowerDNS API, e.g. http://ns1.example.com:8081.
+	APIURL string
+
+	// API key set in the api-key setting of the server.
+	APIKey string
+
+	// Server ID, which is always localhost unless the API is proxied.
+	Server string
+
+	// TTL of the records.
+	TTL int64
+
+	// Notify asks the server to send a DNS NOTIFY to the secondaries of the
+	// zone after a record is updated, for zones that are not configured to
+	// do so on their own.
+	Notify bool
+
+	// Rectify asks the server to rectify the zone after a record is updated,
+	// which DNSSEC signed zones without API-RECTIFY need.
+	Rectify bool
+
+	// HTTP Client used to send the API requests.
+	Client *http.Client
+}
+
+// PowerDNSError is returned when the PowerDNS API responds with an
+// unsuccessful status code.
+type PowerDNSError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *PowerDNSError) Error() string {
+	if e.Message == "" {
+		return "powerdns API request failed: " + http.StatusText(e.StatusCode)
+	}
+
+	return "powerdns API request failed: " + e.Message
+}
+
+type powerDNSRRSet struct {
+	Name       string           `json:"name"`
+	Type       string           `json:"type"`
+	TTL        int64            `json:"ttl,omitempty"`
+	ChangeType string           `json:"changetype,omitempty"`
+	Records    []powerDNSRecord `json:"records"`
+}
+
+type powerDNSRecord struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+// NewPowerDNSZone returns a new instantiated PowerDNS DNS zone provider with
+// default options, using the API at the given URL.
+func NewPowerDNSZone(apiURL string, apiKey string) (*PowerDNSZone, error) {
+	return NewPowerDNSZoneWithOptions(&PowerDNSZoneOptions{APIURL: apiURL, APIKey: apiKey})
+}
+
+// NewPowerDNSZoneWithOptions returns a new instantiated PowerDNS DNS zone
+// provider using the specified options.
+func NewPowerDNSZoneWithOptions(options *PowerDNSZoneOptions) (*PowerDNSZone, error) {
+	if options.APIURL == "" {
+		return nil, ErrPowerDNSAPIURLIsRequired
+	}
+
+	if _, err := url.Parse(options.APIURL); err != nil {
+		return nil, err
+	}
+	options.APIURL = strings.TrimSuffix(options.APIURL, "/")
+
+	if options.APIKey == "" {
+		return nil, ErrPowerDNSAPIKeyIsRequired
+	}
+
+	if options.Server == "" {
+		options.Server = defaultPowerDNSZoneServer
+	}
+
+	if options.TTL == 0 {
+		options.TTL = defaultPowerDNSZoneRecordTTL
+	}
+
+	if options.Client == nil {
+		options.Client = defaultPowerDNSZoneClient
+	}
+
+	return &PowerDNSZone{options: options}, nil
+}
+
+// UpdateA will set the A Record in the specified zone to point to the
+// provided IP address, creating the record if it does not exist.
+func (p *PowerDNSZone) UpdateA(recordName string, zoneName string, ip net.IP) error {
+	return p.UpdateAContext(context.Background(), recordName, zoneName, ip)
+}
+
+// UpdateAContext is like UpdateA but aborts the API requests when the context
+// is cancelled.
+func (p *PowerDNSZone) UpdateAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error {
+	return p.updateRecord(ctx, recordName, zoneName, "A", ip)
+}
+
+// UpdateAAAA will set the AAAA Record in the specified zone to point to the
+// provided IPv6 address, creating the record if it does not exist.
+func (p *PowerDNSZone) UpdateAAAA(recordName string, zoneName string, ip net.IP) error {
+	return p.UpdateAAAAContext(context.Background(), recordName, zoneName, ip)
+}
+
+// UpdateAAAAContext is like UpdateAAAA but aborts the API requests when the
+// context is cancelled.
+func (p *PowerDNSZone) UpdateAAAAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error {
+	return p.updateRecord(ctx, recordName, zoneName, "AAAA", ip)
+}
+
+// Nameservers returns the list of authoritative namservers for a DNS zone,
+// read from the NS records at its apex.
+func (p *PowerDNSZone) Nameservers(zoneName string) ([]string, error) {
+	return p.NameserversContext(context.Background(), zoneName)
+}
+
+// NameserversContext is like Nameservers but aborts the API requests when the
+// context is cancelled.
+func (p *PowerDNSZone) NameserversContext(ctx context.Context, zoneName string) ([]string, error) {
+	zoneName = dns.Fqdn(zoneName)
+
+	zone := struct {
+		RRSets []powerDNSRRSet `json:"rrsets"`
+	}{}
+	err := p.request(ctx, http.MethodGet, p.zonePath(zoneName), url.Values{
+		"rrset_name": {zoneName},
+		"rrset_type": {"NS"},
+	}, nil, &zone)
+	if pErr, ok := err.(*PowerDNSError); ok && pErr.StatusCode == http.StatusNotFound {
+		return nil, ErrPowerDNSNoZoneFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var nameservers []string
+	for _, rrset := range zone.RRSets {
+		// older servers ignore the filters
+		if rrset.Type != "NS" || !strings.EqualFold(rrset.Name, zoneName) {
+			continue
+		}
+
+		for _, r := range rrset.Records {
+			if !r.Disabled {
+				nameservers = append(nameservers, strings.TrimSuffix(r.Content, "."))
+			}
+		}
+	}
+
+	return nameservers, nil
+}
+
+func (p *PowerDNSZone) zonePath(zoneName string) string {
+	return "/api/v1/servers/" + p.options.Server + "/zones/" + dns.Fqdn(zoneName)
+}
+
+func (p *PowerDNSZone) updateRecord(ctx context.Context, recordName string, zoneName string, rrType string, ip net.IP) error {
+	path := p.zonePath(zoneName)
+
+	patch := struct {
+		RRSets []powerDNSRRSet `json:"rrsets"`
+	}{
+		RRSets: []powerDNSRRSet{{
+			Name:       dns.Fqdn(recordName),
+			Type:       rrType,
+			TTL:        p.options.TTL,
+			ChangeType: "REPLACE",
+			Records:    []powerDNSRecord{{Content: ip.String()}},
+		}},
+	}
+
+	err := p.request(ctx, http.MethodPatch, path, nil, patch, nil)
+	if pErr, ok := err.(*PowerDNSError); ok && pErr.StatusCode == http.StatusNotFound {
+		return ErrPowerDNSNoZoneFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if p.options.Rectify {
+		if err := p.request(ctx, http.MethodPut, path+"/rectify", nil, nil, nil); err != nil {
+			return err
+		}
+	}
+
+	if p.options.Notify {
+		return p.request(ctx, http.MethodPut, path+"/notify", nil, nil, nil)
+	}
+
+	return nil
+}
+
+func (p *PowerDNSZone) request(ctx context.Context, method string, path string, query url.Values, body interface{}, result interface{}) error {
+	u := p.options.APIURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-API-Key", p.options.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.options.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		response := struct {
+			Error string `json:"error"`
+		}{}
+		json.NewDecoder(resp.Body).Decode(&response)
+		return &PowerDNSError{StatusCode: resp.StatusCode, Message: response.Error}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
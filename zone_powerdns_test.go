@@ -0,0 +1,268 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// mockPowerDNSAPI is a minimal in-memory stand-in for the PowerDNS
+// Authoritative Server HTTP API, serving a single zone.
+type mockPowerDNSAPI struct {
+	sync.Mutex
+	apiKey   string
+	zone     string
+	rrsets   map[string]powerDNSRRSet
+	notifies int
+	rectifys int
+}
+
+func newMockPowerDNSAPI() *mockPowerDNSAPI {
+	return &mockPowerDNSAPI{
+		apiKey: "test-key",
+		zone:   "example.com.",
+		rrsets: map[string]powerDNSRRSet{
+			"example.com./NS": {
+				Name: "example.com.",
+				Type: "NS",
+				TTL:  3600,
+				Records: []powerDNSRecord{
+					{Content: "ns1.example.com."},
+					{Content: "ns2.example.com."},
+					{Content: "ns3.example.com.", Disabled: true},
+				},
+			},
+			"www.example.com./NS": {
+				Name:    "www.example.com.",
+				Type:    "NS",
+				TTL:     3600,
+				Records: []powerDNSRecord{{Content: "ns.example.org."}},
+			},
+		},
+	}
+}
+
+func (m *mockPowerDNSAPI) reply(w http.ResponseWriter, code int, result interface{}) {
+	if code >= 400 {
+		result = map[string]interface{}{"error": result}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if result != nil {
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+func (m *mockPowerDNSAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	if r.Header.Get("X-API-Key") != m.apiKey {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+
+	zonesPath := "/api/v1/servers/localhost/zones/"
+	if !strings.HasPrefix(r.URL.Path, zonesPath) {
+		m.reply(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, zonesPath), "/", 2)
+	if parts[0] != m.zone {
+		m.reply(w, http.StatusNotFound, "Could not find domain '"+parts[0]+"'")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		// the filters are ignored, like older servers do
+		rrsets := []powerDNSRRSet{}
+		for _, rrset := range m.rrsets {
+			rrsets = append(rrsets, rrset)
+		}
+		m.reply(w, http.StatusOK, map[string]interface{}{"name": m.zone, "kind": "Native", "rrsets": rrsets})
+	case len(parts) == 1 && r.Method == http.MethodPatch:
+		patch := struct {
+			RRSets []powerDNSRRSet `json:"rrsets"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&patch)
+
+		for _, rrset := range patch.RRSets {
+			if !strings.HasSuffix(rrset.Name, "."+m.zone) && rrset.Name != m.zone {
+				m.reply(w, http.StatusUnprocessableEntity, "RRset "+rrset.Name+" IN "+rrset.Type+": Name is out of zone")
+				return
+			}
+			if rrset.ChangeType != "REPLACE" {
+				m.reply(w, http.StatusUnprocessableEntity, "Changetype not understood")
+				return
+			}
+			rrset.ChangeType = ""
+			m.rrsets[rrset.Name+"/"+rrset.Type] = rrset
+		}
+		m.reply(w, http.StatusNoContent, nil)
+	case len(parts) == 2 && parts[1] == "notify" && r.Method == http.MethodPut:
+		m.notifies++
+		m.reply(w, http.StatusOK, map[string]string{"result": "Notification queued"})
+	case len(parts) == 2 && parts[1] == "rectify" && r.Method == http.MethodPut:
+		m.rectifys++
+		m.reply(w, http.StatusOK, map[string]string{"result": "Rectified"})
+	default:
+		m.reply(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func setupTestPowerDNSZone(options *PowerDNSZoneOptions) (*PowerDNSZone, *mockPowerDNSAPI, func()) {
+	api := newMockPowerDNSAPI()
+	ts := httptest.NewServer(api)
+
+	if options.APIKey == "" {
+		options.APIKey = api.apiKey
+	}
+	options.APIURL = ts.URL + "/"
+
+	p, _ := NewPowerDNSZoneWithOptions(options)
+	return p, api, ts.Close
+}
+
+func TestNewPowerDNSZone_required(t *testing.T) {
+	if _, err := NewPowerDNSZone("", "key"); err != ErrPowerDNSAPIURLIsRequired {
+		t.Errorf("NewPowerDNSZone returned unexpected error: %+v", err)
+	}
+
+	if _, err := NewPowerDNSZone("http://127.0.0.1:8081", ""); err != ErrPowerDNSAPIKeyIsRequired {
+		t.Errorf("NewPowerDNSZone returned unexpected error: %+v", err)
+	}
+}
+
+func TestPowerDNSZone_defaults(t *testing.T) {
+	p, _ := NewPowerDNSZone("http://127.0.0.1:8081", "key")
+
+	if p.options.TTL != defaultPowerDNSZoneRecordTTL {
+		t.Errorf("NewPowerDNSZone default TTL is not what was expected: %+v", p.options.TTL)
+	}
+
+	if p.options.Server != defaultPowerDNSZoneServer {
+		t.Errorf("NewPowerDNSZone default Server is not what was expected: %+v", p.options.Server)
+	}
+}
+
+func TestPowerDNSZone_UpdateA(t *testing.T) {
+	p, api, stop := setupTestPowerDNSZone(&PowerDNSZoneOptions{TTL: 120})
+	defer stop()
+
+	for _, ip := range []string{"1.1.1.1", "1.2.3.4"} {
+		if err := p.UpdateA("test.example.com", "example.com", net.ParseIP(ip)); err != nil {
+			t.Fatalf("PowerDNSZone.UpdateA returned unexpected error: %+v", err)
+		}
+	}
+
+	rrset, ok := api.rrsets["test.example.com./A"]
+	if !ok {
+		t.Fatalf("PowerDNSZone.UpdateA did not store the record: %+v", api.rrsets)
+	}
+
+	if rrset.TTL != 120 || len(rrset.Records) != 1 || rrset.Records[0].Content != "1.2.3.4" || rrset.Records[0].Disabled {
+		t.Errorf("PowerDNSZone.UpdateA stored unexpected record: %+v", rrset)
+	}
+
+	if api.notifies != 0 || api.rectifys != 0 {
+		t.Errorf("PowerDNSZone.UpdateA unexpectedly notified (%d) or rectified (%d) the zone", api.notifies, api.rectifys)
+	}
+}
+
+func TestPowerDNSZone_UpdateAAAA_notifyRectify(t *testing.T) {
+	p, api, stop := setupTestPowerDNSZone(&PowerDNSZoneOptions{Notify: true, Rectify: true})
+	defer stop()
+
+	if err := p.UpdateAAAA("test.example.com.", "example.com.", net.ParseIP("2001:db8::1")); err != nil {
+		t.Fatalf("PowerDNSZone.UpdateAAAA returned unexpected error: %+v", err)
+	}
+
+	rrset := api.rrsets["test.example.com./AAAA"]
+	if rrset.TTL != defaultPowerDNSZoneRecordTTL || len(rrset.Records) != 1 || rrset.Records[0].Content != "2001:db8::1" {
+		t.Errorf("PowerDNSZone.UpdateAAAA stored unexpected record: %+v", rrset)
+	}
+
+	if api.notifies != 1 || api.rectifys != 1 {
+		t.Errorf("PowerDNSZone.UpdateAAAA notified %d and rectified %d times", api.notifies, api.rectifys)
+	}
+}
+
+func TestPowerDNSZone_UpdateA_noZone(t *testing.T) {
+	p, _, stop := setupTestPowerDNSZone(&PowerDNSZoneOptions{})
+	defer stop()
+
+	err := p.UpdateA("test.example.org.", "example.org.", net.ParseIP("1.1.1.1"))
+	if err != ErrPowerDNSNoZoneFound {
+		t.Errorf("PowerDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+}
+
+func TestPowerDNSZone_UpdateA_outOfZone(t *testing.T) {
+	p, _, stop := setupTestPowerDNSZone(&PowerDNSZoneOptions{})
+	defer stop()
+
+	err := p.UpdateA("test.example.org.", "example.com.", net.ParseIP("1.1.1.1"))
+	pErr, ok := err.(*PowerDNSError)
+	if !ok {
+		t.Fatalf("PowerDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	if pErr.StatusCode != http.StatusUnprocessableEntity || pErr.Message != "RRset test.example.org. IN A: Name is out of zone" {
+		t.Errorf("PowerDNSZone.UpdateA returned unexpected error: %+v", pErr)
+	}
+}
+
+func TestPowerDNSZone_UpdateA_badKey(t *testing.T) {
+	p, _, stop := setupTestPowerDNSZone(&PowerDNSZoneOptions{APIKey: "wrong"})
+	defer stop()
+
+	err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.1.1.1"))
+	pErr, ok := err.(*PowerDNSError)
+	if !ok {
+		t.Fatalf("PowerDNSZone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	if pErr.StatusCode != http.StatusUnauthorized || pErr.Error() != "powerdns API request failed: Unauthorized" {
+		t.Errorf("PowerDNSZone.UpdateA returned unexpected error: %+v", pErr)
+	}
+}
+
+func TestPowerDNSZone_Nameservers(t *testing.T) {
+	p, _, stop := setupTestPowerDNSZone(&PowerDNSZoneOptions{})
+	defer stop()
+
+	ns, err := p.Nameservers("example.com.")
+	if err != nil {
+		t.Fatalf("PowerDNSZone.Nameservers returned unexpected error: %+v", err)
+	}
+
+	if len(ns) != 2 || ns[0] != "ns1.example.com" || ns[1] != "ns2.example.com" {
+		t.Errorf("PowerDNSZone.Nameservers returned unexpected nameservers: %+v", ns)
+	}
+
+	if _, err := p.Nameservers("example.org."); err != ErrPowerDNSNoZoneFound {
+		t.Errorf("PowerDNSZone.Nameservers returned unexpected error: %+v", err)
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	// ErrRFC2136ServerIsRequired is returned when trying to create an
+	// RFC2136Zone without a primary server.
+	ErrRFC2136ServerIsRequired = errors.New("the Server option is required")
+
+	// ErrRFC2136TSIGSecretIsRequired is returned when trying to create an
+	// RFC2136Zone with a TSIG key name but no secret.
+	ErrRFC2136TSIGSecretIsRequired = errors.New("the TSIGSecret option is required when TSIGKeyName is set")
+
+	// ErrRFC2136NotIPv4 is returned when trying to set an A record to an
+	// address that is not IPv4.
+	ErrRFC2136NotIPv4 = errors.New("the address is not an IPv4 address")
+
+	// ErrRFC2136NotIPv6 is returned when trying to set an AAAA record to an
+	// address that is not IPv6.
+	ErrRFC2136NotIPv6 = errors.New("the address is not an IPv6 address")
+
+	defaultRFC2136ZoneRecordTTL     int64 = 60
+	defaultRFC2136ZoneTSIGAlgorithm       = dns.HmacSHA256
+	defaultRFC2136ZoneTSIGFudge           = uint16(300)
+)
+
+// RFC2136Error is returned when the primary server refuses a dynamic update.
+type RFC2136Error struct {
+	Rcode int
+}
+
+func (e *RFC2136Error) Error() string {
+	return "dynamic update failed: " + dns.RcodeToString[e.Rcode]
+}
+
+// RFC2136Zone is a DNS Zone provider that uses RFC 2136 dynamic updates,
+// optionally signed with TSIG, to update the records on a primary nameserver.
+// It works with BIND, Knot, PowerDNS and any other nameserver that accepts
+// dynamic updates.
+type RFC2136Zone struct {
+	dns     *DNSClient
+	options *RFC2136ZoneOptions
+}
+
+// RFC2136ZoneOptions are used to alter the behaviour of the RFC 2136 DNS zone
+// provider.
+type RFC2136ZoneOptions struct {
+	// Address (host:port) of the primary nameserver to send the updates to.
+	Server string
+
+	// Name of the TSIG key used to sign the updates. Updates are not signed
+	// if it is empty.
+	TSIGKeyName string
+
+	// Base64 encoded TSIG secret.
+	TSIGSecret string
+
+	// TSIG algorithm, e.g. hmac-sha256 (default), hmac-sha512 or hmac-md5.
+	TSIGAlgorithm string
+
+	// TTL of the records.
+	TTL int64
+
+	// Nameservers (host:port) to query for the zone's NS records. Defaults
+	// to the primary server.
+	Resolvers []string
+
+	// Network to send the updates over, "udp" (default) or "tcp".
+	Net string
+}
+
+// NewRFC2136Zone returns a new instantiated RFC 2136 DNS zone provider that
+// sends unsigned updates to the primary server.
+func NewRFC2136Zone(server string) (*RFC2136Zone, error) {
+	return NewRFC2136ZoneWithOptions(&RFC2136ZoneOptions{Server: server})
+}
+
+// NewRFC2136ZoneWithOptions returns a new instantiated RFC 2136 DNS zone
+// provider using the specified options.
+func NewRFC2136ZoneWithOptions(options *RFC2136ZoneOptions) (*RFC2136Zone, error) {
+	if options.Server == "" {
+		return nil, ErrRFC2136ServerIsRequired
+	}
+
+	if options.TSIGKeyName != "" && options.TSIGSecret == "" {
+		return nil, ErrRFC2136TSIGSecretIsRequired
+	}
+
+	if options.TSIGAlgorithm == "" {
+		options.TSIGAlgorithm = defaultRFC2136ZoneTSIGAlgorithm
+	}
+	options.TSIGAlgorithm = dns.Fqdn(strings.ToLower(options.TSIGAlgorithm))
+
+	if options.TTL == 0 {
+		options.TTL = defaultRFC2136ZoneRecordTTL
+	}
+
+	if len(options.Resolvers) == 0 {
+		options.Resolvers = []string{options.Server}
+	}
+
+	c := NewDNSClient()
+	c.Net = options.Net
+	if options.TSIGKeyName != "" {
+		options.TSIGKeyName = dns.Fqdn(strings.ToLower(options.TSIGKeyName))
+		c.TsigSecret = map[string]string{options.TSIGKeyName: options.TSIGSecret}
+	}
+
+	return &RFC2136Zone{dns: c, options: options}, nil
+}
+
+// UpdateA will replace the A records of the specified name with a single
+// record pointing to the provided IP address.
+func (p *RFC2136Zone) UpdateA(recordName string, zoneName string, ip net.IP) error {
+	return p.UpdateAContext(context.Background(), recordName, zoneName, ip)
+}
+
+// UpdateAContext is like UpdateA but aborts the update when the context is
+// cancelled.
+func (p *RFC2136Zone) UpdateAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error {
+	if ip.To4() == nil {
+		return ErrRFC2136NotIPv4
+	}
+
+	return p.updateRecord(ctx, recordName, zoneName, &dns.A{
+		Hdr: p.header(recordName, dns.TypeA),
+		A:   ip.To4(),
+	})
+}
+
+// UpdateAAAA will replace the AAAA records of the specified name with a single
+// record pointing to the provided IPv6 address.
+func (p *RFC2136Zone) UpdateAAAA(recordName string, zoneName string, ip net.IP) error {
+	return p.UpdateAAAAContext(context.Background(), recordName, zoneName, ip)
+}
+
+// UpdateAAAAContext is like UpdateAAAA but aborts the update when the context
+// is cancelled.
+func (p *RFC2136Zone) UpdateAAAAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error {
+	if ip.To4() != nil || ip.To16() == nil {
+		return ErrRFC2136NotIPv6
+	}
+
+	return p.updateRecord(ctx, recordName, zoneName, &dns.AAAA{
+		Hdr:  p.header(recordName, dns.TypeAAAA),
+		AAAA: ip,
+	})
+}
+
+// Nameservers returns the list of authoritative namservers for a DNS zone, as
+// found in its NS records.
+func (p *RFC2136Zone) Nameservers(zoneName string) ([]string, error) {
+	return p.NameserversContext(context.Background(), zoneName)
+}
+
+// NameserversContext is like Nameservers but aborts the NS query when the
+// context is cancelled.
+func (p *RFC2136Zone) NameserversContext(ctx context.Context, zoneName string) ([]string, error) {
+	return p.dns.ResolveNSContext(ctx, dns.Fqdn(zoneName), p.options.Resolvers)
+}
+
+func (p *RFC2136Zone) header(recordName string, rrType uint16) dns.RR_Header {
+	return dns.RR_Header{
+		Name:   dns.Fqdn(recordName),
+		Rrtype: rrType,
+		Class:  dns.ClassINET,
+		Ttl:    uint32(p.options.TTL),
+	}
+}
+
+func (p *RFC2136Zone) updateRecord(ctx context.Context, recordName string, zoneName string, rr dns.RR) error {
+	m := &dns.Msg{}
+	m.SetUpdate(dns.Fqdn(zoneName))
+	m.RemoveRRset([]dns.RR{rr})
+	m.Insert([]dns.RR{rr})
+
+	if p.options.TSIGKeyName != "" {
+		m.SetTsig(p.options.TSIGKeyName, p.options.TSIGAlgorithm, defaultRFC2136ZoneTSIGFudge, time.Now().Unix())
+	}
+
+	r, _, err := p.dns.ExchangeContext(ctx, m, p.options.Server)
+	if err != nil {
+		return err
+	}
+
+	if r.Rcode != dns.RcodeSuccess {
+		return &RFC2136Error{Rcode: r.Rcode}
+	}
+
+	return nil
+}
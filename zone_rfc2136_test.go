@@ -0,0 +1,300 @@
+// Copyright 2016 Dimitrios Karagiannis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package odyn
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	testRFC2136KeyName = "odyn-key."
+	testRFC2136Secret  = "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0LXNlY3JldA=="
+)
+
+// mockRFC2136Server accepts dynamic updates for example.com., requiring them
+// to be signed with the test TSIG key, and answers NS queries for the zone.
+type mockRFC2136Server struct {
+	sync.Mutex
+	updates []*dns.Msg
+}
+
+func (s *mockRFC2136Server) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+
+	switch {
+	case req.Opcode == dns.OpcodeUpdate:
+		if req.IsTsig() == nil || w.TsigStatus() != nil {
+			m.Rcode = dns.RcodeRefused
+			break
+		}
+
+		if req.Question[0].Name != "example.com." {
+			m.Rcode = dns.RcodeNotZone
+			break
+		}
+
+		// the server keeps using the request after the handler returns
+		s.Lock()
+		s.updates = append(s.updates, req.Copy())
+		s.Unlock()
+	case req.Question[0].Qtype == dns.TypeNS:
+		for _, ns := range []string{"ns1.example.com.", "ns2.example.com."} {
+			m.Answer = append(m.Answer, &dns.NS{
+				Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeNS, Class: dns.ClassINET},
+				Ns:  ns,
+			})
+		}
+	}
+
+	if tsig := req.IsTsig(); tsig != nil && w.TsigStatus() == nil {
+		m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+	}
+
+	w.WriteMsg(m)
+}
+
+// received returns the updates received so far.
+func (s *mockRFC2136Server) received() []*dns.Msg {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.updates
+}
+
+func startMockRFC2136Server() (*dns.Server, *mockRFC2136Server, string, error) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	server, handler := newMockRFC2136Server()
+	server.PacketConn = pc
+
+	waitLock := sync.Mutex{}
+	waitLock.Lock()
+	server.NotifyStartedFunc = waitLock.Unlock
+
+	go func() {
+		server.ActivateAndServe()
+		pc.Close()
+	}()
+
+	waitLock.Lock()
+	return server, handler, pc.LocalAddr().String(), nil
+}
+
+// startMockRFC2136TCPServer is like startMockRFC2136Server but only listens
+// on TCP.
+func startMockRFC2136TCPServer() (*dns.Server, *mockRFC2136Server, string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	server, handler := newMockRFC2136Server()
+	server.Listener = l
+	server.Net = "tcp"
+
+	waitLock := sync.Mutex{}
+	waitLock.Lock()
+	server.NotifyStartedFunc = waitLock.Unlock
+
+	go server.ActivateAndServe()
+
+	waitLock.Lock()
+	return server, handler, l.Addr().String(), nil
+}
+
+func newMockRFC2136Server() (*dns.Server, *mockRFC2136Server) {
+	handler := &mockRFC2136Server{}
+	server := &dns.Server{
+		Handler:    handler,
+		TsigSecret: map[string]string{testRFC2136KeyName: testRFC2136Secret},
+		MsgAcceptFunc: func(dh dns.Header) dns.MsgAcceptAction {
+			if int(dh.Bits>>11)&0xF == dns.OpcodeUpdate {
+				return dns.MsgAccept
+			}
+			return dns.DefaultMsgAcceptFunc(dh)
+		},
+	}
+
+	return server, handler
+}
+
+func TestNewRFC2136Zone_errors(t *testing.T) {
+	if _, err := NewRFC2136Zone(""); err != ErrRFC2136ServerIsRequired {
+		t.Errorf("NewRFC2136Zone returned unexpected error: %+v", err)
+	}
+
+	_, err := NewRFC2136ZoneWithOptions(&RFC2136ZoneOptions{Server: "127.0.0.1:53", TSIGKeyName: "key"})
+	if err != ErrRFC2136TSIGSecretIsRequired {
+		t.Errorf("NewRFC2136ZoneWithOptions returned unexpected error: %+v", err)
+	}
+}
+
+func TestRFC2136Zone_UpdateA(t *testing.T) {
+	server, handler, addr, err := startMockRFC2136Server()
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	p, _ := NewRFC2136ZoneWithOptions(&RFC2136ZoneOptions{
+		Server:      addr,
+		TSIGKeyName: "odyn-key",
+		TSIGSecret:  testRFC2136Secret,
+		TTL:         120,
+	})
+
+	if err := p.UpdateA("test.example.com", "example.com.", net.ParseIP("1.2.3.4")); err != nil {
+		t.Fatalf("RFC2136Zone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	updates := handler.received()
+	if len(updates) != 1 {
+		t.Fatalf("RFC2136Zone.UpdateA sent %d updates", len(updates))
+	}
+
+	ns := updates[0].Ns
+	if len(ns) != 2 {
+		t.Fatalf("RFC2136Zone.UpdateA sent unexpected update section: %+v", ns)
+	}
+
+	if ns[0].Header().Class != dns.ClassANY || ns[0].Header().Rrtype != dns.TypeA {
+		t.Errorf("RFC2136Zone.UpdateA did not remove the existing rrset: %+v", ns[0])
+	}
+
+	a, ok := ns[1].(*dns.A)
+	if !ok || a.Hdr.Name != "test.example.com." || a.Hdr.Ttl != 120 || !a.A.Equal(net.ParseIP("1.2.3.4")) {
+		t.Errorf("RFC2136Zone.UpdateA sent unexpected record: %+v", ns[1])
+	}
+}
+
+func TestRFC2136Zone_tcp(t *testing.T) {
+	server, handler, addr, err := startMockRFC2136TCPServer()
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	p, _ := NewRFC2136ZoneWithOptions(&RFC2136ZoneOptions{
+		Server:      addr,
+		Net:         "tcp",
+		TSIGKeyName: "odyn-key",
+		TSIGSecret:  testRFC2136Secret,
+	})
+
+	if err := p.UpdateA("test.example.com", "example.com.", net.ParseIP("1.2.3.4")); err != nil {
+		t.Fatalf("RFC2136Zone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	if updates := handler.received(); len(updates) != 1 {
+		t.Errorf("RFC2136Zone.UpdateA sent %d updates", len(updates))
+	}
+
+	// the nameservers are looked up with the same network as the updates
+	ns, err := p.Nameservers("example.com.")
+	if err != nil || len(ns) != 2 {
+		t.Errorf("RFC2136Zone.Nameservers returned unexpected result: %+v, %+v", ns, err)
+	}
+}
+
+func TestRFC2136Zone_UpdateAAAA(t *testing.T) {
+	server, handler, addr, err := startMockRFC2136Server()
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	p, _ := NewRFC2136ZoneWithOptions(&RFC2136ZoneOptions{
+		Server:        addr,
+		TSIGKeyName:   testRFC2136KeyName,
+		TSIGSecret:    testRFC2136Secret,
+		TSIGAlgorithm: "hmac-sha256",
+	})
+
+	if err := p.UpdateAAAA("test.example.com.", "example.com.", net.ParseIP("2001:db8::1")); err != nil {
+		t.Fatalf("RFC2136Zone.UpdateAAAA returned unexpected error: %+v", err)
+	}
+
+	ns := handler.received()[0].Ns
+	aaaa, ok := ns[1].(*dns.AAAA)
+	if !ok || !aaaa.AAAA.Equal(net.ParseIP("2001:db8::1")) {
+		t.Errorf("RFC2136Zone.UpdateAAAA sent unexpected record: %+v", ns[1])
+	}
+}
+
+func TestRFC2136Zone_wrongFamily(t *testing.T) {
+	server, handler, addr, err := startMockRFC2136Server()
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	p, _ := NewRFC2136Zone(addr)
+
+	if err := p.UpdateA("test.example.com.", "example.com.", net.ParseIP("2001:db8::1")); err != ErrRFC2136NotIPv4 {
+		t.Errorf("RFC2136Zone.UpdateA returned unexpected error: %+v", err)
+	}
+
+	for _, ip := range []string{"1.2.3.4", "::ffff:1.2.3.4"} {
+		if err := p.UpdateAAAA("test.example.com.", "example.com.", net.ParseIP(ip)); err != ErrRFC2136NotIPv6 {
+			t.Errorf("RFC2136Zone.UpdateAAAA(%s) returned unexpected error: %+v", ip, err)
+		}
+	}
+
+	if len(handler.received()) != 0 {
+		t.Error("RFC2136Zone sent an update for an address of the wrong family")
+	}
+}
+
+func TestRFC2136Zone_UpdateA_refused(t *testing.T) {
+	server, _, addr, err := startMockRFC2136Server()
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	// unsigned updates are refused
+	p, _ := NewRFC2136Zone(addr)
+	err = p.UpdateA("test.example.com.", "example.com.", net.ParseIP("1.2.3.4"))
+	if rErr, ok := err.(*RFC2136Error); !ok || rErr.Rcode != dns.RcodeRefused {
+		t.Errorf("RFC2136Zone.UpdateA returned unexpected error: %+v", err)
+	}
+}
+
+func TestRFC2136Zone_Nameservers(t *testing.T) {
+	server, _, addr, err := startMockRFC2136Server()
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	p, _ := NewRFC2136Zone(addr)
+	ns, err := p.Nameservers("example.com.")
+	if err != nil {
+		t.Fatalf("RFC2136Zone.Nameservers returned unexpected error: %+v", err)
+	}
+
+	if len(ns) != 2 || ns[0] != "ns1.example.com" || ns[1] != "ns2.example.com" {
+		t.Errorf("RFC2136Zone.Nameservers returned unexpected nameservers: %+v", ns)
+	}
+}
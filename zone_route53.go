@@ -15,6 +15,7 @@
 package odyn
 
 import (
+	"context"
 	"errors"
 	"net"
 	"time"
@@ -34,6 +35,14 @@ var (
 	// out waiting to confirm that the change has been applied.
 	ErrRoute53WatchTimedOut = errors.New("timed out")
 
+	// ErrRoute53NotIPv4 is returned when trying to set an A record to an
+	// address that is not IPv4.
+	ErrRoute53NotIPv4 = errors.New("the address is not an IPv4 address")
+
+	// ErrRoute53NotIPv6 is returned when trying to set an AAAA record to an
+	// address that is not IPv6.
+	ErrRoute53NotIPv6 = errors.New("the address is not an IPv6 address")
+
 	defaultRoute53ZoneRecordTTL     int64 = 60
 	defaultRoute53ZoneWatchInterval       = 10 * time.Second
 	defaultRoute53ZoneWatchTimeout        = 2 * time.Minute
@@ -55,6 +64,11 @@ type Route53ZoneOptions struct {
 	API            route53iface.Route53API
 	WatchInterval  time.Duration
 	WatchTimeout   time.Duration
+
+	// WatchCallback, if set, is called once the provider stops waiting for
+	// a change to be applied, with the time spent waiting and the reason it
+	// stopped, if any.
+	WatchCallback func(wait time.Duration, err error)
 }
 
 // NewRoute53Zone returns a new instantiated Route53 DNS zone provider with
@@ -93,23 +107,63 @@ func NewRoute53ZoneWithOptions(options *Route53ZoneOptions) (*Route53Zone, error
 // UpdateA will set the Route53 A Record in the specified zone to point to the
 // provided IP address.
 func (p *Route53Zone) UpdateA(recordName string, zoneName string, ip net.IP) error {
-	if err := p.updateZone(zoneName); err != nil {
+	return p.UpdateAContext(context.Background(), recordName, zoneName, ip)
+}
+
+// UpdateAContext is like UpdateA but stops waiting for the change to be
+// applied when the context is cancelled.
+func (p *Route53Zone) UpdateAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error {
+	if ip.To4() == nil {
+		return ErrRoute53NotIPv4
+	}
+
+	if err := p.updateZone(ctx, zoneName); err != nil {
+		return err
+	}
+
+	return p.updateRecord(ctx, recordName, p.id, route53.RRTypeA, ip)
+}
+
+// UpdateAAAA will set the Route53 AAAA Record in the specified zone to point
+// to the provided IPv6 address.
+func (p *Route53Zone) UpdateAAAA(recordName string, zoneName string, ip net.IP) error {
+	return p.UpdateAAAAContext(context.Background(), recordName, zoneName, ip)
+}
+
+// UpdateAAAAContext is like UpdateAAAA but stops waiting for the change to be
+// applied when the context is cancelled.
+func (p *Route53Zone) UpdateAAAAContext(ctx context.Context, recordName string, zoneName string, ip net.IP) error {
+	if ip.To4() != nil || ip.To16() == nil {
+		return ErrRoute53NotIPv6
+	}
+
+	if err := p.updateZone(ctx, zoneName); err != nil {
 		return err
 	}
 
-	return p.updateRecord(recordName, p.id, ip)
+	return p.updateRecord(ctx, recordName, p.id, route53.RRTypeAaaa, ip)
 }
 
 // Nameservers returns the list of authoritative namservers for a DNS zone.
 func (p *Route53Zone) Nameservers(zoneName string) ([]string, error) {
-	if err := p.updateZone(zoneName); err != nil {
+	return p.NameserversContext(context.Background(), zoneName)
+}
+
+// NameserversContext is like Nameservers but returns early if the context is
+// cancelled.
+func (p *Route53Zone) NameserversContext(ctx context.Context, zoneName string) ([]string, error) {
+	if err := p.updateZone(ctx, zoneName); err != nil {
 		return nil, err
 	}
 
 	return p.nameservers, nil
 }
 
-func (p *Route53Zone) updateRecord(recordName string, zoneID string, ip net.IP) error {
+func (p *Route53Zone) updateRecord(ctx context.Context, recordName string, zoneID string, rrType string, ip net.IP) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	resp, err := p.options.API.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
 		ChangeBatch: &route53.ChangeBatch{
 			Changes: []*route53.Change{
@@ -118,7 +172,7 @@ func (p *Route53Zone) updateRecord(recordName string, zoneID string, ip net.IP)
 					ResourceRecordSet: &route53.ResourceRecordSet{
 						Name:            aws.String(recordName),
 						TTL:             aws.Int64(p.options.TTL),
-						Type:            aws.String(route53.RRTypeA),
+						Type:            aws.String(rrType),
 						ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(ip.String())}},
 					},
 				},
@@ -131,10 +185,16 @@ func (p *Route53Zone) updateRecord(recordName string, zoneID string, ip net.IP)
 		return err
 	}
 
-	return p.waitForChange(*resp.ChangeInfo.Id)
+	start := time.Now()
+	err = p.waitForChange(ctx, *resp.ChangeInfo.Id)
+	if p.options.WatchCallback != nil {
+		p.options.WatchCallback(time.Since(start), err)
+	}
+
+	return err
 }
 
-func (p *Route53Zone) waitForChange(changeID string) error {
+func (p *Route53Zone) waitForChange(ctx context.Context, changeID string) error {
 	timeout := time.NewTimer(p.options.WatchTimeout)
 	tick := time.NewTicker(p.options.WatchInterval)
 	defer func() {
@@ -158,11 +218,17 @@ func (p *Route53Zone) waitForChange(changeID string) error {
 			}
 		case <-timeout.C:
 			return ErrRoute53WatchTimedOut
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 }
 
-func (p *Route53Zone) updateZone(name string) error {
+func (p *Route53Zone) updateZone(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	zones, err := p.options.API.ListHostedZonesByName(&route53.ListHostedZonesByNameInput{
 		DNSName:  aws.String(name),
 		MaxItems: aws.String("1"),
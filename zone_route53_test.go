@@ -15,6 +15,7 @@
 package odyn
 
 import (
+	"context"
 	"errors"
 	"net"
 	"testing"
@@ -27,6 +28,7 @@ import (
 
 type mockRoute53API struct {
 	route53iface.Route53API
+	lastChange    *route53.ChangeResourceRecordSetsInput
 	getZoneResp   *route53.GetHostedZoneOutput
 	getZoneErr    error
 	getChangeResp *route53.GetChangeOutput
@@ -45,7 +47,8 @@ func (m mockRoute53API) GetHostedZone(in *route53.GetHostedZoneInput) (*route53.
 	return m.getZoneResp, m.getZoneErr
 }
 
-func (m mockRoute53API) ChangeResourceRecordSets(in *route53.ChangeResourceRecordSetsInput) (*route53.ChangeResourceRecordSetsOutput, error) {
+func (m *mockRoute53API) ChangeResourceRecordSets(in *route53.ChangeResourceRecordSetsInput) (*route53.ChangeResourceRecordSetsOutput, error) {
+	m.lastChange = in
 	return m.changeRRResp, m.changeRRErr
 }
 
@@ -284,6 +287,126 @@ func TestRoute53Zone_UpdateA(t *testing.T) {
 	}
 }
 
+func TestRoute53Zone_UpdateAAAA(t *testing.T) {
+	api := &mockRoute53API{
+		getZoneResp:   testRoute53GetZoneOK,
+		getChangeResp: testRoute53GetChangeOK,
+		listZonesResp: testRoute53ListZonesOK,
+		changeRRResp:  testRoute53ChangeRROK,
+	}
+	p, _ := NewRoute53ZoneWithOptions(&Route53ZoneOptions{
+		API:           api,
+		WatchInterval: 100 * time.Millisecond,
+		WatchTimeout:  time.Second,
+	})
+
+	err := p.UpdateAAAA("test.example.com", "example.com.", net.ParseIP("2001:db8::1"))
+	if err != nil {
+		t.Fatalf("Route53.UpdateAAAA returned unexpected error: %+v", err)
+	}
+
+	rrset := api.lastChange.ChangeBatch.Changes[0].ResourceRecordSet
+	if *rrset.Type != route53.RRTypeAaaa {
+		t.Errorf("Route53.UpdateAAAA sent unexpected record type: %s", *rrset.Type)
+	}
+
+	if *rrset.ResourceRecords[0].Value != "2001:db8::1" {
+		t.Errorf("Route53.UpdateAAAA sent unexpected record value: %s", *rrset.ResourceRecords[0].Value)
+	}
+}
+
+func TestRoute53Zone_UpdateAAAA_notIPv6(t *testing.T) {
+	api := &mockRoute53API{
+		getZoneResp:   testRoute53GetZoneOK,
+		getChangeResp: testRoute53GetChangeOK,
+		listZonesResp: testRoute53ListZonesOK,
+		changeRRResp:  testRoute53ChangeRROK,
+	}
+	p, _ := NewRoute53ZoneWithOptions(&Route53ZoneOptions{API: api})
+
+	for _, ip := range []string{"1.2.3.4", "::ffff:1.2.3.4"} {
+		err := p.UpdateAAAA("test.example.com", "example.com.", net.ParseIP(ip))
+		if err != ErrRoute53NotIPv6 {
+			t.Errorf("Route53.UpdateAAAA(%s) returned unexpected error: %+v", ip, err)
+		}
+	}
+
+	if api.lastChange != nil {
+		t.Error("Route53.UpdateAAAA sent a change for an IPv4 address")
+	}
+}
+
+func TestRoute53Zone_UpdateA_notIPv4(t *testing.T) {
+	api := &mockRoute53API{
+		getZoneResp:   testRoute53GetZoneOK,
+		getChangeResp: testRoute53GetChangeOK,
+		listZonesResp: testRoute53ListZonesOK,
+		changeRRResp:  testRoute53ChangeRROK,
+	}
+	p, _ := NewRoute53ZoneWithOptions(&Route53ZoneOptions{API: api})
+
+	err := p.UpdateA("test.example.com", "example.com.", net.ParseIP("2001:db8::1"))
+	if err != ErrRoute53NotIPv4 {
+		t.Errorf("Route53.UpdateA returned unexpected error: %+v", err)
+	}
+
+	if api.lastChange != nil {
+		t.Error("Route53.UpdateA sent a change for an IPv6 address")
+	}
+}
+
+func TestRoute53Zone_UpdateAContext_cancelled(t *testing.T) {
+	p, _ := NewRoute53ZoneWithOptions(&Route53ZoneOptions{
+		API: &mockRoute53API{
+			getZoneResp:   testRoute53GetZoneOK,
+			getChangeResp: testRoute53GetChangePending,
+			listZonesResp: testRoute53ListZonesOK,
+			changeRRResp:  testRoute53ChangeRROK,
+		},
+		WatchInterval: 100 * time.Millisecond,
+		WatchTimeout:  time.Minute,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	err := p.UpdateAContext(ctx, "test.example.com", "example.com.", net.ParseIP("1.1.1.1"))
+	if err != context.DeadlineExceeded {
+		t.Errorf("Route53.UpdateAContext returned unexpected error: %+v", err)
+	}
+}
+
+func TestRoute53Zone_WatchCallback(t *testing.T) {
+	var called bool
+	var callbackErr error
+	p, _ := NewRoute53ZoneWithOptions(&Route53ZoneOptions{
+		API: &mockRoute53API{
+			getZoneResp:   testRoute53GetZoneOK,
+			getChangeResp: testRoute53GetChangePending,
+			listZonesResp: testRoute53ListZonesOK,
+			changeRRResp:  testRoute53ChangeRROK,
+		},
+		WatchInterval: 100 * time.Millisecond,
+		WatchTimeout:  200 * time.Millisecond,
+		WatchCallback: func(wait time.Duration, err error) {
+			called = true
+			callbackErr = err
+			if wait < 200*time.Millisecond {
+				t.Errorf("Route53.WatchCallback called with unexpected wait: %s", wait)
+			}
+		},
+	})
+
+	p.UpdateA("test.example.com", "example.com.", net.ParseIP("1.1.1.1"))
+	if !called {
+		t.Fatalf("Route53.WatchCallback was not called")
+	}
+
+	if callbackErr != ErrRoute53WatchTimedOut {
+		t.Errorf("Route53.WatchCallback called with unexpected error: %+v", callbackErr)
+	}
+}
+
 func TestRoute53Zone_Nameservers(t *testing.T) {
 	testCases := []struct {
 		listZonesErr      error